@@ -0,0 +1,312 @@
+// Package accesslog counts website traffic from web server access logs in the
+// "combined" format used by nginx and Apache, e.g.
+//
+//	203.0.113.9 - - [01/Apr/2019:09:00:00 +0100] "GET /download HTTP/1.1" 200 5120 "https://duckduckgo.com/" "Mozilla/5.0 ..."
+package accesslog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TimeFormat is the layout of the time in a log line
+const TimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// Entry is a single request from the log
+type Entry struct {
+	RemoteAddr string
+	Time       time.Time
+	Method     string
+
+	// Path doesn't include the query string
+	Path string
+
+	Status    int
+	Referrer  string
+	UserAgent string
+}
+
+var combinedLine = regexp.MustCompile(
+	`^(\S+) \S+ \S+ \[([^\]]+)\] "((?:[^"\\]|\\.)*)" (\d{3}) \S+ "((?:[^"\\]|\\.)*)" "((?:[^"\\]|\\.)*)"`)
+
+// ParseLine parses a line in the combined log format
+func ParseLine(line string) (*Entry, error) {
+	match := combinedLine.FindStringSubmatch(line)
+	if match == nil {
+		return nil, fmt.Errorf("not in the combined log format")
+	}
+
+	entry := Entry{RemoteAddr: match[1], Referrer: match[5], UserAgent: match[6]}
+
+	var err error
+	if entry.Time, err = time.Parse(TimeFormat, match[2]); err != nil {
+		return nil, fmt.Errorf("invalid time '%s'", match[2])
+	}
+
+	request := strings.Fields(match[3])
+	if len(request) != 3 {
+		return nil, fmt.Errorf("invalid request '%s'", match[3])
+	}
+	entry.Method = request[0]
+	entry.Path = request[1]
+	if i := strings.IndexByte(entry.Path, '?'); i >= 0 {
+		entry.Path = entry.Path[:i]
+	}
+
+	if entry.Status, err = strconv.Atoi(match[4]); err != nil {
+		return nil, fmt.Errorf("invalid status '%s'", match[4])
+	}
+	return &entry, nil
+}
+
+// AllPaths is the pattern of the totals across every pattern, where a page
+// view matching more than one pattern counts once, as does each visitor
+const AllPaths = "*"
+
+// DayTotals is the traffic to the paths matching a pattern on a single day
+type DayTotals struct {
+	// Day is midnight UTC
+	Day     time.Time
+	Pattern string
+
+	PageViews int
+
+	// UniqueVisitors counts each IP address and user agent once
+	UniqueVisitors int
+
+	// Referrers counts the page views referred by each site, e.g.
+	// "duckduckgo.com"
+	Referrers map[string]int
+}
+
+// DayDownloads is the number of downloads of a version on a single day
+type DayDownloads struct {
+	// Day is midnight UTC
+	Day     time.Time
+	Version string
+	Count   int
+}
+
+// Traffic counts page views of the paths matching each of its patterns, and
+// of all of them together as AllPaths, and optionally downloads of each
+// version
+type Traffic struct {
+	patterns []string
+	totals   map[dayPattern]*DayTotals
+	visitors map[dayPattern]map[string]bool
+	covered  map[time.Time]bool
+
+	downloadPath *regexp.Regexp
+	downloads    map[dayPattern]int
+
+	// Lines is the number of lines read, and Invalid how many of them
+	// couldn't be parsed
+	Lines   int
+	Invalid int
+
+	// FirstProblem describes the first invalid line, if any
+	FirstProblem string
+}
+
+type dayPattern struct {
+	day     time.Time
+	pattern string
+}
+
+// NewTraffic returns a Traffic counting the paths that match each pattern,
+// e.g. "/download" or "/blog/release*", as matched by path.Match
+func NewTraffic(patterns []string) (*Traffic, error) {
+	for _, pattern := range patterns {
+		if !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("invalid path '%s', expected e.g. '/download'", pattern)
+		}
+		if _, err := path.Match(pattern, "/"); err != nil {
+			return nil, fmt.Errorf("invalid path '%s': %v", pattern, err)
+		}
+	}
+
+	return &Traffic{
+		patterns: patterns,
+		totals:   make(map[dayPattern]*DayTotals),
+		visitors: make(map[dayPattern]map[string]bool),
+		covered:  make(map[time.Time]bool),
+	}, nil
+}
+
+// CountDownloads counts requests for paths matching downloadPath as downloads
+// of the version in its first group, e.g. `^/download/fluidkeys_([0-9.]+)_`
+func (t *Traffic) CountDownloads(downloadPath *regexp.Regexp) error {
+	if downloadPath.NumSubexp() < 1 {
+		return fmt.Errorf("download path pattern '%s' has no group for the version", downloadPath)
+	}
+	t.downloadPath = downloadPath
+	t.downloads = make(map[dayPattern]int)
+	return nil
+}
+
+// Read counts every line of a log, which may be gzipped. Lines that can't be
+// parsed are counted as Invalid rather than stopping the whole log being read.
+func (t *Traffic) Read(r io.Reader) error {
+	buffered := bufio.NewReader(r)
+
+	// gzip files start with 0x1f 0x8b
+	if magic, err := buffered.Peek(2); err == nil && magic[0] == 0x1f && magic[1] == 0x8b {
+		unzipped, err := gzip.NewReader(buffered)
+		if err != nil {
+			return err
+		}
+		defer unzipped.Close()
+		buffered = bufio.NewReader(unzipped)
+	}
+
+	scanner := bufio.NewScanner(buffered)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		t.Lines++
+
+		entry, err := ParseLine(line)
+		if err != nil {
+			t.Invalid++
+			if t.FirstProblem == "" {
+				t.FirstProblem = fmt.Sprintf("%v: %s", err, line)
+			}
+			continue
+		}
+		t.Add(entry)
+	}
+	return scanner.Err()
+}
+
+// Add counts the entry if it's a page view of one of the paths: a successful
+// GET that isn't from a bot or a script. It's counted as a download if it
+// downloaded the whole file and isn't from a crawler, since scripts such as
+// install scripts download releases too.
+func (t *Traffic) Add(entry *Entry) {
+	day := entry.Time.UTC().Truncate(24 * time.Hour)
+	t.covered[day] = true
+
+	if t.downloadPath != nil && entry.Method == "GET" && entry.Status == 200 && !isCrawler(entry.UserAgent) {
+		if match := t.downloadPath.FindStringSubmatch(entry.Path); match != nil && match[1] != "" {
+			t.downloads[dayPattern{day: day, pattern: match[1]}]++
+		}
+	}
+
+	if entry.Method != "GET" || !isSuccess(entry.Status) || isCrawler(entry.UserAgent) ||
+		scriptUserAgent.MatchString(entry.UserAgent) {
+		return
+	}
+
+	matchedAny := false
+	for _, pattern := range t.patterns {
+		if matched, _ := path.Match(pattern, entry.Path); matched {
+			t.countPageView(dayPattern{day: day, pattern: pattern}, entry)
+			matchedAny = true
+		}
+	}
+	if matchedAny {
+		t.countPageView(dayPattern{day: day, pattern: AllPaths}, entry)
+	}
+}
+
+func (t *Traffic) countPageView(key dayPattern, entry *Entry) {
+	totals, ok := t.totals[key]
+	if !ok {
+		totals = &DayTotals{Day: key.day, Pattern: key.pattern, Referrers: map[string]int{}}
+		t.totals[key] = totals
+		t.visitors[key] = map[string]bool{}
+	}
+
+	totals.PageViews++
+
+	visitor := entry.RemoteAddr + " " + entry.UserAgent
+	if !t.visitors[key][visitor] {
+		t.visitors[key][visitor] = true
+		totals.UniqueVisitors++
+	}
+
+	if referrer := referrerSite(entry.Referrer); referrer != "" {
+		totals.Referrers[referrer]++
+	}
+}
+
+// Days returns the totals for each day and pattern with any page views,
+// including AllPaths, ordered by day then pattern
+func (t *Traffic) Days() []DayTotals {
+	days := []DayTotals{}
+	for _, totals := range t.totals {
+		days = append(days, *totals)
+	}
+	sort.Slice(days, func(i, j int) bool {
+		if !days[i].Day.Equal(days[j].Day) {
+			return days[i].Day.Before(days[j].Day)
+		}
+		return days[i].Pattern < days[j].Pattern
+	})
+	return days
+}
+
+// Downloads returns the number of downloads of each version on each day with
+// any, ordered by day then version
+func (t *Traffic) Downloads() []DayDownloads {
+	downloads := []DayDownloads{}
+	for key, count := range t.downloads {
+		downloads = append(downloads, DayDownloads{Day: key.day, Version: key.pattern, Count: count})
+	}
+	sort.Slice(downloads, func(i, j int) bool {
+		if !downloads[i].Day.Equal(downloads[j].Day) {
+			return downloads[i].Day.Before(downloads[j].Day)
+		}
+		return downloads[i].Version < downloads[j].Version
+	})
+	return downloads
+}
+
+// Covered returns every day with a request in the logs, in order
+func (t *Traffic) Covered() []time.Time {
+	days := []time.Time{}
+	for day := range t.covered {
+		days = append(days, day)
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	return days
+}
+
+func isSuccess(status int) bool {
+	return (status >= 200 && status < 300) || status == 304
+}
+
+var (
+	crawlerUserAgent = regexp.MustCompile(`(?i)bot|crawl|spider|slurp`)
+	scriptUserAgent  = regexp.MustCompile(`(?i)curl|wget|python-requests|go-http-client`)
+)
+
+func isCrawler(userAgent string) bool {
+	return userAgent == "" || userAgent == "-" || crawlerUserAgent.MatchString(userAgent)
+}
+
+// referrerSite returns the host of a referrer URL without "www.", or "" if
+// there isn't one
+func referrerSite(referrer string) string {
+	if referrer == "" || referrer == "-" {
+		return ""
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil || parsed.Host == "" {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
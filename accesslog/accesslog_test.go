@@ -0,0 +1,208 @@
+package accesslog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testLog = `203.0.113.9 - - [01/Apr/2019:09:00:00 +0100] "GET /download?os=mac HTTP/1.1" 200 5120 "https://www.duckduckgo.com/?q=fluidkeys" "Mozilla/5.0 (Macintosh)"
+203.0.113.9 - - [01/Apr/2019:09:05:00 +0100] "GET /download HTTP/1.1" 304 0 "-" "Mozilla/5.0 (Macintosh)"
+198.51.100.4 - - [01/Apr/2019:23:30:00 +0000] "GET /blog/release-0-2-6 HTTP/1.1" 200 812 "https://news.ycombinator.com/item?id=1" "Mozilla/5.0 (X11; Linux)"
+198.51.100.4 - - [02/Apr/2019:00:30:00 +0000] "GET /download HTTP/1.1" 200 5120 "https://fluidkeys.com/" "Mozilla/5.0 (X11; Linux)"
+192.0.2.1 - - [02/Apr/2019:01:00:00 +0000] "GET /download HTTP/1.1" 200 5120 "-" "Googlebot/2.1"
+192.0.2.2 - - [02/Apr/2019:01:00:00 +0000] "GET /download HTTP/1.1" 404 0 "-" "Mozilla/5.0"
+192.0.2.3 - - [02/Apr/2019:01:00:00 +0000] "POST /download HTTP/1.1" 200 0 "-" "Mozilla/5.0"
+192.0.2.4 - - [02/Apr/2019:01:00:00 +0000] "GET /blog/ HTTP/1.1" 200 0 "-" "Mozilla/5.0"
+this isn't a log line
+`
+
+func TestParseLine(t *testing.T) {
+	entry, err := ParseLine(`203.0.113.9 - frank [01/Apr/2019:09:00:00 +0100] "GET /download?os=mac HTTP/1.1" ` +
+		`200 - "https://duckduckgo.com/" "Mozilla/5.0 \"quoted\""`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := Entry{
+		RemoteAddr: "203.0.113.9",
+		Time:       time.Date(2019, 4, 1, 8, 0, 0, 0, time.UTC),
+		Method:     "GET",
+		Path:       "/download",
+		Status:     200,
+		Referrer:   "https://duckduckgo.com/",
+		UserAgent:  `Mozilla/5.0 \"quoted\"`,
+	}
+	if !entry.Time.Equal(expected.Time) {
+		t.Errorf("expected time %v, got %v", expected.Time, entry.Time)
+	}
+	entry.Time = expected.Time
+	if *entry != expected {
+		t.Errorf("expected %+v, got %+v", expected, *entry)
+	}
+
+	for _, invalid := range []string{
+		"",
+		`203.0.113.9 - - [01/Apr/2019:09:00:00 +0100] "GET /download HTTP/1.1" 200 5120`,
+		`203.0.113.9 - - [2019-04-01 09:00:00] "GET /download HTTP/1.1" 200 5120 "-" "-"`,
+		`203.0.113.9 - - [01/Apr/2019:09:00:00 +0100] "-" 400 0 "-" "-"`,
+	} {
+		if _, err := ParseLine(invalid); err == nil {
+			t.Errorf("%q: expected an error", invalid)
+		}
+	}
+}
+
+func TestTraffic(t *testing.T) {
+	for name, log := range map[string][]byte{
+		"plain":   []byte(testLog),
+		"gzipped": gzipped(t, testLog),
+	} {
+		t.Run(name, func(t *testing.T) {
+			traffic, err := NewTraffic([]string{"/download", "/blog/release*"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := traffic.Read(bytes.NewReader(log)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if traffic.Lines != 9 || traffic.Invalid != 1 {
+				t.Errorf("expected 9 lines with 1 invalid, got %d and %d", traffic.Lines, traffic.Invalid)
+			}
+
+			days := traffic.Days()
+			if len(days) != 5 {
+				t.Fatalf("expected 5 days and patterns, got %+v", days)
+			}
+
+			april1 := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+			april2 := time.Date(2019, 4, 2, 0, 0, 0, 0, time.UTC)
+
+			assertTotals(t, DayTotals{Day: april1, Pattern: AllPaths, PageViews: 3, UniqueVisitors: 2,
+				Referrers: map[string]int{"duckduckgo.com": 1, "news.ycombinator.com": 1}}, days[0])
+			assertTotals(t, DayTotals{Day: april1, Pattern: "/blog/release*", PageViews: 1, UniqueVisitors: 1,
+				Referrers: map[string]int{"news.ycombinator.com": 1}}, days[1])
+			assertTotals(t, DayTotals{Day: april1, Pattern: "/download", PageViews: 2, UniqueVisitors: 1,
+				Referrers: map[string]int{"duckduckgo.com": 1}}, days[2])
+			// the bot, the 404 and the POST aren't page views
+			assertTotals(t, DayTotals{Day: april2, Pattern: AllPaths, PageViews: 1, UniqueVisitors: 1,
+				Referrers: map[string]int{"fluidkeys.com": 1}}, days[3])
+			assertTotals(t, DayTotals{Day: april2, Pattern: "/download", PageViews: 1, UniqueVisitors: 1,
+				Referrers: map[string]int{"fluidkeys.com": 1}}, days[4])
+		})
+	}
+}
+
+func TestTrafficOverlappingPatterns(t *testing.T) {
+	log := `203.0.113.9 - - [01/Apr/2019:09:00:00 +0000] "GET /blog/release-0-2-6 HTTP/1.1" 200 812 "https://duckduckgo.com/" "Mozilla/5.0"
+203.0.113.9 - - [01/Apr/2019:09:01:00 +0000] "GET /blog/ HTTP/1.1" 200 812 "-" "Mozilla/5.0"
+`
+	traffic, err := NewTraffic([]string{"/blog/*", "/blog/release*"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := traffic.Read(strings.NewReader(log)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	days := traffic.Days()
+	if len(days) != 3 {
+		t.Fatalf("expected 3 patterns, got %+v", days)
+	}
+
+	// the release post matches both patterns, but counts once in the total
+	april1 := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	assertTotals(t, DayTotals{Day: april1, Pattern: AllPaths, PageViews: 2, UniqueVisitors: 1,
+		Referrers: map[string]int{"duckduckgo.com": 1}}, days[0])
+	assertTotals(t, DayTotals{Day: april1, Pattern: "/blog/*", PageViews: 2, UniqueVisitors: 1,
+		Referrers: map[string]int{"duckduckgo.com": 1}}, days[1])
+	assertTotals(t, DayTotals{Day: april1, Pattern: "/blog/release*", PageViews: 1, UniqueVisitors: 1,
+		Referrers: map[string]int{"duckduckgo.com": 1}}, days[2])
+}
+
+func TestDownloads(t *testing.T) {
+	log := `203.0.113.9 - - [01/Apr/2019:09:00:00 +0000] "GET /download/fluidkeys_0.2.6_amd64.deb HTTP/1.1" 200 5120 "-" "Debian APT-HTTP/1.3"
+203.0.113.9 - - [01/Apr/2019:09:00:01 +0000] "GET /download/fluidkeys_0.2.6_amd64.deb HTTP/1.1" 206 512 "-" "Debian APT-HTTP/1.3"
+198.51.100.4 - - [01/Apr/2019:10:00:00 +0000] "GET /download/fluidkeys_0.2.6_darwin.tar.gz HTTP/1.1" 200 5120 "-" "curl/7.54.0"
+198.51.100.4 - - [01/Apr/2019:10:00:00 +0000] "GET /download/fluidkeys_0.2.5_darwin.tar.gz HTTP/1.1" 200 5120 "-" "Googlebot/2.1"
+198.51.100.4 - - [02/Apr/2019:10:00:00 +0000] "GET /download/fluidkeys_0.2.5_darwin.tar.gz HTTP/1.1" 200 5120 "-" "Mozilla/5.0"
+`
+	traffic, err := NewTraffic(nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := traffic.CountDownloads(regexp.MustCompile(`^/download/fluidkeys_([0-9.]+)_`)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := traffic.Read(strings.NewReader(log)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	april1 := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	april2 := time.Date(2019, 4, 2, 0, 0, 0, 0, time.UTC)
+
+	// the partial download and the crawler aren't counted, but the script is
+	expected := []DayDownloads{
+		{Day: april1, Version: "0.2.6", Count: 2},
+		{Day: april2, Version: "0.2.5", Count: 1},
+	}
+	got := traffic.Downloads()
+	if len(got) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, got)
+	}
+	for i := range expected {
+		if !got[i].Day.Equal(expected[i].Day) || got[i].Version != expected[i].Version ||
+			got[i].Count != expected[i].Count {
+			t.Errorf("expected %+v, got %+v", expected[i], got[i])
+		}
+	}
+
+	if covered := traffic.Covered(); len(covered) != 2 || !covered[0].Equal(april1) || !covered[1].Equal(april2) {
+		t.Errorf("expected 2 days covered, got %v", covered)
+	}
+
+	if err := traffic.CountDownloads(regexp.MustCompile(`^/download/`)); err == nil {
+		t.Errorf("expected an error for a pattern without a version group")
+	}
+}
+
+func TestNewTraffic(t *testing.T) {
+	for _, invalid := range [][]string{{"download"}, {"/blog/[release"}} {
+		if _, err := NewTraffic(invalid); err == nil {
+			t.Errorf("%v: expected an error", invalid)
+		}
+	}
+}
+
+func assertTotals(t *testing.T, expected DayTotals, got DayTotals) {
+	t.Helper()
+
+	if !got.Day.Equal(expected.Day) || got.Pattern != expected.Pattern || got.PageViews != expected.PageViews ||
+		got.UniqueVisitors != expected.UniqueVisitors || len(got.Referrers) != len(expected.Referrers) {
+		t.Errorf("expected %+v, got %+v", expected, got)
+		return
+	}
+	for referrer, count := range expected.Referrers {
+		if got.Referrers[referrer] != count {
+			t.Errorf("expected %+v, got %+v", expected, got)
+		}
+	}
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	if _, err := writer.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buffer.Bytes()
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/alerts"
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// runAlerts evaluates every alert rule against the current metrics, records
+// any change of state and notifies the configured webhooks about it. A rule
+// that fails doesn't stop the others being evaluated: the errors are returned
+// together at the end.
+func runAlerts() error {
+	rules, err := getAlertRules()
+	if err != nil {
+		return err
+	}
+
+	notifiers := getAlertNotifiers()
+	values, valueErrors := getEachMetricValue()
+
+	problems := []string{}
+	for _, rule := range rules {
+		if err := runAlertRule(rule, values, valueErrors, notifiers); err != nil {
+			problems = append(problems, fmt.Sprintf("alert rule '%s': %v", rule.Name, err))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%d of %d alert rules failed: %s", len(problems), len(rules), strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// runAlertRule evaluates a single rule, notifying and recording its new state
+// if it's changed
+func runAlertRule(rule alerts.Rule, values map[string]float64, valueErrors map[string]error,
+	notifiers []alerts.Notifier) error {
+
+	if err, failed := valueErrors[rule.Metric]; failed {
+		return fmt.Errorf("failed to get %s: %v", rule.Metric, err)
+	}
+	value, ok := values[rule.Metric]
+	if !ok {
+		return fmt.Errorf("unknown metric '%s'", rule.Metric)
+	}
+
+	firing, err := rule.Firing(value)
+	if err != nil {
+		return err
+	}
+
+	previous, err := datastore.AlertState(rule.Name)
+	if err != nil {
+		return err
+	}
+
+	next, notify := alerts.Transition(alerts.State(previous), firing)
+	if previous != "" && !notify {
+		return nil
+	}
+
+	alert := alerts.Alert{Rule: rule, State: next, Value: value, At: time.Now()}
+
+	var notifyErr error
+	if notify {
+		fmt.Printf("Alert %s: %s\n", next, alert.Text())
+
+		var delivered bool
+		delivered, notifyErr = notifyAll(notifiers, alert)
+		if !delivered {
+			// don't record the new state so we try again next run
+			return notifyErr
+		}
+	}
+
+	if err := datastore.SetAlertState(rule.Name, string(next), value, alert.At); err != nil {
+		return err
+	}
+	return notifyErr
+}
+
+// notifyAll sends the alert to every notifier. It's delivered if there are no
+// notifiers or at least one of them succeeded, in which case the new state is
+// recorded and the ones that failed won't be retried. The error describes
+// every notifier that failed.
+func notifyAll(notifiers []alerts.Notifier, alert alerts.Alert) (delivered bool, err error) {
+	failures := []string{}
+	for _, notifier := range notifiers {
+		if err := notifier.Notify(alert); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+
+	if len(failures) == 0 {
+		return true, nil
+	}
+	err = fmt.Errorf("%d of %d notifiers failed: %s", len(failures), len(notifiers), strings.Join(failures, "; "))
+	return len(failures) < len(notifiers), err
+}
+
+// getAlertRules returns the rules from ALERT_RULES_JSON, or the default rules if
+// it's not set
+func getAlertRules() ([]alerts.Rule, error) {
+	rulesJSON, got := os.LookupEnv("ALERT_RULES_JSON")
+	if !got {
+		return alerts.DefaultRules, nil
+	}
+
+	return alerts.ParseRules(rulesJSON)
+}
+
+// getAlertNotifiers returns a notifier for each (comma separated) URL in
+// ALERT_SLACK_WEBHOOK_URLS and ALERT_WEBHOOK_URLS
+func getAlertNotifiers() []alerts.Notifier {
+	client := &http.Client{Timeout: 10 * time.Second}
+	notifiers := []alerts.Notifier{}
+
+	for _, url := range splitEnvList("ALERT_SLACK_WEBHOOK_URLS") {
+		notifiers = append(notifiers, alerts.SlackNotifier{WebhookURL: url, Client: client})
+	}
+
+	for _, url := range splitEnvList("ALERT_WEBHOOK_URLS") {
+		notifiers = append(notifiers, alerts.WebhookNotifier{URL: url, Client: client})
+	}
+
+	return notifiers
+}
+
+// scalarMetricNames are the metrics getMetricValue can get, along with the
+// 30 day total of each manual metric
+var scalarMetricNames = []string{
+	"callsArrangedNext7Days",
+	"daysSinceLastRelease",
+	"releaseNotesSignupsLast30Days",
+	"trialsStartedLast30Days",
+	"activeTeams",
+	"teamMembers",
+}
+
+// manualMetricTotalSuffix is added to a manual metric's name to get the
+// scalar metric of its total over the last 30 days, e.g.
+// "interviewsLast30Days"
+const manualMetricTotalSuffix = "Last30Days"
+
+func isScalarMetric(name string) bool {
+	for _, scalarMetricName := range scalarMetricNames {
+		if name == scalarMetricName {
+			return true
+		}
+	}
+	return strings.HasSuffix(name, manualMetricTotalSuffix) &&
+		datastore.IsManualMetric(strings.TrimSuffix(name, manualMetricTotalSuffix))
+}
+
+// getMetricValue returns the current value of a metric that alert rules,
+// snapshots and dashboard numbers can refer to, by the same name used in the
+// JSON API
+func getMetricValue(name string, now time.Time) (float64, error) {
+	last30Days := datastore.LastNDays(30, now)
+
+	switch name {
+	case "callsArrangedNext7Days":
+		calls, err := callsArrangedNext7Days(now)
+		return float64(calls), err
+
+	case "daysSinceLastRelease":
+		days, err := daysSinceLastRelease(now)
+		return float64(days), err
+
+	case "releaseNotesSignupsLast30Days":
+		signups, err := datastore.Total("signups", last30Days, nil)
+		return float64(signups), err
+
+	case "trialsStartedLast30Days":
+		trials, err := datastore.Total("trials", last30Days, nil)
+		return float64(trials), err
+
+	case "activeTeams", "teamMembers":
+		teams, err := datastore.TeamRows()
+		if err != nil {
+			return 0, err
+		}
+		activeTeams, teamMembers := teamTotals(teams)
+		if name == "activeTeams" {
+			return float64(activeTeams), nil
+		}
+		return float64(teamMembers), nil
+	}
+
+	if isScalarMetric(name) {
+		total, err := datastore.Total(strings.TrimSuffix(name, manualMetricTotalSuffix), last30Days, nil)
+		return float64(total), err
+	}
+	return 0, fmt.Errorf("unknown metric '%s'", name)
+}
+
+// getEachMetricValue gets every metric getMetricValue can, returning the ones
+// that couldn't be got (e.g. daysSinceLastRelease before anything's been
+// released) as errors, keyed by name
+func getEachMetricValue() (map[string]float64, map[string]error) {
+	now := time.Now()
+
+	names := append([]string{}, scalarMetricNames...)
+	for _, metric := range getManualMetricNames() {
+		names = append(names, metric+manualMetricTotalSuffix)
+	}
+
+	values := map[string]float64{}
+	valueErrors := map[string]error{}
+
+	for _, name := range names {
+		value, err := getMetricValue(name, now)
+		if err != nil {
+			valueErrors[name] = err
+			continue
+		}
+		values[name] = value
+	}
+	return values, valueErrors
+}
+
+func sumDateCounts(dateCounts []datastore.DateCount) int {
+	total := 0
+	for _, dateCount := range dateCounts {
+		total += dateCount.Count
+	}
+	return total
+}
+
+// splitEnvList returns the comma separated values in the given environment
+// variable, ignoring any empty ones
+func splitEnvList(name string) []string {
+	values := []string{}
+	for _, value := range strings.Split(os.Getenv(name), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/fluidkeys/dashboard/alerts"
+)
+
+type fakeNotifier struct {
+	err  error
+	sent int
+}
+
+func (n *fakeNotifier) Notify(alert alerts.Alert) error {
+	if n.err != nil {
+		return n.err
+	}
+	n.sent++
+	return nil
+}
+
+func TestNotifyAll(t *testing.T) {
+	alert := alerts.Alert{Rule: alerts.DefaultRules[0], State: alerts.Firing}
+	failing := func() *fakeNotifier { return &fakeNotifier{err: fmt.Errorf("webhook returned 500")} }
+
+	t.Run("no notifiers", func(t *testing.T) {
+		if delivered, err := notifyAll(nil, alert); !delivered || err != nil {
+			t.Errorf("expected delivered, got %v, %v", delivered, err)
+		}
+	})
+
+	t.Run("one of two fails", func(t *testing.T) {
+		working := &fakeNotifier{}
+		delivered, err := notifyAll([]alerts.Notifier{failing(), working}, alert)
+
+		if !delivered || working.sent != 1 {
+			t.Errorf("expected it to be delivered by the working notifier, got %v, %d sent", delivered, working.sent)
+		}
+		if err == nil || err.Error() != "1 of 2 notifiers failed: webhook returned 500" {
+			t.Errorf("expected the failure to be reported, got %v", err)
+		}
+	})
+
+	t.Run("all fail", func(t *testing.T) {
+		if delivered, err := notifyAll([]alerts.Notifier{failing(), failing()}, alert); delivered || err == nil {
+			t.Errorf("expected it not to be delivered, got %v, %v", delivered, err)
+		}
+	})
+}
+
+func TestRunAlertRuleWithoutValue(t *testing.T) {
+	rule := alerts.DefaultRules[1]
+
+	err := runAlertRule(rule, map[string]float64{},
+		map[string]error{rule.Metric: fmt.Errorf("no releases have been announced")}, nil)
+	if err == nil || err.Error() != "failed to get daysSinceLastRelease: no releases have been announced" {
+		t.Errorf("expected the metric's error, got %v", err)
+	}
+
+	unknown := alerts.Rule{Name: "typo", Metric: "signupz", Operator: "<", Threshold: 1}
+	if err := runAlertRule(unknown, map[string]float64{}, nil, nil); err == nil {
+		t.Error("expected an error for an unknown metric")
+	}
+}
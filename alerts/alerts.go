@@ -0,0 +1,131 @@
+// Package alerts evaluates threshold rules against the dashboard metrics and
+// notifies webhooks when an alert starts or stops firing.
+package alerts
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+// State is whether an alert is currently firing or has resolved
+type State string
+
+const (
+	// Firing means the rule's condition is currently true
+	Firing State = "firing"
+
+	// Resolved means the rule's condition was true and no longer is
+	Resolved State = "resolved"
+)
+
+// Rule describes a threshold on one of the metrics, for example "fire when
+// callsArrangedNext7Days < 3"
+type Rule struct {
+	Name      string  `json:"name"`
+	Metric    string  `json:"metric"`
+	Operator  string  `json:"operator"`
+	Threshold float64 `json:"threshold"`
+	Message   string  `json:"message"`
+}
+
+// DefaultRules are used when no ALERT_RULES_JSON is configured. They match the
+// red thresholds on the dashboard itself.
+var DefaultRules = []Rule{
+	{
+		Name:      "calls-arranged-low",
+		Metric:    "callsArrangedNext7Days",
+		Operator:  "<",
+		Threshold: rag.CallsArrangedRed,
+		Message:   fmt.Sprintf("Fewer than %d calls arranged in the next 7 days", rag.CallsArrangedRed),
+	},
+	{
+		Name:      "release-overdue",
+		Metric:    "daysSinceLastRelease",
+		Operator:  ">",
+		Threshold: rag.ReleaseIntervalDays + rag.ReleaseGraceDays,
+		Message:   "Release is more than a week overdue",
+	},
+}
+
+// ParseRules parses a JSON array of rules, e.g.
+// `[{"name": "no-trials", "metric": "trialsStartedLast30Days", "operator": "<", "threshold": 1}]`
+func ParseRules(rulesJSON string) ([]Rule, error) {
+	rules := []Rule{}
+	if err := json.Unmarshal([]byte(rulesJSON), &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse alert rules: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for _, rule := range rules {
+		if rule.Name == "" {
+			return nil, fmt.Errorf("alert rule for metric '%s' has no name", rule.Metric)
+		}
+		if seen[rule.Name] {
+			return nil, fmt.Errorf("duplicate alert rule name '%s'", rule.Name)
+		}
+		seen[rule.Name] = true
+
+		if _, err := rule.Firing(0); err != nil {
+			return nil, err
+		}
+	}
+	return rules, nil
+}
+
+// Firing returns true if the given value breaches the rule's threshold
+func (r Rule) Firing(value float64) (bool, error) {
+	switch r.Operator {
+	case "<":
+		return value < r.Threshold, nil
+	case "<=":
+		return value <= r.Threshold, nil
+	case ">":
+		return value > r.Threshold, nil
+	case ">=":
+		return value >= r.Threshold, nil
+	default:
+		return false, fmt.Errorf("alert rule '%s' has invalid operator '%s'", r.Name, r.Operator)
+	}
+}
+
+// Transition works out the new state of an alert given its previously
+// recorded state (empty if it has never been evaluated) and whether it's
+// firing now. notify is only true when the state actually changes, so
+// repeated collector runs don't repeat the same notification.
+func Transition(previous State, firing bool) (next State, notify bool) {
+	if firing {
+		return Firing, previous != Firing
+	}
+
+	if previous == Firing {
+		return Resolved, true
+	}
+
+	return Resolved, false
+}
+
+// Alert is a change in state of a rule, ready to be sent to a Notifier
+type Alert struct {
+	Rule  Rule
+	State State
+	Value float64
+	At    time.Time
+}
+
+// Text returns a one line, human readable description of the alert
+func (a Alert) Text() string {
+	message := a.Rule.Message
+	if message == "" {
+		message = fmt.Sprintf("%s %s %v", a.Rule.Metric, a.Rule.Operator, a.Rule.Threshold)
+	}
+
+	switch a.State {
+	case Firing:
+		return fmt.Sprintf(":rotating_light: %s (%s is %v)", message, a.Rule.Metric, a.Value)
+	default:
+		return fmt.Sprintf(":white_check_mark: Resolved: %s (%s is %v)", message, a.Rule.Metric, a.Value)
+	}
+}
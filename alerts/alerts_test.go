@@ -0,0 +1,158 @@
+package alerts
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+func TestRuleFiring(t *testing.T) {
+	rule := Rule{Name: "calls-arranged-low", Metric: "callsArrangedNext7Days", Operator: "<", Threshold: 3}
+
+	for value, expected := range map[float64]bool{0: true, 2: true, 3: false, 10: false} {
+		got, err := rule.Firing(value)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if got != expected {
+			t.Errorf("value %v: expected firing=%v, got %v", value, expected, got)
+		}
+	}
+
+	rule.Operator = "~"
+	if _, err := rule.Firing(1); err == nil {
+		t.Errorf("expected error for invalid operator")
+	}
+}
+
+func TestCallsArrangedLowRule(t *testing.T) {
+	for _, rule := range DefaultRules {
+		if rule.Name != "calls-arranged-low" {
+			continue
+		}
+		for calls := uint(0); calls < 10; calls++ {
+			firing, err := rule.Firing(float64(calls))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if red := rag.CallsArranged(calls) == rag.Red; firing != red {
+				t.Errorf("%d calls arranged: expected firing=%v like rag.CallsArranged, got %v", calls, red, firing)
+			}
+		}
+		return
+	}
+	t.Fatal("no calls-arranged-low rule")
+}
+
+func TestReleaseOverdueRule(t *testing.T) {
+	for _, rule := range DefaultRules {
+		if rule.Name != "release-overdue" {
+			continue
+		}
+		for days := uint(0); days < 60; days++ {
+			firing, err := rule.Firing(float64(days))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if red := rag.ReleaseDue(days) == rag.Red; firing != red {
+				t.Errorf("%d days since the last release: expected firing=%v like rag.ReleaseDue, got %v",
+					days, red, firing)
+			}
+		}
+		return
+	}
+	t.Fatal("no release-overdue rule")
+}
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules(`[{"name": "no-trials", "metric": "trialsStartedLast30Days", "operator": "<", "threshold": 1}]`)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].Metric != "trialsStartedLast30Days" || rules[0].Threshold != 1 {
+		t.Errorf("unexpected rules: %+v", rules)
+	}
+
+	_, err = ParseRules(`[{"name": "a", "metric": "x", "operator": "<"}, {"name": "a", "metric": "y", "operator": ">"}]`)
+	if err == nil {
+		t.Errorf("expected error for duplicate rule names")
+	}
+}
+
+func TestTransition(t *testing.T) {
+	tests := []struct {
+		previous     State
+		firing       bool
+		expectedNext State
+		expectNotify bool
+	}{
+		{"", false, Resolved, false},
+		{"", true, Firing, true},
+		{Firing, true, Firing, false},
+		{Firing, false, Resolved, true},
+		{Resolved, false, Resolved, false},
+		{Resolved, true, Firing, true},
+	}
+
+	for _, test := range tests {
+		next, notify := Transition(test.previous, test.firing)
+		if next != test.expectedNext || notify != test.expectNotify {
+			t.Errorf("Transition(%q, %v): expected (%q, %v), got (%q, %v)",
+				test.previous, test.firing, test.expectedNext, test.expectNotify, next, notify)
+		}
+	}
+}
+
+func TestNotifiers(t *testing.T) {
+	var received map[string]interface{}
+
+	stub := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = nil
+		if err := json.Unmarshal(body, &received); err != nil {
+			t.Errorf("webhook got invalid JSON: %v", err)
+		}
+	}))
+	defer stub.Close()
+
+	alert := Alert{
+		Rule:  DefaultRules[0],
+		State: Firing,
+		Value: 1,
+		At:    time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("slack", func(t *testing.T) {
+		if err := (SlackNotifier{WebhookURL: stub.URL}).Notify(alert); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if received["text"] != alert.Text() {
+			t.Errorf("expected text %q, got %v", alert.Text(), received["text"])
+		}
+	})
+
+	t.Run("generic webhook", func(t *testing.T) {
+		if err := (WebhookNotifier{URL: stub.URL}).Notify(alert); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if received["rule"] != "calls-arranged-low" || received["state"] != "firing" || received["value"] != 1.0 {
+			t.Errorf("unexpected payload: %v", received)
+		}
+	})
+
+	t.Run("error status", func(t *testing.T) {
+		failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "nope", http.StatusInternalServerError)
+		}))
+		defer failing.Close()
+
+		if err := (WebhookNotifier{URL: failing.URL}).Notify(alert); err == nil {
+			t.Errorf("expected error for 500 response")
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package alerts
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// Notifier sends an alert somewhere people will see it
+type Notifier interface {
+	Notify(alert Alert) error
+}
+
+// SlackNotifier posts alerts to a Slack-compatible incoming webhook
+type SlackNotifier struct {
+	WebhookURL string
+	Client     *http.Client
+}
+
+// Notify posts `{"text": "..."}` to the incoming webhook
+func (n SlackNotifier) Notify(alert Alert) error {
+	payload := struct {
+		Text string `json:"text"`
+	}{
+		Text: alert.Text(),
+	}
+
+	return postJSON(n.Client, n.WebhookURL, payload)
+}
+
+// WebhookNotifier posts alerts as a generic JSON document
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+// Notify posts the alert as JSON, for example:
+// `{"rule": "calls-arranged-low", "metric": "callsArrangedNext7Days", "state": "firing", ...}`
+func (n WebhookNotifier) Notify(alert Alert) error {
+	payload := webhookPayload{
+		Rule:      alert.Rule.Name,
+		Metric:    alert.Rule.Metric,
+		Operator:  alert.Rule.Operator,
+		Threshold: alert.Rule.Threshold,
+		Message:   alert.Rule.Message,
+		State:     alert.State,
+		Value:     alert.Value,
+		At:        alert.At,
+	}
+
+	return postJSON(n.Client, n.URL, payload)
+}
+
+type webhookPayload struct {
+	Rule      string    `json:"rule"`
+	Metric    string    `json:"metric"`
+	Operator  string    `json:"operator"`
+	Threshold float64   `json:"threshold"`
+	Message   string    `json:"message"`
+	State     State     `json:"state"`
+	Value     float64   `json:"value"`
+	At        time.Time `json:"at"`
+}
+
+func postJSON(client *http.Client, url string, payload interface{}) error {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	response, err := client.Post(url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to post alert: %v", err)
+	}
+	defer response.Body.Close()
+	io.Copy(ioutil.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned unexpected status: %s", response.Status)
+	}
+	return nil
+}
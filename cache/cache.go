@@ -0,0 +1,148 @@
+// Package cache keeps computed responses in memory for a while, and serves
+// them with an ETag and Last-Modified so clients can make conditional
+// requests.
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Entry is a cached response body
+type Entry struct {
+	Body         []byte
+	ETag         string
+	LastModified time.Time
+}
+
+type cachedEntry struct {
+	Entry
+	expires time.Time
+}
+
+// Cache holds entries by key until they're older than the TTL or the cache is
+// invalidated
+type Cache struct {
+	ttl time.Duration
+	now func() time.Time
+
+	mutex      sync.Mutex
+	entries    map[string]cachedEntry
+	generation int
+	version    string
+}
+
+// New returns an empty cache whose entries live for ttl
+func New(ttl time.Duration) *Cache {
+	return &Cache{
+		ttl:     ttl,
+		now:     time.Now,
+		entries: make(map[string]cachedEntry),
+	}
+}
+
+// Get returns the entry for key, calling compute to make it if it's missing
+// or expired. If compute returns the same body as before, LastModified stays
+// the same.
+func (c *Cache) Get(key string, compute func() ([]byte, error)) (Entry, error) {
+	c.mutex.Lock()
+	existing, found := c.entries[key]
+	generation := c.generation
+	c.mutex.Unlock()
+
+	if found && c.now().Before(existing.expires) {
+		return existing.Entry, nil
+	}
+
+	body, err := compute()
+	if err != nil {
+		return Entry{}, err
+	}
+
+	now := c.now()
+	entry := Entry{Body: body, ETag: etag(body), LastModified: now.UTC().Truncate(time.Second)}
+	if found && existing.ETag == entry.ETag {
+		entry.LastModified = existing.LastModified
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// if the cache was invalidated while we were computing, what we have
+	// might already be stale, so don't keep it
+	if c.generation == generation {
+		c.entries[key] = cachedEntry{Entry: entry, expires: now.Add(c.ttl)}
+	}
+	return entry, nil
+}
+
+// Invalidate throws away every entry, for example when the underlying data
+// has changed
+func (c *Cache) Invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]cachedEntry)
+	c.generation++
+}
+
+// SetVersion invalidates the cache if version is different to the last one
+// set. It's for data that other processes can change, for example the time
+// the database was last written to.
+func (c *Cache) SetVersion(version string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if version == c.version {
+		return
+	}
+	c.version = version
+	c.entries = make(map[string]cachedEntry)
+	c.generation++
+}
+
+// Serve writes the entry as the response, or `304 Not Modified` if the
+// request's If-None-Match or If-Modified-Since shows the client already has it
+func Serve(w http.ResponseWriter, r *http.Request, entry Entry, contentType string) {
+	w.Header().Set("ETag", entry.ETag)
+	w.Header().Set("Last-Modified", entry.LastModified.Format(http.TimeFormat))
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if notModified(r, entry) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("content-type", contentType)
+	w.Write(entry.Body)
+}
+
+func notModified(r *http.Request, entry Entry) bool {
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		for _, tag := range strings.Split(ifNoneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == entry.ETag || tag == "*" {
+				return true
+			}
+		}
+		// If-None-Match takes precedence over If-Modified-Since
+		return false
+	}
+
+	if ifModifiedSince := r.Header.Get("If-Modified-Since"); ifModifiedSince != "" {
+		since, err := http.ParseTime(ifModifiedSince)
+		if err == nil && !entry.LastModified.After(since) {
+			return true
+		}
+	}
+	return false
+}
+
+func etag(body []byte) string {
+	hash := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`
+}
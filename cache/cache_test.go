@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGet(t *testing.T) {
+	now := time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)
+	c := New(time.Minute)
+	c.now = func() time.Time { return now }
+
+	computed := 0
+	body := "one"
+	compute := func() ([]byte, error) {
+		computed++
+		return []byte(body), nil
+	}
+
+	first, _ := c.Get("json", compute)
+	c.Get("json", compute)
+	if computed != 1 {
+		t.Errorf("expected second Get to be cached, computed %d times", computed)
+	}
+
+	t.Run("expires after ttl with same body", func(t *testing.T) {
+		now = now.Add(2 * time.Minute)
+		entry, _ := c.Get("json", compute)
+		if computed != 2 {
+			t.Errorf("expected expired entry to be recomputed")
+		}
+		if entry.ETag != first.ETag || !entry.LastModified.Equal(first.LastModified) {
+			t.Errorf("expected same body to keep ETag and LastModified")
+		}
+	})
+
+	t.Run("invalidate", func(t *testing.T) {
+		body = "two"
+		c.Invalidate()
+		entry, _ := c.Get("json", compute)
+		if computed != 3 {
+			t.Errorf("expected invalidated entry to be recomputed")
+		}
+		if entry.ETag == first.ETag || !entry.LastModified.After(first.LastModified) {
+			t.Errorf("expected new ETag and LastModified for new body")
+		}
+	})
+
+	t.Run("set version", func(t *testing.T) {
+		c.SetVersion("1")
+		c.Get("json", compute)
+		c.SetVersion("1")
+		c.Get("json", compute)
+		if computed != 4 {
+			t.Errorf("expected the same version to keep the entry, computed %d times", computed)
+		}
+
+		c.SetVersion("2")
+		c.Get("json", compute)
+		if computed != 5 {
+			t.Errorf("expected a new version to recompute the entry, computed %d times", computed)
+		}
+	})
+}
+
+func TestServe(t *testing.T) {
+	entry := Entry{
+		Body:         []byte(`{"count": 1}`),
+		ETag:         etag([]byte(`{"count": 1}`)),
+		LastModified: time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC),
+	}
+
+	tests := []struct {
+		name           string
+		header         string
+		value          string
+		expectedStatus int
+	}{
+		{"no conditions", "", "", http.StatusOK},
+		{"matching etag", "If-None-Match", entry.ETag, http.StatusNotModified},
+		{"weak matching etag", "If-None-Match", "W/" + entry.ETag, http.StatusNotModified},
+		{"other etag", "If-None-Match", `"abc"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", entry.LastModified.Format(http.TimeFormat), http.StatusNotModified},
+		{"modified since", "If-Modified-Since", entry.LastModified.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("GET", "/json", nil)
+			if test.header != "" {
+				request.Header.Set(test.header, test.value)
+			}
+			recorder := httptest.NewRecorder()
+
+			Serve(recorder, request, entry, "application/json")
+
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("expected %d, got %d", test.expectedStatus, recorder.Code)
+			}
+			if recorder.Header().Get("ETag") != entry.ETag {
+				t.Errorf("expected ETag header %s, got %s", entry.ETag, recorder.Header().Get("ETag"))
+			}
+			if test.expectedStatus == http.StatusOK && recorder.Body.String() != string(entry.Body) {
+				t.Errorf("expected body %s, got %s", entry.Body, recorder.Body.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/fakeapi"
+	"github.com/fluidkeys/dashboard/retry"
+
+	"google.golang.org/api/calendar/v3"
+)
+
+const signupsSheet = "signups-sheet"
+
+func TestGetReleaseNoteSignupTimes(t *testing.T) {
+	setEnv(t, "GOOGLE_SHEETS_RELEASE_SIGNUPS_ID", signupsSheet)
+
+	t.Run("parses the timestamp in column A", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+
+		fake.SetSheetValues(signupsSheet, "Recent signups!A2:B", [][]interface{}{
+			{"25/03/2019 14:02:19", "alice@example.com"},
+			{"01/04/2019 09:00:00", "bob@example.com"},
+		})
+
+		got, err := getReleaseNoteSignupTimes(context.Background(), fake.Client())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []time.Time{
+			time.Date(2019, 3, 25, 14, 2, 19, 0, time.UTC),
+			time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC),
+		}
+		assertTimesEqual(t, expected, got)
+	})
+
+	for _, test := range []struct {
+		name         string
+		values       [][]interface{}
+		failStatus   int
+		failReason   string
+		expectedKind errorKind
+	}{
+		{"empty sheet", [][]interface{}{}, 0, "", sourceError},
+		{"bad timestamp", [][]interface{}{{"2019-03-25", "alice@example.com"}}, 0, "", parseError},
+		{"non-string cell", [][]interface{}{{42.0, "alice@example.com"}}, 0, "", parseError},
+		{"forbidden", nil, http.StatusForbidden, "forbidden", authError},
+		{"unavailable", nil, http.StatusServiceUnavailable, "backendError", sourceError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakeapi.NewServer()
+			defer fake.Close()
+
+			fake.SetSheetValues(signupsSheet, "Recent signups!A2:B", test.values)
+			if test.failStatus != 0 {
+				fake.FailNext("/v4/spreadsheets/", test.failStatus, test.failReason)
+			}
+
+			_, err := getReleaseNoteSignupTimes(context.Background(), fake.Client())
+			assertErrorKind(t, err, test.expectedKind)
+		})
+	}
+
+	t.Run("missing spreadsheet ID is a config error", func(t *testing.T) {
+		os.Unsetenv("GOOGLE_SHEETS_RELEASE_SIGNUPS_ID")
+		defer os.Setenv("GOOGLE_SHEETS_RELEASE_SIGNUPS_ID", signupsSheet)
+
+		_, err := getReleaseNoteSignupTimes(context.Background(), http.DefaultClient)
+		if kind := kindOf(err); kind != configError {
+			t.Errorf("expected config error, got %v", err)
+		}
+	})
+
+	t.Run("retries rate limits", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+
+		fake.SetSheetValues(signupsSheet, "Recent signups!A2:B", [][]interface{}{
+			{"25/03/2019 14:02:19", "alice@example.com"},
+		})
+		fake.FailNext("/v4/spreadsheets/", http.StatusForbidden, "rateLimitExceeded")
+
+		transport := retry.NewTransport(fake.Transport(),
+			retry.Policy{MaxAttempts: 2, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+
+		got, err := getReleaseNoteSignupTimes(context.Background(), &http.Client{Transport: transport})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 1 || transport.Stats().Retries() != 1 {
+			t.Errorf("expected 1 signup after 1 retry, got %v after %s", got, transport.Stats())
+		}
+	})
+}
+
+func TestGetCallsArrangedFromCalendar(t *testing.T) {
+	call := func(id string, summary string, start string) *calendar.Event {
+		return &calendar.Event{Id: id, Summary: summary, Start: &calendar.EventDateTime{DateTime: start}}
+	}
+
+	t.Run("pages through every calendar", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+		fake.EventsPageSize = 2
+
+		fake.SetCalendarEvents("paul@fluidkeys.com", []*calendar.Event{
+			call("1", "Acme <> Fluidkeys", "2019-04-01T10:00:00Z"),
+			call("2", "Dentist", "2019-04-01T12:00:00Z"),
+			call("3", "Jane / Paul", "2019-04-02T15:30:00+01:00"),
+		})
+		fake.SetCalendarEvents("ian@fluidkeys.com", []*calendar.Event{
+			// the same call on both calendars is only counted once
+			call("1", "Acme <> Fluidkeys", "2019-04-01T10:00:00Z"),
+			call("4", "Bob / Ian", "2019-04-03T09:00:00Z"),
+		})
+
+		got, err := getCallsArrangedFromCalendar(context.Background(), fake.Client())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(got) != 3 {
+			t.Errorf("expected 3 calls, got %v", got)
+		}
+
+		pages := 0
+		for _, request := range fake.Requests() {
+			if request == "GET /calendar/v3/calendars/paul@fluidkeys.com/events" {
+				pages++
+			}
+		}
+		if pages != 2 {
+			t.Errorf("expected 2 pages for paul@fluidkeys.com, got %d: %v", pages, fake.Requests())
+		}
+	})
+
+	t.Run("bad event date is a parse error", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+
+		fake.SetCalendarEvents("paul@fluidkeys.com", []*calendar.Event{
+			call("1", "Acme <> Fluidkeys", "next tuesday"),
+		})
+
+		_, err := getCallsArrangedFromCalendar(context.Background(), fake.Client())
+		if kind := kindOf(err); kind != parseError {
+			t.Errorf("expected parse error, got %v", err)
+		}
+	})
+
+	t.Run("empty calendar is a source error", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+
+		fake.SetCalendarEvents("paul@fluidkeys.com", []*calendar.Event{})
+
+		_, err := getCallsArrangedFromCalendar(context.Background(), fake.Client())
+		if kind := kindOf(err); kind != sourceError {
+			t.Errorf("expected source error, got %v", err)
+		}
+	})
+
+	t.Run("unauthorized is an auth error", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+
+		fake.FailNext("/calendar/v3/calendars/", http.StatusUnauthorized, "authError")
+
+		_, err := getCallsArrangedFromCalendar(context.Background(), fake.Client())
+		if kind := kindOf(err); kind != authError {
+			t.Errorf("expected auth error, got %v", err)
+		}
+	})
+}
+
+func TestEventLooksLikeCall(t *testing.T) {
+	tests := []struct {
+		summary  string
+		dateTime string
+		expected bool
+	}{
+		{"Acme <> Fluidkeys", "2019-04-01T10:00:00Z", true},
+		{"Jane / Paul", "2019-04-01T10:00:00Z", true},
+		{"Bob / Ian", "2019-04-01T10:00:00Z", true},
+		{"Acme <> Fluidkeys", "", false}, // all day event
+		{"Dentist", "2019-04-01T10:00:00Z", false},
+		{"Paul / Ian", "2019-04-01T10:00:00Z", true},
+	}
+
+	for _, test := range tests {
+		event := &calendar.Event{
+			Summary: test.summary,
+			Start:   &calendar.EventDateTime{DateTime: test.dateTime},
+		}
+		if got := eventLooksLikeCall(event); got != test.expected {
+			t.Errorf("eventLooksLikeCall('%s', '%s'): expected %v, got %v",
+				test.summary, test.dateTime, test.expected, got)
+		}
+	}
+}
+
+func TestGetReleaseAnnouncements(t *testing.T) {
+	feed, err := ioutil.ReadFile("testdata/blog_feed.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("only counts release posts", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+		fake.SetFile("/blog/feed.xml", "application/rss+xml", string(feed))
+
+		got, err := getReleaseAnnouncements(context.Background(), fake.Client())
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		expected := []time.Time{
+			time.Date(2019, 3, 26, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, 2, 12, 0, 0, 0, 0, time.UTC),
+		}
+		assertEventTimes(t, expected, got)
+
+		if got[0].Labels["version"] != "0.2.6" || got[1].Labels["version"] != "0.2.5" {
+			t.Errorf("expected each release's version, got %+v", got)
+		}
+	})
+
+	t.Run("missing feed is a source error", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+
+		_, err := getReleaseAnnouncements(context.Background(), fake.Client())
+		if kind := kindOf(err); kind != sourceError {
+			t.Errorf("expected source error, got %v", err)
+		}
+	})
+
+	t.Run("invalid feed is a parse error", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+		fake.SetFile("/blog/feed.xml", "text/html", "<html>oops</html>")
+
+		_, err := getReleaseAnnouncements(context.Background(), fake.Client())
+		if kind := kindOf(err); kind != parseError {
+			t.Errorf("expected parse error, got %v", err)
+		}
+	})
+}
+
+func TestReleaseVersion(t *testing.T) {
+	for _, test := range []struct {
+		title    string
+		link     string
+		expected string
+	}{
+		{"Release 0.2.6: team invitations", "https://www.fluidkeys.com/blog/release-0-2-6/", "0.2.6"},
+		{"Fluidkeys v1.0 is here", "https://www.fluidkeys.com/blog/release-1-0/", "1.0"},
+		{"Team invitations", "https://www.fluidkeys.com/blog/release-0-3-0/", "0.3.0"},
+		{"A new release", "https://www.fluidkeys.com/blog/release-notes/", ""},
+	} {
+		if got := releaseVersion(test.title, test.link); got != test.expected {
+			t.Errorf("releaseVersion('%s', '%s'): expected '%s', got '%s'", test.title, test.link, test.expected, got)
+		}
+	}
+}
+
+func TestExitCodeFor(t *testing.T) {
+	source := sourceErrorf("sheet unavailable")
+	parse := parseErrorf("bad timestamp")
+	config := configErrorf("missing variable")
+
+	tests := []struct {
+		errs     []error
+		expected exitCode
+	}{
+		{nil, exitOK},
+		{[]error{source}, exitSourceError},
+		{[]error{source, parse}, exitParseError},
+		{[]error{parse, config, source}, exitConfigError},
+		{[]error{os.ErrNotExist}, exitOtherError},
+	}
+
+	for _, test := range tests {
+		if got := exitCodeFor(test.errs); got != test.expected {
+			t.Errorf("exitCodeFor(%v): expected %d, got %d", test.errs, test.expected, got)
+		}
+	}
+}
+
+func TestRunCollectorRecoversPanics(t *testing.T) {
+	panicky := collector{
+		name: "panicky",
+		sync: func(ctx context.Context, clients apiClients, store collectorStore) error {
+			panic("oh no")
+		},
+	}
+
+	err := runCollector(context.Background(), panicky, apiClients{}, &dryRunStore{}, time.Second)
+	if err == nil || kindOf(err) != otherError {
+		t.Errorf("expected the panic to be returned as an error, got %v", err)
+	}
+}
+
+func TestGoogleCollectorsWithoutCredentials(t *testing.T) {
+	setEnv(t, "GOOGLE_API_CREDENTIALS_JSON", "")
+	os.Unsetenv("GOOGLE_API_CREDENTIALS_JSON")
+	setEnv(t, "FUNNEL_HASH_SALT", "salt")
+
+	clients := apiClients{newGoogle: func() (*http.Client, error) {
+		return getOauthClient(context.Background())
+	}}
+
+	for _, c := range []collector{
+		{"calls arranged", syncCallsArrangedFromCalendar},
+		{"funnel", syncFunnelEvents},
+	} {
+		if err := c.sync(context.Background(), clients, newMemoryStore()); kindOf(err) != configError {
+			t.Errorf("%s: expected a config error, got %v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+const (
+	comparePreviousPeriod = "previous_period"
+	comparePreviousYear   = "previous_year"
+)
+
+// jsonComparison compares the series in the JSON index with an earlier period
+// of the same length
+type jsonComparison struct {
+	Compare               string             `json:"compare"`
+	From                  datastore.JSONDate `json:"from"`
+	To                    datastore.JSONDate `json:"to"`
+	ReleaseNotesSignups   seriesComparison   `json:"releaseNotesSignups"`
+	ReleaseNotesNetGrowth seriesComparison   `json:"releaseNotesNetGrowth"`
+	TrialsStarted         seriesComparison   `json:"trialsStarted"`
+}
+
+// seriesComparison is the earlier series plus how its total compares with the
+// current one
+type seriesComparison struct {
+	Series        []datastore.DateCount `json:"series"`
+	Total         int                   `json:"total"`
+	PreviousTotal int                   `json:"previousTotal"`
+	Delta         int                   `json:"delta"`
+
+	// DeltaPercent is null if the previous total was zero
+	DeltaPercent *float64 `json:"deltaPercent"`
+}
+
+// getComparison returns the comparison for the given `compare` parameter
+// (previous_period or previous_year) against the current 30 day series
+func getComparison(compare string, releaseNotesSignups []datastore.DateCount,
+	releaseNotesNetGrowth []datastore.DateCount, trialsStarted []datastore.DateCount) (*jsonComparison, error) {
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	from, to, err := comparisonPeriod(compare, today.AddDate(0, 0, -29), today)
+	if err != nil {
+		return nil, err
+	}
+
+	comparison := jsonComparison{
+		Compare: compare,
+		From:    datastore.JSONDate(from),
+		To:      datastore.JSONDate(to),
+	}
+
+	previousSignups, err := datastore.Series("signups", datastore.Dates(from, to), datastore.Day, nil)
+	if err != nil {
+		return nil, err
+	}
+	comparison.ReleaseNotesSignups = compareSeries(releaseNotesSignups, previousSignups)
+
+	previousUnsubscribes, err := datastore.Series("unsubscribes", datastore.Dates(from, to), datastore.Day, nil)
+	if err != nil {
+		return nil, err
+	}
+	previousNetGrowth, err := netGrowth(previousSignups, previousUnsubscribes)
+	if err != nil {
+		return nil, err
+	}
+	comparison.ReleaseNotesNetGrowth = compareSeries(releaseNotesNetGrowth, previousNetGrowth)
+
+	previousTrials, err := datastore.Series("trials", datastore.Dates(from, to), datastore.Day, nil)
+	if err != nil {
+		return nil, err
+	}
+	comparison.TrialsStarted = compareSeries(trialsStarted, previousTrials)
+
+	return &comparison, nil
+}
+
+// comparisonPeriod returns the dates to compare the period `from`..`to`
+// (inclusive) with: either the same number of days immediately before, or the
+// same number of days ending on the same date a year earlier. (A year earlier
+// than 29 February is 1 March.)
+func comparisonPeriod(compare string, from time.Time, to time.Time) (time.Time, time.Time, error) {
+	days := int(to.Sub(from).Hours()/24) + 1
+
+	switch compare {
+	case comparePreviousPeriod:
+		return from.AddDate(0, 0, -days), from.AddDate(0, 0, -1), nil
+
+	case comparePreviousYear:
+		previousTo := to.AddDate(-1, 0, 0)
+		return previousTo.AddDate(0, 0, 1-days), previousTo, nil
+
+	default:
+		return time.Time{}, time.Time{}, fmt.Errorf(
+			"invalid compare '%s', expected %s or %s", compare, comparePreviousPeriod, comparePreviousYear)
+	}
+}
+
+func compareSeries(current []datastore.DateCount, previous []datastore.DateCount) seriesComparison {
+	comparison := seriesComparison{
+		Series:        previous,
+		Total:         sumDateCounts(current),
+		PreviousTotal: sumDateCounts(previous),
+	}
+	comparison.Delta = comparison.Total - comparison.PreviousTotal
+
+	// net growth can be negative, and going from -2 to -1 is still up
+	if comparison.PreviousTotal != 0 {
+		percent := 100 * float64(comparison.Delta) / math.Abs(float64(comparison.PreviousTotal))
+		comparison.DeltaPercent = &percent
+	}
+	return comparison
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+func TestComparisonPeriod(t *testing.T) {
+	date := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		name         string
+		compare      string
+		from         time.Time
+		to           time.Time
+		expectedFrom time.Time
+		expectedTo   time.Time
+	}{
+		{"previous period", comparePreviousPeriod, date(2019, 4, 1), date(2019, 4, 30),
+			date(2019, 3, 2), date(2019, 3, 31)},
+		{"previous period across a new year", comparePreviousPeriod, date(2019, 1, 1), date(2019, 1, 30),
+			date(2018, 12, 2), date(2018, 12, 31)},
+		{"previous year", comparePreviousYear, date(2019, 4, 1), date(2019, 4, 30),
+			date(2018, 4, 1), date(2018, 4, 30)},
+		// February 2020 has 29 days, so the window still has 30 days a year
+		// earlier
+		{"previous year across 29 February", comparePreviousYear, date(2020, 2, 1), date(2020, 3, 1),
+			date(2019, 1, 31), date(2019, 3, 1)},
+		{"previous year ending on 29 February", comparePreviousYear, date(2020, 1, 31), date(2020, 2, 29),
+			date(2019, 1, 31), date(2019, 3, 1)},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			from, to, err := comparisonPeriod(test.compare, test.from, test.to)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !from.Equal(test.expectedFrom) || !to.Equal(test.expectedTo) {
+				t.Errorf("expected %s to %s, got %s to %s", test.expectedFrom.Format("2006-01-02"),
+					test.expectedTo.Format("2006-01-02"), from.Format("2006-01-02"), to.Format("2006-01-02"))
+			}
+			if days, previousDays := test.to.Sub(test.from), to.Sub(from); days != previousDays {
+				t.Errorf("expected the same length as the period, got %s and %s", days, previousDays)
+			}
+		})
+	}
+
+	t.Run("invalid compare", func(t *testing.T) {
+		if _, _, err := comparisonPeriod("last_week", date(2019, 4, 1), date(2019, 4, 30)); err == nil {
+			t.Errorf("expected an error")
+		}
+	})
+}
+
+func TestCompareSeries(t *testing.T) {
+	counts := func(counts ...int) []datastore.DateCount {
+		series := []datastore.DateCount{}
+		for i, count := range counts {
+			series = append(series, datastore.DateCount{
+				Date: datastore.JSONDate(time.Date(2019, 4, i+1, 0, 0, 0, 0, time.UTC)), Count: count,
+			})
+		}
+		return series
+	}
+
+	t.Run("with a previous total", func(t *testing.T) {
+		comparison := compareSeries(counts(2, 3), counts(1, 1))
+
+		if comparison.Total != 5 || comparison.PreviousTotal != 2 || comparison.Delta != 3 ||
+			len(comparison.Series) != 2 {
+			t.Errorf("expected 5 compared with 2, got %+v", comparison)
+		}
+		if comparison.DeltaPercent == nil || *comparison.DeltaPercent != 150 {
+			t.Errorf("expected +150%%, got %v", comparison.DeltaPercent)
+		}
+	})
+
+	t.Run("negative previous total", func(t *testing.T) {
+		comparison := compareSeries(counts(-1, 0), counts(-1, -1))
+
+		if comparison.DeltaPercent == nil || *comparison.DeltaPercent != 50 {
+			t.Errorf("expected +50%%, got %v", comparison.DeltaPercent)
+		}
+	})
+
+	t.Run("previous total of zero", func(t *testing.T) {
+		comparison := compareSeries(counts(2, 3), counts(0, 0))
+
+		if comparison.Total != 5 || comparison.PreviousTotal != 0 || comparison.Delta != 5 {
+			t.Errorf("expected 5 compared with 0, got %+v", comparison)
+		}
+		if comparison.DeltaPercent != nil {
+			t.Errorf("expected no percentage, got %v", *comparison.DeltaPercent)
+		}
+	})
+}
+
+func TestGetComparison(t *testing.T) {
+	initializeTestDatabase(t)
+
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 12, 0, 0, 0, time.UTC)
+	previousPeriod := today.AddDate(0, 0, -31)
+
+	if err := datastore.SetMetricTimes("signups", []time.Time{previousPeriod, previousPeriod, previousPeriod}); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.SetMetricTimes("unsubscribes", []time.Time{previousPeriod}); err != nil {
+		t.Fatal(err)
+	}
+
+	metrics, err := getJSONIndex(comparePreviousPeriod)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	comparison := metrics.Comparison
+	if comparison.ReleaseNotesSignups.PreviousTotal != 3 {
+		t.Errorf("expected 3 signups in the previous period, got %+v", comparison.ReleaseNotesSignups)
+	}
+
+	// the chart's bars are net growth, so that's what they're compared with
+	growth := comparison.ReleaseNotesNetGrowth
+	if growth.PreviousTotal != 2 || growth.Total != 0 || len(growth.Series) != len(metrics.ReleaseNotesNetGrowth) {
+		t.Errorf("expected net growth of 2 in the previous period, got %+v", growth)
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/dashboards"
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+// loadDashboards returns the dashboards defined in DASHBOARDS_JSON, or the
+// default ones if it's not set, checking every panel's metric exists
+func loadDashboards() (map[string]dashboards.Dashboard, error) {
+	configured := dashboards.Defaults
+
+	if dashboardsJSON, got := os.LookupEnv("DASHBOARDS_JSON"); got {
+		var err error
+		configured, err = dashboards.Parse([]byte(dashboardsJSON))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for name, dashboard := range configured {
+		for i, panel := range dashboard.Panels {
+			switch {
+			case datastore.IsMetric(panel.Metric):
+			case isSnapshotMetric(panel.Metric) && panel.Type == dashboards.Line:
+			case isScalarMetric(panel.Metric):
+				if panel.Type != dashboards.Number {
+					return nil, fmt.Errorf("dashboard '%s' panel %d: metric '%s' can only be shown as a number",
+						name, i+1, panel.Metric)
+				}
+			default:
+				return nil, fmt.Errorf("dashboard '%s' panel %d has unknown metric '%s'",
+					name, i+1, panel.Metric)
+			}
+
+			if len(panel.Labels) > 0 && !datastore.IsMetric(panel.Metric) && !readsSnapshots(panel) {
+				return nil, fmt.Errorf("dashboard '%s' panel %d: metric '%s' has no labels",
+					name, i+1, panel.Metric)
+			}
+		}
+	}
+	return configured, nil
+}
+
+// panelData is what a panel shows: a series of daily counts (or daily
+// snapshots) for a chart, or a single value for a number. Error is why the
+// panel's data couldn't be got, if it couldn't.
+type panelData struct {
+	dashboards.Panel
+
+	Series []datastore.DateCount `json:"series,omitempty"`
+	Value  float64               `json:"value"`
+	Status rag.Status            `json:"status,omitempty"`
+	Error  string                `json:"error,omitempty"`
+}
+
+// getDashboardData gets the data for every panel on the dashboard. A panel
+// whose data can't be got has an Error rather than stopping the others.
+func getDashboardData(dashboard dashboards.Dashboard) []panelData {
+	now := time.Now()
+	panels := []panelData{}
+
+	for _, panel := range dashboard.Panels {
+		data := panelData{Panel: panel}
+
+		if err := getPanelData(&data, now); err != nil {
+			data.Error = err.Error()
+		} else if panel.Thresholds != nil {
+			data.Status = panel.Thresholds.Status(data.Value)
+		}
+		panels = append(panels, data)
+	}
+	return panels
+}
+
+// getPanelData fills in the series and value of data's panel
+func getPanelData(data *panelData, now time.Time) error {
+	panel := data.Panel
+
+	if datastore.IsMetric(panel.Metric) {
+		bucket := datastore.Day
+		if panel.Bucket != "" {
+			bucket = datastore.Bucket(panel.Bucket)
+		}
+		series, err := datastore.Series(panel.Metric, datastore.LastNDays(panel.Window(), now), bucket,
+			datastore.Filters(panel.Labels))
+		if err != nil {
+			return err
+		}
+		data.Series = series
+		data.Value = float64(sumDateCounts(series))
+	} else if readsSnapshots(panel) {
+		snapshots, err := datastore.MetricSnapshots(panel.Metric, panel.Labels, panel.Window())
+		if err != nil {
+			return err
+		}
+		data.Series = snapshotSeries(snapshots)
+		if len(snapshots) > 0 {
+			data.Value = snapshots[len(snapshots)-1].Value
+		}
+	} else {
+		value, err := getMetricValue(panel.Metric, now)
+		if err != nil {
+			return err
+		}
+		data.Value = value
+	}
+	return nil
+}
+
+// readsSnapshots is true if the panel shows a snapshot metric's history, or
+// the latest snapshot of one recorded by a collector, since those have no
+// current value besides the latest snapshot. They can be labelled, e.g. the
+// stars of one GitHub repository.
+func readsSnapshots(panel dashboards.Panel) bool {
+	return isSnapshotMetric(panel.Metric) && (panel.Type == dashboards.Line || !isScalarMetric(panel.Metric))
+}
+
+// snapshotSeries charts snapshots like a series of daily counts, rounding
+// each value
+func snapshotSeries(snapshots []datastore.Snapshot) []datastore.DateCount {
+	series := []datastore.DateCount{}
+	for _, snapshot := range snapshots {
+		series = append(series, datastore.DateCount{Date: snapshot.Date, Count: int(math.Round(snapshot.Value))})
+	}
+	return series
+}
+
+// handleDashboards serves the dashboards:
+//
+// /d/{name}                      the dashboard page
+// /api/dashboards/{name}         the dashboard's definition as JSON
+// /api/dashboards/{name}/data    the data for each of its panels as JSON
+func handleDashboards(configured map[string]dashboards.Dashboard, assets *staticAssets) http.HandlerFunc {
+	dashboardTemplate := template.Must(template.New("dashboard.html").Funcs(template.FuncMap{
+		"asset": assets.Path,
+	}).ParseFS(embeddedTemplates, "templates/dashboard.html"))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		var name string
+		var dataOnly, page bool
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/d/"):
+			name = strings.TrimPrefix(r.URL.Path, "/d/")
+			page = true
+		case strings.HasSuffix(r.URL.Path, "/data"):
+			name = strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/dashboards/"), "/data")
+			dataOnly = true
+		default:
+			name = strings.TrimPrefix(r.URL.Path, "/api/dashboards/")
+		}
+
+		dashboard, ok := configured[name]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+
+		if !page && !dataOnly {
+			w.Header().Set("content-type", "application/json")
+			writeJSON(w, dashboard)
+			return
+		}
+
+		panels := getDashboardData(dashboard)
+
+		if dataOnly {
+			w.Header().Set("content-type", "application/json")
+			writeJSON(w, panels)
+			return
+		}
+
+		var out bytes.Buffer
+		err := dashboardTemplate.Execute(&out, struct {
+			Dashboard dashboards.Dashboard
+			Panels    []panelData
+		}{dashboard, panels})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		w.Write(out.Bytes())
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/dashboards"
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+func TestGetDashboardData(t *testing.T) {
+	initializeTestDatabase(t)
+
+	repository := map[string]string{"repository": "fluidkeys/fluidkeys"}
+	if err := datastore.SetMetricSnapshot(githubStarsSnapshotMetric, 123, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.SetLabelledMetricSnapshot(githubStarsSnapshotMetric, repository, 120, time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	panels := getDashboardData(dashboards.Dashboard{
+		Name: "test",
+		Panels: []dashboards.Panel{
+			{Title: "Release", Metric: "daysSinceLastRelease", Type: dashboards.Number,
+				Thresholds: &dashboards.Thresholds{Red: 49, Amber: 42, LowerIsBetter: true}},
+			{Title: "Calls", Metric: "callsArrangedNext7Days", Type: dashboards.Number,
+				Thresholds: &dashboards.Thresholds{Red: 3, Amber: 4}},
+			{Title: "Signups", Metric: "signups", Type: dashboards.Bar},
+			{Title: "Stars", Metric: githubStarsSnapshotMetric, Type: dashboards.Number},
+			{Title: "Stars of fluidkeys", Metric: githubStarsSnapshotMetric, Type: dashboards.Number,
+				Labels: repository},
+		},
+	})
+
+	if len(panels) != 5 {
+		t.Fatalf("expected 5 panels, got %+v", panels)
+	}
+
+	// nothing's been released, which doesn't stop the other panels
+	if panels[0].Error == "" || panels[0].Status != "" {
+		t.Errorf("expected the release panel to have an error and no status, got %+v", panels[0])
+	}
+	if panels[1].Error != "" || panels[1].Value != 0 || panels[1].Status != rag.Red {
+		t.Errorf("expected no calls, which is red, got %+v", panels[1])
+	}
+	if panels[2].Error != "" || len(panels[2].Series) != dashboards.DefaultWindowDays {
+		t.Errorf("expected %d days of signups, got %+v", dashboards.DefaultWindowDays, panels[2])
+	}
+	if panels[3].Error != "" || panels[3].Value != 123 {
+		t.Errorf("expected the total stars, got %+v", panels[3])
+	}
+	if panels[4].Error != "" || panels[4].Value != 120 {
+		t.Errorf("expected the stars of the labelled repository, got %+v", panels[4])
+	}
+}
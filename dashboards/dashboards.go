@@ -0,0 +1,249 @@
+// Package dashboards defines dashboard layouts: which panels to show, which
+// metric each one shows, how to draw it and when to colour it red, amber or
+// green.
+package dashboards
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+// Dashboard is a named screen made of panels
+type Dashboard struct {
+	Name   string  `json:"name"`
+	Title  string  `json:"title"`
+	Panels []Panel `json:"panels"`
+}
+
+// Panel shows a single metric
+type Panel struct {
+	Title  string    `json:"title"`
+	Metric string    `json:"metric"`
+	Type   PanelType `json:"type"`
+
+	// WindowDays is how many days of data to show (or to total, for a
+	// number panel showing a series metric). Defaults to 30.
+	WindowDays int `json:"windowDays,omitempty"`
+
+	// Bucket groups a chart of a series metric by "day" (the default),
+	// "week" or "month"
+	Bucket string `json:"bucket,omitempty"`
+
+	// Labels only counts the events of a series metric with all of these
+	// labels, e.g. {"path": "*"} for the traffic to every path. For a
+	// snapshot metric they choose the snapshots with exactly these labels,
+	// e.g. {"repository": "fluidkeys/fluidkeys"} for one repository's stars.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	Thresholds *Thresholds `json:"thresholds,omitempty"`
+}
+
+// PanelType is how a panel is drawn
+type PanelType string
+
+const (
+	// Bar is a bar chart of daily counts
+	Bar PanelType = "bar"
+
+	// Line is a line chart of daily counts, or of a scalar metric's daily
+	// snapshots
+	Line PanelType = "line"
+
+	// Number is a single big number
+	Number PanelType = "number"
+)
+
+// DefaultWindowDays is used for panels with no WindowDays
+const DefaultWindowDays = 30
+
+// Thresholds decide a panel's red/amber/green status from its value
+type Thresholds struct {
+	Red   float64 `json:"red"`
+	Amber float64 `json:"amber"`
+
+	// LowerIsBetter means values above the thresholds are bad, for example
+	// days since the last release. Otherwise values below them are bad.
+	LowerIsBetter bool `json:"lowerIsBetter,omitempty"`
+}
+
+// Status returns the red/amber/green status for the given value
+func (t Thresholds) Status(value float64) rag.Status {
+	if t.LowerIsBetter {
+		switch {
+		case value > t.Red:
+			return rag.Red
+		case value > t.Amber:
+			return rag.Amber
+		default:
+			return rag.Green
+		}
+	}
+
+	switch {
+	case value < t.Red:
+		return rag.Red
+	case value < t.Amber:
+		return rag.Amber
+	default:
+		return rag.Green
+	}
+}
+
+// Window returns the number of days of data the panel shows
+func (p Panel) Window() int {
+	if p.WindowDays == 0 {
+		return DefaultWindowDays
+	}
+	return p.WindowDays
+}
+
+var validName = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// Parse parses a JSON array of dashboards, keyed by name
+func Parse(dashboardsJSON []byte) (map[string]Dashboard, error) {
+	dashboards := []Dashboard{}
+	if err := json.Unmarshal(dashboardsJSON, &dashboards); err != nil {
+		return nil, fmt.Errorf("failed to parse dashboards: %v", err)
+	}
+
+	byName := make(map[string]Dashboard)
+	for _, dashboard := range dashboards {
+		if err := dashboard.validate(); err != nil {
+			return nil, err
+		}
+		if _, exists := byName[dashboard.Name]; exists {
+			return nil, fmt.Errorf("duplicate dashboard name '%s'", dashboard.Name)
+		}
+		byName[dashboard.Name] = dashboard
+	}
+	return byName, nil
+}
+
+func (d Dashboard) validate() error {
+	if !validName.MatchString(d.Name) {
+		return fmt.Errorf("invalid dashboard name '%s', expected e.g. 'sales'", d.Name)
+	}
+
+	for i, panel := range d.Panels {
+		if panel.Metric == "" {
+			return fmt.Errorf("dashboard '%s' panel %d has no metric", d.Name, i+1)
+		}
+
+		switch panel.Type {
+		case Bar, Line, Number:
+		default:
+			return fmt.Errorf("dashboard '%s' panel %d has invalid type '%s', expected bar, line or number",
+				d.Name, i+1, panel.Type)
+		}
+
+		if panel.WindowDays < 0 || panel.WindowDays > 366 {
+			return fmt.Errorf("dashboard '%s' panel %d has invalid windowDays %d",
+				d.Name, i+1, panel.WindowDays)
+		}
+
+		switch panel.Bucket {
+		case "", "day", "week", "month":
+		default:
+			return fmt.Errorf("dashboard '%s' panel %d has invalid bucket '%s', expected day, week or month",
+				d.Name, i+1, panel.Bucket)
+		}
+	}
+	return nil
+}
+
+// callsArrangedThresholds agree with rag.CallsArranged
+var callsArrangedThresholds = Thresholds{
+	Red:   rag.CallsArrangedRed,
+	Amber: rag.CallsArrangedAmber,
+}
+
+// releaseDueThresholds agree with rag.ReleaseDue
+var releaseDueThresholds = Thresholds{
+	Red:           rag.ReleaseIntervalDays + rag.ReleaseGraceDays,
+	Amber:         rag.ReleaseIntervalDays,
+	LowerIsBetter: true,
+}
+
+// allPaths is the label of the traffic totals across every path, which count
+// a page view matching more than one path once
+var allPaths = map[string]string{"path": "*"}
+
+// Defaults are used when no dashboards are configured
+var Defaults = map[string]Dashboard{
+	"main": {
+		Name:  "main",
+		Title: "Fluidkeys Dashboard",
+		Panels: []Panel{
+			{Title: "Release note signups", Metric: "signups", Type: Bar},
+			{Title: "Trials started", Metric: "trials", Type: Bar},
+			{
+				Title: "Calls arranged in next 7 days", Metric: "callsArrangedNext7Days", Type: Number,
+				Thresholds: &callsArrangedThresholds,
+			},
+			{
+				Title: "Days since last release", Metric: "daysSinceLastRelease", Type: Number,
+				Thresholds: &releaseDueThresholds,
+			},
+		},
+	},
+	"sales": {
+		Name:  "sales",
+		Title: "Sales",
+		Panels: []Panel{
+			{
+				Title: "Calls arranged in next 7 days", Metric: "callsArrangedNext7Days", Type: Number,
+				Thresholds: &callsArrangedThresholds,
+			},
+			{Title: "Calls", Metric: "calls", Type: Bar, WindowDays: 14},
+			{Title: "Trials started", Metric: "trials", Type: Line, WindowDays: 90},
+		},
+	},
+	"product": {
+		Name:  "product",
+		Title: "Product",
+		Panels: []Panel{
+			{
+				Title: "Days since last release", Metric: "daysSinceLastRelease", Type: Number,
+				Thresholds: &releaseDueThresholds,
+			},
+			{Title: "Release note signups", Metric: "signups", Type: Line, WindowDays: 90},
+			{Title: "Release note unsubscribes", Metric: "unsubscribes", Type: Bar},
+			{Title: "Downloads", Metric: "downloads", Type: Bar},
+		},
+	},
+	"teams": {
+		Name:  "teams",
+		Title: "Teams",
+		Panels: []Panel{
+			{Title: "Active teams", Metric: "activeTeams", Type: Number},
+			{Title: "Active teams over time", Metric: "activeTeams", Type: Line, WindowDays: 90},
+			{Title: "Team members", Metric: "teamMembers", Type: Line, WindowDays: 90},
+			{Title: "Trials started", Metric: "trials", Type: Bar},
+		},
+	},
+	"traffic": {
+		Name:  "traffic",
+		Title: "Website traffic",
+		Panels: []Panel{
+			{Title: "Page views", Metric: "pageViews", Type: Line, WindowDays: 90, Labels: allPaths},
+			{Title: "Unique visitors", Metric: "uniqueVisitors", Type: Line, WindowDays: 90, Labels: allPaths},
+			{Title: "Release note signups", Metric: "signups", Type: Line, WindowDays: 90},
+			{Title: "Referrals", Metric: "referrals", Type: Bar, Labels: allPaths},
+		},
+	},
+	"github": {
+		Name:  "github",
+		Title: "GitHub",
+		Panels: []Panel{
+			{Title: "Pull requests merged per week", Metric: "pullRequestsMerged", Type: Bar, WindowDays: 91,
+				Bucket: "week"},
+			{Title: "Stars", Metric: "githubStars", Type: Line, WindowDays: 90},
+			{Title: "Open issues", Metric: "githubOpenIssues", Type: Number},
+			{Title: "Open pull requests", Metric: "githubOpenPullRequests", Type: Number},
+			{Title: "Contributors", Metric: "githubContributors", Type: Number},
+		},
+	},
+}
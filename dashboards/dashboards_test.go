@@ -0,0 +1,86 @@
+package dashboards
+
+import (
+	"testing"
+
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+func TestParse(t *testing.T) {
+	parsed, err := Parse([]byte(`[{
+		"name": "ops",
+		"title": "Ops",
+		"panels": [
+			{"title": "Releases", "metric": "releases", "type": "bar", "windowDays": 90},
+			{"title": "Calls", "metric": "callsArrangedNext7Days", "type": "number",
+			 "thresholds": {"red": 3, "amber": 4}},
+			{"title": "Downloads", "metric": "pageViews", "type": "line", "labels": {"path": "/download"}}
+		]
+	}]`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ops, ok := parsed["ops"]
+	if !ok || len(ops.Panels) != 3 {
+		t.Fatalf("expected ops dashboard with 3 panels, got %+v", parsed)
+	}
+	if ops.Panels[0].Window() != 90 || ops.Panels[1].Window() != DefaultWindowDays {
+		t.Errorf("unexpected windows: %d, %d", ops.Panels[0].Window(), ops.Panels[1].Window())
+	}
+	if ops.Panels[1].Thresholds == nil || ops.Panels[1].Thresholds.Amber != 4 {
+		t.Errorf("expected thresholds, got %+v", ops.Panels[1].Thresholds)
+	}
+	if ops.Panels[2].Labels["path"] != "/download" {
+		t.Errorf("expected labels, got %+v", ops.Panels[2].Labels)
+	}
+
+	for name, invalid := range map[string]string{
+		"bad name":   `[{"name": "Ops!", "panels": []}]`,
+		"duplicate":  `[{"name": "ops", "panels": []}, {"name": "ops", "panels": []}]`,
+		"no metric":  `[{"name": "ops", "panels": [{"type": "bar"}]}]`,
+		"bad type":   `[{"name": "ops", "panels": [{"metric": "signups", "type": "pie"}]}]`,
+		"bad window": `[{"name": "ops", "panels": [{"metric": "signups", "type": "bar", "windowDays": -1}]}]`,
+		"bad bucket": `[{"name": "ops", "panels": [{"metric": "signups", "type": "bar", "bucket": "hour"}]}]`,
+	} {
+		if _, err := Parse([]byte(invalid)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestThresholdsStatus(t *testing.T) {
+	higherIsBetter := Thresholds{Red: 3, Amber: 4}
+	lowerIsBetter := Thresholds{Red: 49, Amber: 42, LowerIsBetter: true}
+
+	tests := []struct {
+		thresholds Thresholds
+		value      float64
+		expected   rag.Status
+	}{
+		{higherIsBetter, 2, rag.Red},
+		{higherIsBetter, 3, rag.Amber},
+		{higherIsBetter, 4, rag.Green},
+		{lowerIsBetter, 50, rag.Red},
+		{lowerIsBetter, 43, rag.Amber},
+		{lowerIsBetter, 42, rag.Green},
+	}
+
+	for _, test := range tests {
+		if got := test.thresholds.Status(test.value); got != test.expected {
+			t.Errorf("%+v.Status(%v): expected %s, got %s", test.thresholds, test.value, test.expected, got)
+		}
+	}
+
+	for days := uint(0); days < 60; days++ {
+		if got, expected := releaseDueThresholds.Status(float64(days)), rag.ReleaseDue(days); got != expected {
+			t.Errorf("%d days since the last release: expected %s like rag.ReleaseDue, got %s", days, expected, got)
+		}
+	}
+
+	for calls := uint(0); calls < 10; calls++ {
+		if got, expected := callsArrangedThresholds.Status(float64(calls)), rag.CallsArranged(calls); got != expected {
+			t.Errorf("%d calls arranged: expected %s like rag.CallsArranged, got %s", calls, expected, got)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package datastore
+
+import (
+	"database/sql"
+	"time"
+)
+
+// AlertState returns the last recorded state ("firing" or "resolved") of the
+// named alert rule, or an empty string if it's never been recorded
+func AlertState(ruleName string) (string, error) {
+	query := `SELECT state FROM alert_states WHERE rule_name = $1`
+
+	var state string
+	err := db.QueryRow(query, ruleName).Scan(&state)
+	if err == sql.ErrNoRows {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return state, nil
+}
+
+// SetAlertState records the state of the named alert rule and the value that
+// caused it
+func SetAlertState(ruleName string, state string, value float64, changedAt time.Time) error {
+	query := `INSERT INTO alert_states(rule_name, state, value, changed_at)
+	          VALUES($1, $2, $3, $4)
+		  ON CONFLICT (rule_name) DO UPDATE
+		  SET state = EXCLUDED.state,
+		      value = EXCLUDED.value,
+		      changed_at = EXCLUDED.changed_at`
+
+	_, err := db.Exec(query, ruleName, state, value, formatTimestamp(changedAt))
+	return err
+}
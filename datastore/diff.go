@@ -0,0 +1,226 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fluidkeys/dashboard/funnel"
+)
+
+// EventsDiff describes how replacing a metric's events with a new set of
+// events would change it
+type EventsDiff struct {
+	Metric string
+
+	Before  int
+	After   int
+	Added   int
+	Removed int
+
+	// the oldest and newest times before and after. They're zero if there
+	// were no rows.
+	OldestBefore time.Time
+	NewestBefore time.Time
+	OldestAfter  time.Time
+	NewestAfter  time.Time
+}
+
+// DiffMetricEvents compares the given events with the collector's events
+// currently stored for the metric, without changing anything. Imported events
+// aren't included since collectors don't replace them.
+func DiffMetricEvents(metric string, events []Event) (*EventsDiff, error) {
+	if !collectedMetrics[metric] {
+		return nil, fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	existing, err := queryEvents(db, `SELECT occurred_at, value, source_id, labels FROM metric_events
+	                                  WHERE metric = $1 AND source = $2`, metric, sourceCollector)
+	if err != nil {
+		return nil, err
+	}
+
+	diff, err := diffEvents(existing, events)
+	if err != nil {
+		return nil, err
+	}
+	diff.Metric = metric
+	return &diff, nil
+}
+
+// diffEvents compares two lists of events as they'd be stored: by time, which
+// is to the second, ignoring time zone, by value, to the penny, and by
+// labels. An event whose value or labels change counts as one removed and
+// one added. Repeated events are counted separately.
+func diffEvents(before []Event, after []Event) (EventsDiff, error) {
+	diff := EventsDiff{Before: len(before), After: len(after)}
+	diff.OldestBefore, diff.NewestBefore = eventRange(before)
+	diff.OldestAfter, diff.NewestAfter = eventRange(after)
+
+	remaining := make(map[string]int)
+	for _, event := range before {
+		key, err := eventKey(event)
+		if err != nil {
+			return diff, err
+		}
+		remaining[key]++
+	}
+
+	for _, event := range after {
+		key, err := eventKey(event)
+		if err != nil {
+			return diff, err
+		}
+		if remaining[key] > 0 {
+			remaining[key]--
+		} else {
+			diff.Added++
+		}
+	}
+
+	for _, count := range remaining {
+		diff.Removed += count
+	}
+	return diff, nil
+}
+
+// eventKey is the same for events that would be stored the same way
+func eventKey(event Event) (string, error) {
+	value := "null"
+	if event.Value != nil {
+		value = fmt.Sprintf("%.2f", *event.Value)
+	}
+
+	labels, err := labelsJSON(event.Labels)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s %s %s", formatTimestamp(event.OccurredAt), value, labels), nil
+}
+
+func eventRange(events []Event) (oldest time.Time, newest time.Time) {
+	for i, event := range events {
+		if i == 0 || event.OccurredAt.Before(oldest) {
+			oldest = event.OccurredAt
+		}
+		if i == 0 || event.OccurredAt.After(newest) {
+			newest = event.OccurredAt
+		}
+	}
+	return oldest, newest
+}
+
+// FunnelDiff describes how recording funnel events would change the
+// funnel_events table
+type FunnelDiff struct {
+	Events int
+
+	// New is the number of events for a contact and stage with no event yet
+	New int
+
+	// Earlier is the number of events that would replace an existing event
+	// for the same contact and stage because they happened before it
+	Earlier int
+}
+
+// DiffFunnelEvents compares the given events with those currently stored,
+// without changing anything
+func DiffFunnelEvents(events []funnel.Event) (*FunnelDiff, error) {
+	rows, err := db.Query(`SELECT contact_hash, stage, occurred_at FROM funnel_events`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	existing := []funnel.Event{}
+	for rows.Next() {
+		var event funnel.Event
+		var stage string
+		if err := rows.Scan(&event.ContactHash, &stage, &event.OccurredAt); err != nil {
+			return nil, err
+		}
+		event.Stage = funnel.Stage(stage)
+		existing = append(existing, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read funnel events: %v", err)
+	}
+
+	diff := diffFunnelEvents(existing, events)
+	return &diff, nil
+}
+
+// diffFunnelEvents works out what RecordFunnelEvents would do, keeping the
+// earliest event for each contact and stage
+func diffFunnelEvents(existing []funnel.Event, events []funnel.Event) FunnelDiff {
+	type key struct {
+		contactHash string
+		stage       funnel.Stage
+	}
+
+	earliest := make(map[key]time.Time)
+	for _, event := range existing {
+		earliest[key{event.ContactHash, event.Stage}] = event.OccurredAt
+	}
+
+	diff := FunnelDiff{Events: len(events)}
+	for _, event := range events {
+		k := key{event.ContactHash, event.Stage}
+		stored, ok := earliest[k]
+		switch {
+		case !ok:
+			diff.New++
+		case formatTimestamp(event.OccurredAt) < formatTimestamp(stored):
+			diff.Earlier++
+		default:
+			continue
+		}
+		earliest[k] = event.OccurredAt
+	}
+	return diff
+}
+
+// TeamsDiff describes how SetTeams would change the stored teams
+type TeamsDiff struct {
+	Before  int
+	After   int
+	Added   int
+	Removed int
+	Changed int
+}
+
+// DiffTeams compares the given teams with those currently stored, without
+// changing anything
+func DiffTeams(teams []TeamRow) (*TeamsDiff, error) {
+	existing, err := TeamRows()
+	if err != nil {
+		return nil, err
+	}
+
+	diff := diffTeams(existing, teams)
+	return &diff, nil
+}
+
+// diffTeams compares teams by UUID. A team has changed if its name or number
+// of members has.
+func diffTeams(before []TeamRow, after []TeamRow) TeamsDiff {
+	diff := TeamsDiff{Before: len(before), After: len(after)}
+
+	remaining := make(map[string]TeamRow)
+	for _, team := range before {
+		remaining[team.UUID] = team
+	}
+
+	for _, team := range after {
+		stored, ok := remaining[team.UUID]
+		switch {
+		case !ok:
+			diff.Added++
+		case stored.Name != team.Name || stored.MemberCount != team.MemberCount:
+			diff.Changed++
+		}
+		delete(remaining, team.UUID)
+	}
+
+	diff.Removed = len(remaining)
+	return diff
+}
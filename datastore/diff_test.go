@@ -0,0 +1,110 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/funnel"
+)
+
+func TestDiffEvents(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2019, 4, d, 9, 0, 0, 0, time.UTC) }
+	at := func(times ...time.Time) []Event {
+		events := []Event{}
+		for _, t := range times {
+			events = append(events, Event{OccurredAt: t})
+		}
+		return events
+	}
+	diffTimes := func(before []time.Time, after []time.Time) EventsDiff {
+		diff, err := diffEvents(at(before...), at(after...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return diff
+	}
+
+	before := []time.Time{day(1), day(2), day(2), day(3)}
+	after := []time.Time{day(2), day(3), day(4), day(5)}
+
+	diff := diffTimes(before, after)
+
+	if diff.Before != 4 || diff.After != 4 || diff.Added != 2 || diff.Removed != 2 {
+		t.Errorf("expected 4 → 4 rows, 2 added, 2 removed, got %+v", diff)
+	}
+	if !diff.OldestBefore.Equal(day(1)) || !diff.NewestAfter.Equal(day(5)) {
+		t.Errorf("unexpected ranges: %+v", diff)
+	}
+
+	// stored timestamps don't have a time zone, so the same wall clock time
+	// is the same row
+	london := time.FixedZone("BST", 3600)
+	same := diffTimes(
+		[]time.Time{time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)},
+		[]time.Time{time.Date(2019, 4, 1, 9, 0, 0, 0, london)},
+	)
+	if same.Added != 0 || same.Removed != 0 {
+		t.Errorf("expected no change, got %+v", same)
+	}
+
+	if empty := diffTimes(nil, nil); !empty.OldestBefore.IsZero() || empty.Added != 0 {
+		t.Errorf("expected empty diff, got %+v", empty)
+	}
+
+	// an event at the same time with a different value or labels is a
+	// different row
+	one, two, twoAgain := 1.0, 2.0, 2.001
+	changed, err := diffEvents(
+		[]Event{
+			{OccurredAt: day(1), Value: &one},
+			{OccurredAt: day(1), Labels: map[string]string{"repository": "a"}},
+			{OccurredAt: day(2), Value: &two, Labels: map[string]string{"path": "/", "referrer": "b"}},
+		},
+		[]Event{
+			{OccurredAt: day(1), Value: &two},
+			{OccurredAt: day(1), Labels: map[string]string{"repository": "b"}},
+			{OccurredAt: day(2), Value: &twoAgain, Labels: map[string]string{"referrer": "b", "path": "/"}},
+		},
+	)
+	if err != nil || changed.Added != 2 || changed.Removed != 2 {
+		t.Errorf("expected 2 added and 2 removed, got %+v, %v", changed, err)
+	}
+}
+
+func TestDiffFunnelEvents(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2019, 4, d, 9, 0, 0, 0, time.UTC) }
+
+	existing := []funnel.Event{
+		{ContactHash: "a", Stage: funnel.Signup, OccurredAt: day(2)},
+		{ContactHash: "b", Stage: funnel.Signup, OccurredAt: day(2)},
+	}
+	events := []funnel.Event{
+		{ContactHash: "a", Stage: funnel.Signup, OccurredAt: day(1)}, // earlier
+		{ContactHash: "b", Stage: funnel.Signup, OccurredAt: day(3)}, // later: ignored
+		{ContactHash: "a", Stage: funnel.Trial, OccurredAt: day(4)},  // new
+		{ContactHash: "a", Stage: funnel.Trial, OccurredAt: day(5)},  // later than the new one
+	}
+
+	diff := diffFunnelEvents(existing, events)
+	if diff.Events != 4 || diff.New != 1 || diff.Earlier != 1 {
+		t.Errorf("expected 4 events, 1 new, 1 earlier, got %+v", diff)
+	}
+}
+
+func TestDiffTeams(t *testing.T) {
+	before := []TeamRow{
+		{UUID: "a", Name: "Imagine Corporation", MemberCount: 3},
+		{UUID: "b", Name: "Flex Tech Inc.", MemberCount: 2},
+		{UUID: "c", Name: "Deleted Ltd", MemberCount: 1},
+	}
+	after := []TeamRow{
+		{UUID: "a", Name: "Imagine Corporation", MemberCount: 3},
+		{UUID: "b", Name: "Flex Tech Inc.", MemberCount: 4}, // new members
+		{UUID: "d", Name: "New Co", MemberCount: 1},
+	}
+
+	diff := diffTeams(before, after)
+	if diff.Before != 3 || diff.After != 3 || diff.Added != 1 || diff.Removed != 1 || diff.Changed != 1 {
+		t.Errorf("expected 3 → 3 teams, 1 added, 1 removed, 1 changed, got %+v", diff)
+	}
+}
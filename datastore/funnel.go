@@ -0,0 +1,72 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/fluidkeys/dashboard/funnel"
+)
+
+// RecordFunnelEvents adds the given funnel events. If a contact already has an
+// event for the same stage, the earliest is kept.
+// This is done in a transaction so a failure will rollback to the original state
+func RecordFunnelEvents(events []funnel.Event) error {
+	fmt.Printf("Recording %d funnel events\n", len(events))
+
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO funnel_events(contact_hash, stage, occurred_at)
+	          VALUES($1, $2, $3)
+		  ON CONFLICT (contact_hash, stage) DO UPDATE
+		  SET occurred_at = CASE
+		    WHEN EXCLUDED.occurred_at < funnel_events.occurred_at THEN EXCLUDED.occurred_at
+		    ELSE funnel_events.occurred_at
+		  END`
+
+	for _, event := range events {
+		_, err := transaction.Exec(query, event.ContactHash, string(event.Stage), formatTimestamp(event.OccurredAt))
+		if err != nil {
+			transaction.Rollback()
+			return err
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return err
+	}
+	notifyChanged()
+	return nil
+}
+
+// FunnelEvents returns every funnel event for contacts who signed up on or
+// after `since`
+func FunnelEvents(since time.Time) ([]funnel.Event, error) {
+	query := `SELECT contact_hash, stage, occurred_at
+	          FROM funnel_events
+		  WHERE contact_hash IN (
+		    SELECT contact_hash FROM funnel_events
+		    WHERE stage = $1 AND occurred_at >= $2
+		  )
+		  ORDER BY occurred_at ASC`
+
+	rows, err := db.Query(query, string(funnel.Signup), formatTimestamp(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []funnel.Event{}
+	for rows.Next() {
+		var event funnel.Event
+		var stage string
+		if err := rows.Scan(&event.ContactHash, &stage, &event.OccurredAt); err != nil {
+			return nil, err
+		}
+		event.Stage = funnel.Stage(stage)
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
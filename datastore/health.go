@@ -0,0 +1,76 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// LatestMigration is the number of the newest file in migrations/, which the
+// database should have been migrated to
+const LatestMigration = 14
+
+// Ping checks the database can be reached
+func Ping(ctx context.Context) error {
+	return db.PingContext(ctx)
+}
+
+// MigrationVersion returns the number of the newest migration run on the
+// database
+func MigrationVersion(ctx context.Context) (int, error) {
+	// migrations before 012 didn't record their number
+	query := `SELECT COALESCE(MAX(version), 11) FROM schema_migrations`
+
+	var version int
+	err := db.QueryRowContext(ctx, query).Scan(&version)
+	return version, err
+}
+
+// CollectorRun is when a collector last ran without an error, and when it
+// was last skipped because it isn't configured. Either is zero if it never
+// has.
+type CollectorRun struct {
+	SucceededAt time.Time
+	SkippedAt   time.Time
+}
+
+// Skipped returns true if the collector was skipped the last time it ran
+func (r CollectorRun) Skipped() bool {
+	return r.SkippedAt.After(r.SucceededAt)
+}
+
+// SetCollectorSucceeded records that the named collector ran without an error
+func SetCollectorSucceeded(collector string, succeededAt time.Time) error {
+	return setCollectorRun(collector, "succeeded_at", succeededAt)
+}
+
+// SetCollectorSkipped records that the named collector was skipped
+func SetCollectorSkipped(collector string, skippedAt time.Time) error {
+	return setCollectorRun(collector, "skipped_at", skippedAt)
+}
+
+func setCollectorRun(collector string, column string, at time.Time) error {
+	query := fmt.Sprintf(`INSERT INTO collector_runs(collector, %s)
+	          VALUES($1, $2)
+		  ON CONFLICT (collector) DO UPDATE
+		  SET %s = EXCLUDED.%s`, column, column, column)
+
+	_, err := db.Exec(query, collector, formatTimestamp(at))
+	return err
+}
+
+// LastCollectorRun returns when the named collector last succeeded and was
+// last skipped
+func LastCollectorRun(ctx context.Context, collector string) (CollectorRun, error) {
+	query := `SELECT succeeded_at, skipped_at FROM collector_runs WHERE collector = $1`
+
+	var succeededAt, skippedAt nullTime
+	err := db.QueryRowContext(ctx, query, collector).Scan(&succeededAt, &skippedAt)
+	if err == sql.ErrNoRows {
+		return CollectorRun{}, nil
+	} else if err != nil {
+		return CollectorRun{}, err
+	}
+	return CollectorRun{SucceededAt: succeededAt.Time, SkippedAt: skippedAt.Time}, nil
+}
@@ -0,0 +1,44 @@
+package datastore
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestLatestMigration(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "migrations", "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("failed to list migrations: %v", err)
+	}
+
+	latest, latestFile := 0, ""
+	for _, file := range files {
+		number, err := strconv.Atoi(strings.SplitN(filepath.Base(file), "_", 2)[0])
+		if err != nil {
+			t.Fatalf("%s: expected a migration number, got %v", file, err)
+		}
+		if number > latest {
+			latest, latestFile = number, file
+		}
+	}
+
+	if latest != LatestMigration {
+		t.Errorf("expected LatestMigration to be %d, the number of %s, got %d", latest, latestFile, LatestMigration)
+	}
+
+	// the newest migration and the SQLite schema both record the number
+	recorded := fmt.Sprintf("INSERT INTO schema_migrations (version) VALUES (%d)", LatestMigration)
+	for _, file := range []string{latestFile, "sqlite_schema.sql"} {
+		contents, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(contents), recorded) {
+			t.Errorf("%s: expected it to contain %s", file, recorded)
+		}
+	}
+}
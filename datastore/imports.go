@@ -0,0 +1,144 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+)
+
+// ImportResult summarises what ImportMetricTimes did
+type ImportResult struct {
+	Read             int
+	DuplicatesInFile int
+	AlreadyStored    int
+	Inserted         int
+}
+
+// ImportMetricTimes adds the given times to a metric, skipping any that are
+// repeated or already stored, whether by a collector or an earlier import.
+// Imported rows are never deleted by collectors.
+// This is done in a transaction so a failure will rollback to the original state
+func ImportMetricTimes(metric string, times []time.Time) (*ImportResult, error) {
+	if !collectedMetrics[metric] {
+		return nil, fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	transaction, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := queryTimes(transaction, "SELECT occurred_at FROM metric_events WHERE metric = $1", metric)
+	if err != nil {
+		transaction.Rollback()
+		return nil, err
+	}
+
+	toInsert, result := newTimes(existing, times)
+
+	query := "INSERT INTO metric_events(metric, occurred_at, source, recorded_at) VALUES($1, $2, $3, $4)"
+	for _, timestamp := range toInsert {
+		if _, err := transaction.Exec(query, metric, formatTimestamp(timestamp), sourceImport, recordedAt()); err != nil {
+			transaction.Rollback()
+			return nil, err
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return nil, err
+	}
+	if len(toInsert) > 0 {
+		notifyChanged()
+	}
+	return &result, nil
+}
+
+// newTimes returns the times that aren't already in `existing` or earlier in
+// `times`, compared as they'd be stored
+func newTimes(existing []time.Time, times []time.Time) ([]time.Time, ImportResult) {
+	result := ImportResult{Read: len(times)}
+
+	stored := make(map[string]bool)
+	for _, t := range existing {
+		stored[formatTimestamp(t)] = true
+	}
+
+	seen := make(map[string]bool)
+	toInsert := []time.Time{}
+
+	for _, t := range times {
+		key := formatTimestamp(t)
+		switch {
+		case seen[key]:
+			result.DuplicatesInFile++
+		case stored[key]:
+			result.AlreadyStored++
+		default:
+			toInsert = append(toInsert, t)
+		}
+		seen[key] = true
+	}
+
+	result.Inserted = len(toInsert)
+	return toInsert, result
+}
+
+// MergeImportedDays stores the imported daily totals of one or more metrics,
+// e.g. the page views of each path, in a transaction so a failure will
+// rollback to the original state. Each event replaces the imported event of
+// its metric on the same day (midnight UTC) with the same labels, and the
+// others on that day are kept, so counting other paths or versions doesn't
+// remove what was counted before. There should be one event for each metric,
+// day and labels.
+func MergeImportedDays(events map[string][]Event) error {
+	for metric := range events {
+		if !collectedMetrics[metric] {
+			return fmt.Errorf("unknown metric '%s'", metric)
+		}
+	}
+
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	deleteQuery := fmt.Sprintf(`DELETE FROM metric_events
+	                            WHERE metric = $1 AND source = $2
+	                            AND occurred_at >= $3 AND occurred_at < $4
+	                            AND labels = %s`, sqlDialect.cast("$5", "jsonb"))
+
+	insertQuery := `INSERT INTO metric_events(metric, occurred_at, value, source, source_id, labels, recorded_at)
+	                VALUES($1, $2, $3, $4, $5, $6, $7)`
+
+	for metric, metricEvents := range events {
+		for _, event := range metricEvents {
+			labels, err := labelsJSON(event.Labels)
+			if err != nil {
+				transaction.Rollback()
+				return err
+			}
+
+			occurredAt := event.OccurredAt.UTC()
+			day := time.Date(occurredAt.Year(), occurredAt.Month(), occurredAt.Day(), 0, 0, 0, 0, time.UTC)
+
+			_, err = transaction.Exec(deleteQuery, metric, sourceImport,
+				formatTimestamp(day), formatTimestamp(day.AddDate(0, 0, 1)), labels)
+			if err != nil {
+				transaction.Rollback()
+				return err
+			}
+
+			_, err = transaction.Exec(insertQuery, metric, formatTimestamp(event.OccurredAt),
+				nullableValue(event.Value), sourceImport, nullableString(event.SourceID), labels, recordedAt())
+			if err != nil {
+				transaction.Rollback()
+				return err
+			}
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return err
+	}
+	notifyChanged()
+	return nil
+}
@@ -0,0 +1,23 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewTimes(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2019, 4, d, 9, 0, 0, 0, time.UTC) }
+
+	toInsert, result := newTimes(
+		[]time.Time{day(1), day(2)},
+		[]time.Time{day(1), day(3), day(3), day(4)},
+	)
+
+	if len(toInsert) != 2 || !toInsert[0].Equal(day(3)) || !toInsert[1].Equal(day(4)) {
+		t.Errorf("expected to insert days 3 and 4, got %v", toInsert)
+	}
+	expected := ImportResult{Read: 4, DuplicatesInFile: 1, AlreadyStored: 1, Inserted: 2}
+	if result != expected {
+		t.Errorf("expected %+v, got %+v", expected, result)
+	}
+}
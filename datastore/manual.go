@@ -0,0 +1,98 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// manualMetrics are the metrics entered by hand, e.g. "interviews", which are
+// stored in metric_events with the source 'manual'
+var manualMetrics = map[string]bool{}
+
+var validManualMetricName = regexp.MustCompile(`^[a-z][a-zA-Z0-9]*$`)
+
+// SetManualMetrics sets the names of the metrics that are entered by hand. It
+// should be called once, before anything else uses the datastore.
+func SetManualMetrics(names []string) error {
+	metrics := map[string]bool{}
+	for _, name := range names {
+		if !validManualMetricName.MatchString(name) {
+			return fmt.Errorf("invalid manual metric name '%s', expected e.g. 'pressMentions'", name)
+		}
+		if collectedMetrics[name] {
+			return fmt.Errorf("manual metric '%s' has the same name as a collected metric", name)
+		}
+		metrics[name] = true
+	}
+	manualMetrics = metrics
+	return nil
+}
+
+// IsManualMetric returns true if the given metric is entered by hand
+func IsManualMetric(name string) bool {
+	return manualMetrics[name]
+}
+
+// ManualEvent is something that happened that we count by hand, like a
+// customer interview or a conference talk
+type ManualEvent struct {
+	ID         int64     `json:"id"`
+	Metric     string    `json:"metric"`
+	OccurredAt time.Time `json:"occurredAt"`
+
+	// Value is optional. When charted, an event counts as its value, or 1 if
+	// it doesn't have one.
+	Value *float64 `json:"value,omitempty"`
+	Note  string   `json:"note,omitempty"`
+}
+
+// RecordManualEvent stores the event, returning it with its ID
+func RecordManualEvent(event ManualEvent) (*ManualEvent, error) {
+	if !IsManualMetric(event.Metric) {
+		return nil, fmt.Errorf("'%s' isn't a manual metric", event.Metric)
+	}
+
+	query := `INSERT INTO metric_events(metric, occurred_at, value, source, note, recorded_at)
+	          VALUES($1, $2, $3, $4, $5, $6)
+		  RETURNING id`
+
+	err := db.QueryRow(query, event.Metric, formatTimestamp(event.OccurredAt), nullableValue(event.Value),
+		sourceManual, event.Note, recordedAt()).Scan(&event.ID)
+	if err != nil {
+		return nil, err
+	}
+	notifyChanged()
+	return &event, nil
+}
+
+// RecentManualEvents returns the most recent `limit` events of the given
+// metric, newest first
+func RecentManualEvents(metric string, limit int) ([]ManualEvent, error) {
+	query := `SELECT id, metric, occurred_at, value, note
+	          FROM metric_events
+		  WHERE metric = $1 AND source = $2
+		  ORDER BY occurred_at DESC, id DESC
+		  LIMIT $3`
+
+	rows, err := db.Query(query, metric, sourceManual, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []ManualEvent{}
+	for rows.Next() {
+		event := ManualEvent{}
+		var value sql.NullFloat64
+		if err := rows.Scan(&event.ID, &event.Metric, &event.OccurredAt, &value, &event.Note); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			event.Value = &value.Float64
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,462 @@
+package datastore
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// collectedMetrics are the metrics written by collectors (or imported), each
+// of which is a list of things that happened, stored in metric_events
+var collectedMetrics = map[string]bool{
+	"signups":      true,
+	"unsubscribes": true,
+	"trials":       true,
+	"calls":        true,
+	"releases":     true,
+
+	// labelled with the repository, e.g. {"repository": "fluidkeys/fluidkeys"}
+	"pullRequestsMerged": true,
+
+	// daily totals from `dashboard ingest-logs`, labelled with the path, e.g.
+	// {"path": "/download"}, and referrals also with the referring site. The
+	// totals across every path are labelled {"path": "*"}, since a page view
+	// can match more than one path.
+	"pageViews":      true,
+	"uniqueVisitors": true,
+	"referrals":      true,
+
+	// daily totals labelled with the version, e.g. {"version": "0.2.6"}
+	"downloads": true,
+}
+
+// MetricNames returns the names of all the metrics that are stored as a list
+// of events, e.g. "signups", including those entered by hand
+func MetricNames() []string {
+	names := []string{}
+	for name := range collectedMetrics {
+		names = append(names, name)
+	}
+	for name := range manualMetrics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// IsMetric returns true if the given name is one of MetricNames
+func IsMetric(name string) bool {
+	return collectedMetrics[name] || IsManualMetric(name)
+}
+
+// Event is a single occurrence of a metric, e.g. a signup
+type Event struct {
+	OccurredAt time.Time
+
+	// Value is nil for events that just count as 1
+	Value *float64
+
+	// SourceID is the event's ID in its source, if it has one
+	SourceID string
+
+	Labels map[string]string
+}
+
+// SetMetricTimes replaces all the collector's events of the given metric with
+// an event at each of the given times
+func SetMetricTimes(metric string, times []time.Time) error {
+	events := []Event{}
+	for _, t := range times {
+		events = append(events, Event{OccurredAt: t})
+	}
+	return SetMetricEvents(metric, events)
+}
+
+// SetMetricEvents replaces all the collector's events of the given metric
+// with the given events. Imported and manual events are kept, and an event
+// isn't inserted again if there's an imported event at the same time with the
+// same labels (and source ID, if both have one).
+// This is done in a transaction so a failure will rollback to the original state
+func SetMetricEvents(metric string, events []Event) error {
+	if !collectedMetrics[metric] {
+		return fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	fmt.Printf("Adding %d %s events\n", len(events), metric)
+
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`DELETE FROM metric_events WHERE metric = $1 AND source = $2`,
+		metric, sourceCollector)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO metric_events(metric, occurred_at, value, source, source_id, labels, recorded_at)
+	          SELECT $1, %s, %s, $4, $5, %s, %s
+		  WHERE NOT EXISTS (
+		    SELECT 1 FROM metric_events
+		    WHERE metric = $1 AND occurred_at = %s AND source = $7
+		    AND labels = %s
+		    AND (source_id IS NULL OR %s IS NULL OR source_id = $5)
+		  )`, sqlDialect.cast("$2", "timestamp"), sqlDialect.cast("$3", "numeric"), sqlDialect.cast("$6", "jsonb"),
+		sqlDialect.cast("$8", "timestamp"),
+		sqlDialect.cast("$2", "timestamp"), sqlDialect.cast("$6", "jsonb"), sqlDialect.cast("$5", "text"))
+
+	for _, event := range events {
+		labels, err := labelsJSON(event.Labels)
+		if err != nil {
+			transaction.Rollback()
+			return err
+		}
+
+		_, err = transaction.Exec(query, metric, formatTimestamp(event.OccurredAt), nullableValue(event.Value),
+			sourceCollector, nullableString(event.SourceID), labels, sourceImport, recordedAt())
+		if err != nil {
+			transaction.Rollback()
+			return err
+		}
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return err
+	}
+	notifyChanged()
+	return nil
+}
+
+// EventRow is a single raw event of a metric
+type EventRow struct {
+	ID        int64             `json:"id"`
+	Timestamp time.Time         `json:"timestamp"`
+	Value     *float64          `json:"value,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// MetricRows returns the raw events of the given metric in the window, oldest
+// first. A zero From or To means no limit.
+func MetricRows(metric string, window Window, filters Filters) ([]EventRow, error) {
+	if !IsMetric(metric) {
+		return nil, fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	labels, err := labelsJSON(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT id, occurred_at, value, labels FROM metric_events
+	          WHERE metric = $1
+		  AND (%s IS NULL OR occurred_at >= $2)
+		  AND (%s IS NULL OR occurred_at < $3)
+		  AND %s
+		  ORDER BY occurred_at ASC, id ASC`,
+		sqlDialect.cast("$2", "timestamp"), sqlDialect.cast("$3", "timestamp"),
+		sqlDialect.labelsContain("labels", "$4"))
+
+	return queryEventRows(query, metric, nullableTimestamp(window.From), nullableTimestamp(window.To), labels)
+}
+
+func queryEventRows(query string, args ...interface{}) ([]EventRow, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	eventRows := []EventRow{}
+	for rows.Next() {
+		row := EventRow{}
+		var value sql.NullFloat64
+		var labels []byte
+		if err := rows.Scan(&row.ID, &row.Timestamp, &value, &labels); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			row.Value = &value.Float64
+		}
+		if err := json.Unmarshal(labels, &row.Labels); err != nil {
+			return nil, fmt.Errorf("invalid labels %s: %v", labels, err)
+		}
+		if len(row.Labels) == 0 {
+			row.Labels = nil
+		}
+		eventRows = append(eventRows, row)
+	}
+	return eventRows, rows.Err()
+}
+
+// Window is a period of time: from From (inclusive) to To (exclusive)
+type Window struct {
+	From time.Time
+	To   time.Time
+}
+
+// Dates returns the window covering the dates from `from` to `to` inclusive
+func Dates(from time.Time, to time.Time) Window {
+	return Window{From: startOfDay(from), To: startOfDay(to).AddDate(0, 0, 1)}
+}
+
+// LastNDays returns the window covering the `days` dates up to and including
+// the date of `now`
+func LastNDays(days int, now time.Time) Window {
+	return Dates(now.AddDate(0, 0, 1-days), now)
+}
+
+// startOfDay returns midnight (UTC) on the date of t. Timestamps are stored
+// without a time zone, and dates are always in UTC.
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// Bucket is how a series is grouped
+type Bucket string
+
+const (
+	// Day gives a count for each date
+	Day Bucket = "day"
+
+	// Week gives a count for each week, starting on Monday
+	Week Bucket = "week"
+
+	// Month gives a count for each calendar month
+	Month Bucket = "month"
+)
+
+// IsBucket returns true if the given name is a Bucket
+func IsBucket(name string) bool {
+	switch Bucket(name) {
+	case Day, Week, Month:
+		return true
+	}
+	return false
+}
+
+// Filters only include events with all of the given labels, e.g.
+// {"repository": "fluidkeys/fluidkeys"}
+type Filters map[string]string
+
+// Series returns the total of the metric in each bucket of the window, oldest
+// first. Each bucket's date is the start of the bucket, and buckets with no
+// events have a count of 0. An event counts as its value, or 1 if it doesn't
+// have one.
+func Series(metric string, window Window, bucket Bucket, filters Filters) ([]DateCount, error) {
+	if !IsMetric(metric) {
+		return nil, fmt.Errorf("unknown metric '%s'", metric)
+	}
+	if !IsBucket(string(bucket)) {
+		return nil, fmt.Errorf("invalid bucket '%s', expected day, week or month", bucket)
+	}
+	if window.From.IsZero() || window.To.IsZero() {
+		return nil, fmt.Errorf("a series needs a start and end time")
+	}
+
+	labels, err := labelsJSON(filters)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT buckets.start AS date,
+	          CAST(ROUND(COALESCE(SUM(
+	            CASE WHEN metric_events.id IS NULL THEN 0 ELSE COALESCE(metric_events.value, 1) END
+	          ), 0)) AS INTEGER) AS count
+	          FROM %s
+	          LEFT JOIN metric_events
+	            ON metric_events.metric = $1
+	            AND %s = buckets.start
+	            AND metric_events.occurred_at >= $2
+	            AND metric_events.occurred_at < $3
+	            AND %s
+	          GROUP BY buckets.start
+	          ORDER BY buckets.start ASC`,
+		sqlDialect.seriesBuckets(bucket, "$2", "$3"), sqlDialect.bucketStart(bucket, "metric_events.occurred_at"),
+		sqlDialect.labelsContain("metric_events.labels", "$4"))
+
+	return queryDateCounts(query, metric, formatTimestamp(window.From), formatTimestamp(window.To), labels)
+}
+
+// Total returns the total of the metric in the window. A zero From or To
+// means no limit.
+func Total(metric string, window Window, filters Filters) (int, error) {
+	if !IsMetric(metric) {
+		return 0, fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	labels, err := labelsJSON(filters)
+	if err != nil {
+		return 0, err
+	}
+
+	query := fmt.Sprintf(`SELECT CAST(ROUND(COALESCE(SUM(COALESCE(value, 1)), 0)) AS INTEGER)
+	          FROM metric_events
+		  WHERE metric = $1
+		  AND (%s IS NULL OR occurred_at >= $2)
+		  AND (%s IS NULL OR occurred_at < $3)
+		  AND %s`,
+		sqlDialect.cast("$2", "timestamp"), sqlDialect.cast("$3", "timestamp"),
+		sqlDialect.labelsContain("labels", "$4"))
+
+	var total int
+	err = db.QueryRow(query, metric, nullableTimestamp(window.From), nullableTimestamp(window.To), labels).
+		Scan(&total)
+	return total, err
+}
+
+// LastOccurred returns the time of the most recent event of the metric before
+// `before`, or false if there isn't one
+func LastOccurred(metric string, before time.Time) (time.Time, bool, error) {
+	if !IsMetric(metric) {
+		return time.Time{}, false, fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	query := `SELECT MAX(occurred_at) FROM metric_events WHERE metric = $1 AND occurred_at < $2`
+
+	var last nullTime
+	if err := db.QueryRow(query, metric, formatTimestamp(before)).Scan(&last); err != nil {
+		return time.Time{}, false, err
+	}
+	return last.Time, last.Valid, nil
+}
+
+// FirstOccurredByLabel returns the time of the earliest event of the metric
+// for each value of the given label, e.g. when each version was released
+func FirstOccurredByLabel(metric string, label string) (map[string]time.Time, error) {
+	if !IsMetric(metric) {
+		return nil, fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	query := fmt.Sprintf(`SELECT %s, MIN(occurred_at)
+	          FROM metric_events
+		  WHERE metric = $1 AND %s IS NOT NULL
+		  GROUP BY 1`, sqlDialect.labelValue("$2"), sqlDialect.labelValue("$2"))
+
+	rows, err := db.Query(query, metric, label)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	first := map[string]time.Time{}
+	for rows.Next() {
+		var value string
+		var occurredAt nullTime
+		if err := rows.Scan(&value, &occurredAt); err != nil {
+			return nil, err
+		}
+		first[value] = occurredAt.Time
+	}
+	return first, rows.Err()
+}
+
+func queryDateCounts(query string, args ...interface{}) ([]DateCount, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	dateCounts := make([]DateCount, 0)
+
+	for rows.Next() {
+		nextDateCount := DateCount{}
+
+		err = rows.Scan(&nextDateCount.Date, &nextDateCount.Count)
+		if err != nil {
+			return nil, err
+		}
+		dateCounts = append(dateCounts, nextDateCount)
+	}
+
+	return dateCounts, rows.Err()
+}
+
+// querier is a *sql.DB or *sql.Tx
+type querier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// queryTimes returns the single timestamp column selected by query
+func queryTimes(q querier, query string, args ...interface{}) ([]time.Time, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	times := []time.Time{}
+	for rows.Next() {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		times = append(times, t)
+	}
+	return times, rows.Err()
+}
+
+// queryEvents returns the events whose occurred_at, value, source_id and
+// labels are selected by query
+func queryEvents(q querier, query string, args ...interface{}) ([]Event, error) {
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	events := []Event{}
+	for rows.Next() {
+		event := Event{}
+		var value sql.NullFloat64
+		var sourceID sql.NullString
+		var labels []byte
+		if err := rows.Scan(&event.OccurredAt, &value, &sourceID, &labels); err != nil {
+			return nil, err
+		}
+		if value.Valid {
+			event.Value = &value.Float64
+		}
+		event.SourceID = sourceID.String
+		if err := json.Unmarshal(labels, &event.Labels); err != nil {
+			return nil, fmt.Errorf("invalid labels %s: %v", labels, err)
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// labelsJSON encodes labels for the labels column, or a labelsContain
+// condition
+func labelsJSON(labels map[string]string) (string, error) {
+	if len(labels) == 0 {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(labels)
+	return string(encoded), err
+}
+
+// nullableTimestamp returns nil for a zero time, so it's NULL in a query
+func nullableTimestamp(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return formatTimestamp(t)
+}
+
+func nullableValue(value *float64) interface{} {
+	if value == nil {
+		return nil
+	}
+	return *value
+}
+
+func nullableString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
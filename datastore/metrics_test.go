@@ -0,0 +1,52 @@
+package datastore
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLastNDays(t *testing.T) {
+	london := time.FixedZone("BST", 3600)
+	now := time.Date(2019, 4, 1, 0, 30, 0, 0, london)
+
+	window := LastNDays(30, now)
+
+	// dates are taken from the wall clock, as timestamps are stored
+	if !window.From.Equal(time.Date(2019, 3, 3, 0, 0, 0, 0, time.UTC)) ||
+		!window.To.Equal(time.Date(2019, 4, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected 2019-03-03 to 2019-04-02, got %+v", window)
+	}
+}
+
+func TestDates(t *testing.T) {
+	window := Dates(time.Date(2019, 4, 1, 18, 0, 0, 0, time.UTC), time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC))
+
+	if !window.From.Equal(time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)) ||
+		!window.To.Equal(time.Date(2019, 4, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected the whole of 2019-04-01, got %+v", window)
+	}
+}
+
+func TestIsBucket(t *testing.T) {
+	for name, expected := range map[string]bool{"day": true, "week": true, "month": true, "year": false, "": false} {
+		if got := IsBucket(name); got != expected {
+			t.Errorf("%q: expected %v, got %v", name, expected, got)
+		}
+	}
+}
+
+func TestLabelsJSON(t *testing.T) {
+	for _, test := range []struct {
+		labels   map[string]string
+		expected string
+	}{
+		{nil, "{}"},
+		{Filters{}, "{}"},
+		{Filters{"repository": "fluidkeys/fluidkeys"}, `{"repository":"fluidkeys/fluidkeys"}`},
+	} {
+		got, err := labelsJSON(test.labels)
+		if err != nil || got != test.expected {
+			t.Errorf("%v: expected %s, got %s, %v", test.labels, test.expected, got, err)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package datastore
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// postgres is the production database. Its schema is created by the files in
+// migrations/.
+type postgres struct{}
+
+func (postgres) driverName() string {
+	return "postgres"
+}
+
+func (postgres) dataSourceName(databaseURL string) string {
+	return databaseURL
+}
+
+func (postgres) setUp(db *sql.DB) error {
+	return nil
+}
+
+func (postgres) cast(param string, sqlType string) string {
+	return fmt.Sprintf("%s::%s", param, sqlType)
+}
+
+func (postgres) labelsContain(column string, param string) string {
+	return fmt.Sprintf("%s @> %s::jsonb", column, param)
+}
+
+func (postgres) labelValue(param string) string {
+	return fmt.Sprintf("labels ->> %s::text", param)
+}
+
+func (postgres) seriesBuckets(bucket Bucket, from string, to string) string {
+	return fmt.Sprintf(`generate_series(
+	          date_trunc('%s', %s::timestamp), %s::timestamp - interval '1 microsecond', interval '1 %s'
+	        ) AS buckets(start)`, bucket, from, to, bucket)
+}
+
+func (postgres) bucketStart(bucket Bucket, column string) string {
+	return fmt.Sprintf("date_trunc('%s', %s)", bucket, column)
+}
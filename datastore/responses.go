@@ -0,0 +1,42 @@
+package datastore
+
+import (
+	"database/sql"
+	"time"
+)
+
+// HTTPResponse is the last response to a URL that had an ETag
+type HTTPResponse struct {
+	ETag string
+	Link string
+	Body []byte
+}
+
+// GetHTTPResponse returns the stored response for the URL, or nil if there
+// isn't one
+func GetHTTPResponse(url string) (*HTTPResponse, error) {
+	response := HTTPResponse{}
+	err := db.QueryRow(`SELECT etag, link, body FROM http_responses WHERE url = $1`, url).Scan(
+		&response.ETag, &response.Link, &response.Body)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &response, nil
+}
+
+// SetHTTPResponse stores the response for the URL, replacing any stored
+// before
+func SetHTTPResponse(url string, response HTTPResponse, fetchedAt time.Time) error {
+	query := `INSERT INTO http_responses(url, etag, link, body, fetched_at)
+	          VALUES($1, $2, $3, $4, $5)
+		  ON CONFLICT (url) DO UPDATE
+		  SET etag = EXCLUDED.etag,
+		      link = EXCLUDED.link,
+		      body = EXCLUDED.body,
+		      fetched_at = EXCLUDED.fetched_at`
+
+	_, err := db.Exec(query, url, response.ETag, response.Link, response.Body, formatTimestamp(fetchedAt))
+	return err
+}
@@ -0,0 +1,78 @@
+package datastore
+
+import (
+	"fmt"
+	"time"
+)
+
+// Snapshot is the value of a scalar metric (like the number of calls arranged
+// in the next 7 days) as recorded on a given date
+type Snapshot struct {
+	Date  JSONDate `json:"date"`
+	Value float64  `json:"value"`
+}
+
+// SetMetricSnapshot records the value of the given metric for the date of
+// `takenAt`, replacing any snapshot already taken that day
+func SetMetricSnapshot(metric string, value float64, takenAt time.Time) error {
+	return SetLabelledMetricSnapshot(metric, nil, value, takenAt)
+}
+
+// SetLabelledMetricSnapshot is SetMetricSnapshot for one part of a metric,
+// e.g. the stars of one GitHub repository, {"repository": "fluidkeys/fluidkeys"}.
+// It replaces the snapshot taken that day with the same labels.
+func SetLabelledMetricSnapshot(metric string, labels map[string]string, value float64, takenAt time.Time) error {
+	encodedLabels, err := labelsJSON(labels)
+	if err != nil {
+		return err
+	}
+
+	query := fmt.Sprintf(`INSERT INTO metric_snapshots(metric, taken_on, taken_at, value, labels)
+	          VALUES($1, $2, $3, $4, %s)
+		  ON CONFLICT (metric, taken_on, labels) DO UPDATE
+		  SET taken_at = EXCLUDED.taken_at,
+		      value = EXCLUDED.value`, sqlDialect.cast("$5", "jsonb"))
+
+	_, err = db.Exec(query, metric, takenAt.Format("2006-01-02"), formatTimestamp(takenAt), value, encodedLabels)
+	if err != nil {
+		return err
+	}
+	notifyChanged()
+	return nil
+}
+
+// MetricSnapshots returns the snapshots of the given metric with exactly the
+// given labels (nil for the totals) taken in the last `days` days (including
+// today), oldest first. Days without a snapshot are missing from the list.
+func MetricSnapshots(metric string, labels map[string]string, days int) ([]Snapshot, error) {
+	encodedLabels, err := labelsJSON(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`SELECT taken_on, value
+	          FROM metric_snapshots
+		  WHERE metric = $1
+		  AND taken_on > $2
+		  AND labels = %s
+		  ORDER BY taken_on ASC`, sqlDialect.cast("$3", "jsonb"))
+
+	// dates are in UTC
+	since := time.Now().UTC().AddDate(0, 0, -days).Format("2006-01-02")
+
+	rows, err := db.Query(query, metric, since, encodedLabels)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	snapshots := []Snapshot{}
+	for rows.Next() {
+		snapshot := Snapshot{}
+		if err := rows.Scan(&snapshot.Date, &snapshot.Value); err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
@@ -0,0 +1,138 @@
+package datastore
+
+import (
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"regexp"
+)
+
+// sqliteSchema creates every table if it doesn't exist. It's the schema the
+// Postgres migrations end up with, so SQLite databases don't need migrating.
+//
+//go:embed sqlite_schema.sql
+var sqliteSchema string
+
+// sqlite stores everything in a single file, for local development, e.g.
+// DATABASE_URL=sqlite://dashboard.db
+//
+// Timestamps are stored as text in the same format as formatTimestamp, so
+// they sort and compare as they would in Postgres.
+type sqlite struct{}
+
+func (sqlite) driverName() string {
+	return sqliteDriverName
+}
+
+var postgresParam = regexp.MustCompile(`\$([0-9]+)`)
+
+// sqliteParams numbers the parameters in a query the SQLite way, e.g. $2
+// becomes ?2. SQLite reads $2 as a parameter named "$2", which it numbers
+// by the order it first appears in rather than by its number.
+func sqliteParams(query string) string {
+	return postgresParam.ReplaceAllString(query, "?$1")
+}
+
+// dataSourceName is the path after sqlite://, e.g. sqlite:///var/dashboard.db
+// for an absolute path, or sqlite://:memory: for a database that's gone when
+// the process exits
+func (sqlite) dataSourceName(databaseURL string) string {
+	return databaseURL[len("sqlite://"):]
+}
+
+func (sqlite) setUp(db *sql.DB) error {
+	// SQLite only allows one writer at a time, and each connection to
+	// :memory: would be a different database
+	db.SetMaxOpenConns(1)
+
+	labelled, err := sqliteSnapshotsHaveLabels(db)
+	if err != nil {
+		return err
+	}
+	if labelled {
+		_, err = db.Exec(sqliteSchema)
+		return err
+	}
+
+	// the snapshots table was created before snapshots had labels, and
+	// SQLite can't change its unique constraint, so it's copied into a new
+	// one
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	_, err = transaction.Exec(`ALTER TABLE metric_snapshots RENAME TO metric_snapshots_without_labels;` +
+		sqliteSchema + `
+	          INSERT INTO metric_snapshots(id, metric, taken_on, taken_at, value)
+	          SELECT id, metric, taken_on, taken_at, value FROM metric_snapshots_without_labels;
+	          DROP TABLE metric_snapshots_without_labels;`)
+	if err != nil {
+		transaction.Rollback()
+		return err
+	}
+	return transaction.Commit()
+}
+
+// sqliteSnapshotsHaveLabels is false if there's a metric_snapshots table from
+// before migration 014, which added labels. It's true if there's no table yet.
+func sqliteSnapshotsHaveLabels(db *sql.DB) (bool, error) {
+	query := `SELECT
+	            NOT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'metric_snapshots')
+	            OR EXISTS (SELECT 1 FROM pragma_table_info('metric_snapshots') WHERE name = 'labels')`
+
+	var labelled bool
+	err := db.QueryRow(query).Scan(&labelled)
+	return labelled, err
+}
+
+func (sqlite) cast(param string, sqlType string) string {
+	return param
+}
+
+// labelsContain is true if there's no label in param that the event doesn't
+// have with the same value
+func (sqlite) labelsContain(column string, param string) string {
+	return fmt.Sprintf(`NOT EXISTS (
+	            SELECT 1 FROM json_each(%s) AS filter
+	            WHERE json_extract(%s, '$."' || filter.key || '"') IS NOT filter.value
+	          )`, param, column)
+}
+
+func (sqlite) labelValue(param string) string {
+	return fmt.Sprintf(`json_extract(labels, '$."' || %s || '"')`, param)
+}
+
+// seriesBuckets replaces Postgres' generate_series with a recursive query
+// over the dates of the bucket starts
+func (s sqlite) seriesBuckets(bucket Bucket, from string, to string) string {
+	next := fmt.Sprintf("date(start, '%s')", sqliteBucketLength[bucket])
+	return fmt.Sprintf(`(
+	          WITH RECURSIVE starts(start) AS (
+	            SELECT %s
+	            UNION ALL
+	            SELECT %s FROM starts WHERE julianday(%s) < julianday(%s)
+	          )
+	          SELECT start FROM starts
+	        ) AS buckets`, s.bucketStart(bucket, from), next, next, to)
+}
+
+// bucketStart replaces Postgres' date_trunc, giving the date as text, e.g.
+// "2019-04-01"
+func (sqlite) bucketStart(bucket Bucket, column string) string {
+	switch bucket {
+	case Week:
+		// the next Sunday (or the same day, if it's a Sunday), then back to
+		// that week's Monday
+		return fmt.Sprintf("date(%s, 'weekday 0', '-6 days')", column)
+	case Month:
+		return fmt.Sprintf("date(%s, 'start of month')", column)
+	}
+	return fmt.Sprintf("date(%s)", column)
+}
+
+var sqliteBucketLength = map[Bucket]string{
+	Day:   "+1 day",
+	Week:  "+7 days",
+	Month: "+1 month",
+}
@@ -0,0 +1,74 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	sqlite3 "modernc.org/sqlite"
+)
+
+// sqliteDriverName is the pure-Go SQLite driver, with the parameters of each
+// query numbered the SQLite way (see sqliteParams). It's vendored, so
+// DATABASE_URL=sqlite://... works without cgo or any other setup.
+const sqliteDriverName = "dashboard-sqlite"
+
+// sqliteBusyTimeoutMs is how long to wait for `dashboard collect` to finish
+// writing rather than failing
+const sqliteBusyTimeoutMs = 5000
+
+func init() {
+	sql.Register(sqliteDriverName, sqliteDriver{})
+}
+
+type sqliteDriver struct{}
+
+func (sqliteDriver) Open(name string) (driver.Conn, error) {
+	opened, err := (&sqlite3.Driver{}).Open(name)
+	if err != nil {
+		return nil, err
+	}
+	conn, ok := opened.(sqliteDriverConn)
+	if !ok {
+		opened.Close()
+		return nil, fmt.Errorf("the SQLite driver's connections don't support contexts")
+	}
+
+	busyTimeout := fmt.Sprintf("PRAGMA busy_timeout = %d", sqliteBusyTimeoutMs)
+	if _, err := conn.ExecContext(context.Background(), busyTimeout, nil); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return sqliteConn{conn}, nil
+}
+
+// sqliteDriverConn is what the driver's connections implement
+type sqliteDriverConn interface {
+	driver.Conn
+	driver.ConnBeginTx
+	driver.ConnPrepareContext
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.Pinger
+}
+
+type sqliteConn struct {
+	sqliteDriverConn
+}
+
+func (c sqliteConn) Prepare(query string) (driver.Stmt, error) {
+	return c.sqliteDriverConn.Prepare(sqliteParams(query))
+}
+
+func (c sqliteConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	return c.sqliteDriverConn.PrepareContext(ctx, sqliteParams(query))
+}
+
+func (c sqliteConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	return c.sqliteDriverConn.ExecContext(ctx, sqliteParams(query), args)
+}
+
+func (c sqliteConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return c.sqliteDriverConn.QueryContext(ctx, sqliteParams(query), args)
+}
@@ -0,0 +1,75 @@
+-- The SQLite equivalent of the tables created by migrations/. It's run every
+-- time a SQLite database is opened, so every statement must be safe to run
+-- again. Keep it in step with new migrations.
+--
+-- Timestamps are stored as text, e.g. '2019-04-01T09:00:00', and labels as a
+-- JSON object.
+
+CREATE TABLE IF NOT EXISTS alert_states (
+  rule_name TEXT PRIMARY KEY,
+  state TEXT NOT NULL,
+  value DOUBLE PRECISION,
+  changed_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS metric_snapshots (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  metric TEXT NOT NULL,
+  taken_on DATE NOT NULL,
+  taken_at TIMESTAMP NOT NULL,
+  value DOUBLE PRECISION NOT NULL,
+  labels TEXT NOT NULL DEFAULT '{}',
+  UNIQUE (metric, taken_on, labels)
+);
+
+CREATE TABLE IF NOT EXISTS funnel_events (
+  contact_hash TEXT NOT NULL,
+  stage TEXT NOT NULL,
+  occurred_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (contact_hash, stage)
+);
+
+CREATE TABLE IF NOT EXISTS metric_events (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  metric TEXT NOT NULL,
+  occurred_at TIMESTAMP NOT NULL,
+  value NUMERIC(14, 2),
+  source TEXT NOT NULL DEFAULT 'collector',
+  source_id TEXT,
+  labels TEXT NOT NULL DEFAULT '{}',
+  note TEXT NOT NULL DEFAULT '',
+  recorded_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS metric_events_metric_occurred_at ON metric_events (metric, occurred_at);
+
+CREATE TABLE IF NOT EXISTS teams (
+  id INTEGER PRIMARY KEY AUTOINCREMENT,
+  uuid TEXT NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  member_count INTEGER NOT NULL,
+  created_at TIMESTAMP,
+  last_seen_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS http_responses (
+  url TEXT PRIMARY KEY,
+  etag TEXT NOT NULL,
+  link TEXT NOT NULL DEFAULT '',
+  body BLOB NOT NULL,
+  fetched_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS collector_runs (
+  collector TEXT PRIMARY KEY,
+  succeeded_at TIMESTAMP,
+  skipped_at TIMESTAMP
+);
+
+-- this schema is the same as every migration up to LatestMigration
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO schema_migrations (version) VALUES (14) ON CONFLICT DO NOTHING;
@@ -0,0 +1,438 @@
+package datastore
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/funnel"
+)
+
+// These run every query against an in-memory SQLite database
+
+func initializeSQLite(t *testing.T) {
+	t.Helper()
+	if err := Initialize("sqlite://:memory:"); err != nil {
+		t.Fatalf("failed to open SQLite: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		sqlDialect = postgres{}
+	})
+}
+
+func TestSQLiteMetricEvents(t *testing.T) {
+	initializeSQLite(t)
+
+	day := func(d int, hour int) time.Time { return time.Date(2019, 4, d, hour, 0, 0, 0, time.UTC) }
+	three := 3.0
+
+	err := SetMetricEvents("pullRequestsMerged", []Event{
+		{OccurredAt: day(1, 9), SourceID: "a#1", Labels: map[string]string{"repository": "a"}},
+		{OccurredAt: day(1, 18), SourceID: "b#1", Labels: map[string]string{"repository": "b"}},
+		{OccurredAt: day(8, 9), Value: &three, Labels: map[string]string{"repository": "a"}},
+		{OccurredAt: day(30, 23)},
+	})
+	if err != nil {
+		t.Fatalf("failed to set events: %v", err)
+	}
+
+	t.Run("series of each bucket", func(t *testing.T) {
+		window := Dates(day(1, 0), day(30, 0))
+
+		for bucket, expected := range map[Bucket][]DateCount{
+			// 2019-04-01 is a Monday
+			Week: {
+				{JSONDate(day(1, 0)), 2}, {JSONDate(day(8, 0)), 3}, {JSONDate(day(15, 0)), 0},
+				{JSONDate(day(22, 0)), 0}, {JSONDate(day(29, 0)), 1},
+			},
+			Month: {{JSONDate(day(1, 0)), 6}},
+		} {
+			series, err := Series("pullRequestsMerged", window, bucket, nil)
+			if err != nil {
+				t.Fatalf("%s: %v", bucket, err)
+			}
+			assertDateCounts(t, string(bucket), expected, series)
+		}
+
+		days, err := Series("pullRequestsMerged", window, Day, nil)
+		if err != nil || len(days) != 30 || days[0].Count != 2 || days[7].Count != 3 || days[29].Count != 1 {
+			t.Errorf("expected 30 days, got %+v, %v", days, err)
+		}
+
+		// a window starting on a Wednesday still starts with its week
+		midweek, err := Series("pullRequestsMerged", Dates(day(3, 0), day(9, 0)), Week, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertDateCounts(t, "midweek", []DateCount{{JSONDate(day(1, 0)), 0}, {JSONDate(day(8, 0)), 3}}, midweek)
+	})
+
+	t.Run("filters", func(t *testing.T) {
+		series, err := Series("pullRequestsMerged", Dates(day(1, 0), day(8, 0)), Week,
+			Filters{"repository": "a"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertDateCounts(t, "repository a", []DateCount{{JSONDate(day(1, 0)), 1}, {JSONDate(day(8, 0)), 3}}, series)
+
+		total, err := Total("pullRequestsMerged", Window{}, Filters{"repository": "b"})
+		if err != nil || total != 1 {
+			t.Errorf("expected 1 for repository b, got %d, %v", total, err)
+		}
+
+		rows, err := MetricRows("pullRequestsMerged", Window{From: day(1, 12)}, nil)
+		if err != nil || len(rows) != 3 || !rows[0].Timestamp.Equal(day(1, 18)) {
+			t.Errorf("expected 3 rows from 1 April 18:00, got %+v, %v", rows, err)
+		}
+	})
+
+	t.Run("last and first occurred", func(t *testing.T) {
+		last, ok, err := LastOccurred("pullRequestsMerged", day(30, 0))
+		if err != nil || !ok || !last.Equal(day(8, 9)) {
+			t.Errorf("expected 8 April, got %v, %v, %v", last, ok, err)
+		}
+		if _, ok, err := LastOccurred("pullRequestsMerged", day(1, 0)); err != nil || ok {
+			t.Errorf("expected no event before 1 April, got %v, %v", ok, err)
+		}
+
+		first, err := FirstOccurredByLabel("pullRequestsMerged", "repository")
+		if err != nil || len(first) != 2 || !first["a"].Equal(day(1, 9)) || !first["b"].Equal(day(1, 18)) {
+			t.Errorf("expected a and b on 1 April, got %v, %v", first, err)
+		}
+	})
+
+	t.Run("imported days are kept", func(t *testing.T) {
+		err := MergeImportedDays(map[string][]Event{"pullRequestsMerged": {{OccurredAt: day(2, 9)}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SetMetricEvents("pullRequestsMerged", []Event{{OccurredAt: day(2, 9)}}); err != nil {
+			t.Fatal(err)
+		}
+		total, err := Total("pullRequestsMerged", Dates(day(2, 0), day(2, 0)), nil)
+		if err != nil || total != 1 {
+			t.Errorf("expected the imported event only, got %d, %v", total, err)
+		}
+	})
+
+	t.Run("imported and collected downloads", func(t *testing.T) {
+		count := func(n float64) *float64 { return &n }
+		version := func(v string) map[string]string { return map[string]string{"version": v} }
+
+		// the access logs only had downloads of 0.2.6
+		err := MergeImportedDays(map[string][]Event{"downloads": {
+			{OccurredAt: day(3, 0), Value: count(5), Labels: version("0.2.6")},
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = SetMetricEvents("downloads", []Event{
+			{OccurredAt: day(3, 0), Value: count(4), Labels: version("0.2.6")},
+			{OccurredAt: day(3, 0), Value: count(2), Labels: version("0.2.5")},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for v, expected := range map[string]int{"0.2.6": 5, "0.2.5": 2} {
+			total, err := Total("downloads", Window{}, Filters{"version": v})
+			if err != nil || total != expected {
+				t.Errorf("%s: expected %d downloads, got %d, %v", v, expected, total, err)
+			}
+		}
+	})
+
+	t.Run("imported days are merged", func(t *testing.T) {
+		count := func(n float64) *float64 { return &n }
+		path := func(p string) map[string]string { return map[string]string{"path": p} }
+
+		err := MergeImportedDays(map[string][]Event{
+			"pageViews": {
+				{OccurredAt: day(4, 0), Value: count(10), Labels: path("/download")},
+				{OccurredAt: day(4, 0), Value: count(3), Labels: path("/blog")},
+			},
+			"uniqueVisitors": {{OccurredAt: day(4, 0), Value: count(4), Labels: path("/download")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// later logs of the same day, only counting /download
+		err = MergeImportedDays(map[string][]Event{
+			"pageViews": {{OccurredAt: day(4, 0), Value: count(12), Labels: path("/download")}},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, test := range []struct {
+			metric   string
+			path     string
+			expected int
+		}{
+			{"pageViews", "/download", 12},
+			{"pageViews", "/blog", 3},
+			{"uniqueVisitors", "/download", 4},
+		} {
+			total, err := Total(test.metric, Dates(day(4, 0), day(4, 0)), Filters{"path": test.path})
+			if err != nil || total != test.expected {
+				t.Errorf("%s of %s: expected %d, got %d, %v", test.metric, test.path, test.expected, total, err)
+			}
+		}
+
+		err = MergeImportedDays(map[string][]Event{
+			"pageViews": {{OccurredAt: day(4, 0), Value: count(13), Labels: path("/download")}},
+			"nope":      {{OccurredAt: day(4, 0)}},
+		})
+		if err == nil {
+			t.Errorf("expected an error for an unknown metric")
+		}
+		if total, err := Total("pageViews", Dates(day(4, 0), day(4, 0)), Filters{"path": "/download"}); total != 12 {
+			t.Errorf("expected nothing to be stored, got %d, %v", total, err)
+		}
+	})
+}
+
+func TestSQLiteTables(t *testing.T) {
+	initializeSQLite(t)
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	t.Run("snapshots", func(t *testing.T) {
+		if err := SetMetricSnapshot("githubStars", 10, now.AddDate(0, 0, -1)); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetMetricSnapshot("githubStars", 11, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetMetricSnapshot("githubStars", 12, now); err != nil {
+			t.Fatal(err)
+		}
+
+		snapshots, err := MetricSnapshots("githubStars", nil, 1)
+		if err != nil || len(snapshots) != 1 || snapshots[0].Value != 12 {
+			t.Errorf("expected today's snapshot of 12, got %+v, %v", snapshots, err)
+		}
+
+		repository := map[string]string{"repository": "fluidkeys/fluidkeys"}
+		for _, value := range []float64{8, 9} {
+			if err := SetLabelledMetricSnapshot("githubStars", repository, value, now); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		snapshots, err = MetricSnapshots("githubStars", repository, 1)
+		if err != nil || len(snapshots) != 1 || snapshots[0].Value != 9 {
+			t.Errorf("expected today's snapshot of the repository of 9, got %+v, %v", snapshots, err)
+		}
+		snapshots, err = MetricSnapshots("githubStars", nil, 1)
+		if err != nil || len(snapshots) != 1 || snapshots[0].Value != 12 {
+			t.Errorf("expected the total to be kept separately, got %+v, %v", snapshots, err)
+		}
+	})
+
+	t.Run("funnel keeps the earliest event", func(t *testing.T) {
+		for _, occurredAt := range []time.Time{now, now.Add(-time.Hour), now.Add(time.Hour)} {
+			err := RecordFunnelEvents([]funnel.Event{{ContactHash: "a", Stage: funnel.Signup, OccurredAt: occurredAt}})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		events, err := FunnelEvents(now.AddDate(0, 0, -1))
+		if err != nil || len(events) != 1 || !events[0].OccurredAt.Equal(now.Add(-time.Hour)) {
+			t.Errorf("expected 1 event an hour ago, got %+v, %v", events, err)
+		}
+	})
+
+	t.Run("manual events", func(t *testing.T) {
+		if err := SetManualMetrics([]string{"interviews"}); err != nil {
+			t.Fatal(err)
+		}
+		defer SetManualMetrics(nil)
+
+		two := 2.0
+		recorded, err := RecordManualEvent(ManualEvent{Metric: "interviews", OccurredAt: now, Value: &two, Note: "Q2"})
+		if err != nil || recorded.ID == 0 {
+			t.Fatalf("expected an ID, got %+v, %v", recorded, err)
+		}
+
+		events, err := RecentManualEvents("interviews", 10)
+		if err != nil || len(events) != 1 || *events[0].Value != 2 || events[0].Note != "Q2" {
+			t.Errorf("expected the recorded event, got %+v, %v", events, err)
+		}
+	})
+
+	t.Run("teams", func(t *testing.T) {
+		err := SetTeams([]TeamRow{{UUID: "a", Name: "Imagine Corporation", MemberCount: 3, CreatedAt: now}}, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := SetTeams([]TeamRow{{UUID: "b", Name: "Flex Tech Inc.", MemberCount: 2}}, now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		teams, err := TeamRows()
+		if err != nil || len(teams) != 1 || teams[0].UUID != "b" || !teams[0].CreatedAt.IsZero() {
+			t.Errorf("expected only team b, got %+v, %v", teams, err)
+		}
+	})
+
+	t.Run("health", func(t *testing.T) {
+		ctx := context.Background()
+		if err := Ping(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if version, err := MigrationVersion(ctx); err != nil || version != LatestMigration {
+			t.Errorf("expected migration %d, got %d, %v", LatestMigration, version, err)
+		}
+
+		var busyTimeout int
+		if err := db.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil || busyTimeout != sqliteBusyTimeoutMs {
+			t.Errorf("expected a busy timeout of %dms, got %d, %v", sqliteBusyTimeoutMs, busyTimeout, err)
+		}
+
+		if run, err := LastCollectorRun(ctx, "GitHub"); err != nil || run != (CollectorRun{}) {
+			t.Errorf("expected GitHub never to have run, got %+v, %v", run, err)
+		}
+		for _, succeededAt := range []time.Time{now.Add(-time.Hour), now} {
+			if err := SetCollectorSucceeded("GitHub", succeededAt); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if run, err := LastCollectorRun(ctx, "GitHub"); err != nil || !run.SucceededAt.Equal(now) || run.Skipped() {
+			t.Errorf("expected GitHub to have succeeded now, got %+v, %v", run, err)
+		}
+
+		// another process collecting changes the data, after the teams were
+		// stored an hour from now
+		if err := SetCollectorSucceeded("teams", now.Add(2*time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if changedAt, err := LastChanged(); err != nil || !changedAt.Equal(now.Add(2*time.Hour)) {
+			t.Errorf("expected the data to have changed when teams succeeded, got %v, %v", changedAt, err)
+		}
+
+		if err := SetCollectorSkipped("GitHub", now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+		if run, err := LastCollectorRun(ctx, "GitHub"); err != nil || !run.SucceededAt.Equal(now) || !run.Skipped() {
+			t.Errorf("expected GitHub to have been skipped since it succeeded, got %+v, %v", run, err)
+		}
+	})
+
+	t.Run("alert states and responses", func(t *testing.T) {
+		if err := SetAlertState("signups", "firing", 0, now); err != nil {
+			t.Fatal(err)
+		}
+		if err := SetAlertState("signups", "resolved", 4, now); err != nil {
+			t.Fatal(err)
+		}
+		if state, err := AlertState("signups"); err != nil || state != "resolved" {
+			t.Errorf("expected resolved, got %s, %v", state, err)
+		}
+
+		if err := SetHTTPResponse("https://example.com", HTTPResponse{ETag: `"1"`, Body: []byte("[]")}, now); err != nil {
+			t.Fatal(err)
+		}
+		response, err := GetHTTPResponse("https://example.com")
+		if err != nil || response == nil || response.ETag != `"1"` || string(response.Body) != "[]" {
+			t.Errorf("expected the stored response, got %+v, %v", response, err)
+		}
+	})
+}
+
+func assertDateCounts(t *testing.T, name string, expected []DateCount, got []DateCount) {
+	t.Helper()
+	if len(got) != len(expected) {
+		t.Fatalf("%s: expected %d buckets, got %d: %+v", name, len(expected), len(got), got)
+	}
+	for i := range expected {
+		if !time.Time(got[i].Date).Equal(time.Time(expected[i].Date)) || got[i].Count != expected[i].Count {
+			t.Errorf("%s: bucket %d: expected %v %d, got %v %d", name, i, time.Time(expected[i].Date),
+				expected[i].Count, time.Time(got[i].Date), got[i].Count)
+		}
+	}
+}
+
+func TestSQLiteLastChanged(t *testing.T) {
+	initializeSQLite(t)
+
+	if changedAt, err := LastChanged(); err != nil || !changedAt.IsZero() {
+		t.Errorf("expected an empty database never to have changed, got %v, %v", changedAt, err)
+	}
+
+	// recorded_at is stored the same way as the other timestamps
+	before, _ := scanTime(formatTimestamp(time.Now()))
+	if err := SetManualMetrics([]string{"interviews"}); err != nil {
+		t.Fatal(err)
+	}
+	defer SetManualMetrics(nil)
+	if _, err := RecordManualEvent(ManualEvent{Metric: "interviews", OccurredAt: before.AddDate(0, 0, -1)}); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := scanTime(formatTimestamp(time.Now()))
+	if changedAt, err := LastChanged(); err != nil || changedAt.Before(before) || changedAt.After(after) {
+		t.Errorf("expected the manual event to change the data between %v and %v, got %v, %v",
+			before, after, changedAt, err)
+	}
+
+	if err := SetMetricSnapshot("githubStars", 10, after.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if changedAt, err := LastChanged(); err != nil || !changedAt.Equal(after.Add(time.Hour)) {
+		t.Errorf("expected the snapshot to change the data, got %v, %v", changedAt, err)
+	}
+
+	if err := SetTeams([]TeamRow{{UUID: "a", Name: "Imagine Corporation", MemberCount: 3}}, after.Add(2*time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if changedAt, err := LastChanged(); err != nil || !changedAt.Equal(after.Add(2*time.Hour)) {
+		t.Errorf("expected the teams to change the data, got %v, %v", changedAt, err)
+	}
+}
+
+func TestSQLiteSnapshotsWithoutLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dashboard.db")
+
+	// as created before migration 014
+	old, err := sql.Open(sqliteDriverName, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = old.Exec(`CREATE TABLE metric_snapshots (
+	                     id INTEGER PRIMARY KEY AUTOINCREMENT,
+	                     metric TEXT NOT NULL,
+	                     taken_on DATE NOT NULL,
+	                     taken_at TIMESTAMP NOT NULL,
+	                     value DOUBLE PRECISION NOT NULL,
+	                     UNIQUE (metric, taken_on)
+	                   );
+	                   INSERT INTO metric_snapshots(metric, taken_on, taken_at, value)
+	                   VALUES ('githubStars', date('now'), datetime('now'), 12)`)
+	old.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Initialize("sqlite://" + path); err != nil {
+		t.Fatalf("failed to open SQLite: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		sqlDialect = postgres{}
+	})
+
+	repository := map[string]string{"repository": "fluidkeys/fluidkeys"}
+	if err := SetLabelledMetricSnapshot("githubStars", repository, 9, time.Now().UTC()); err != nil {
+		t.Fatalf("expected the table to have labels, got %v", err)
+	}
+
+	snapshots, err := MetricSnapshots("githubStars", nil, 1)
+	if err != nil || len(snapshots) != 1 || snapshots[0].Value != 12 {
+		t.Errorf("expected the existing snapshot to be kept as the total, got %+v, %v", snapshots, err)
+	}
+}
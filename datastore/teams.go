@@ -0,0 +1,102 @@
+package datastore
+
+import (
+	"database/sql"
+	"strconv"
+	"time"
+
+	"github.com/fluidkeys/dashboard/models"
+)
+
+// TeamRow is a Fluidkeys team as stored by the teams collector
+type TeamRow struct {
+	UUID        string
+	Name        string
+	MemberCount int
+
+	// CreatedAt is zero if the server didn't say
+	CreatedAt time.Time
+}
+
+// SetTeams replaces the stored teams with the given ones, keeping the ID of
+// any team that's already stored.
+// This is done in a transaction so a failure will rollback to the original state
+func SetTeams(teams []TeamRow, now time.Time) error {
+	transaction, err := db.Begin()
+	if err != nil {
+		return err
+	}
+
+	query := `INSERT INTO teams(uuid, name, member_count, created_at, last_seen_at)
+	          VALUES($1, $2, $3, $4, $5)
+		  ON CONFLICT (uuid) DO UPDATE
+		  SET name = EXCLUDED.name,
+		      member_count = EXCLUDED.member_count,
+		      created_at = EXCLUDED.created_at,
+		      last_seen_at = EXCLUDED.last_seen_at`
+
+	seenAt := formatTimestamp(now)
+
+	for _, team := range teams {
+		_, err := transaction.Exec(query, team.UUID, team.Name, team.MemberCount,
+			nullableTimestamp(team.CreatedAt), seenAt)
+		if err != nil {
+			transaction.Rollback()
+			return err
+		}
+	}
+
+	// teams that weren't in the list have been deleted
+	if _, err := transaction.Exec(`DELETE FROM teams WHERE last_seen_at <> $1`, seenAt); err != nil {
+		transaction.Rollback()
+		return err
+	}
+
+	if err := transaction.Commit(); err != nil {
+		return err
+	}
+	notifyChanged()
+	return nil
+}
+
+// TeamRows returns every stored team, ordered by name
+func TeamRows() ([]TeamRow, error) {
+	rows, err := db.Query(`SELECT uuid, name, member_count, created_at FROM teams ORDER BY name ASC, uuid ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []TeamRow{}
+	for rows.Next() {
+		team := TeamRow{}
+		var createdAt sql.NullTime
+		if err := rows.Scan(&team.UUID, &team.Name, &team.MemberCount, &createdAt); err != nil {
+			return nil, err
+		}
+		team.CreatedAt = createdAt.Time
+		teams = append(teams, team)
+	}
+	return teams, rows.Err()
+}
+
+// AllTeams returns every stored team, ordered by name
+func AllTeams() ([]*models.Team, error) {
+	rows, err := db.Query(`SELECT id, name, uuid FROM teams ORDER BY name ASC, uuid ASC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	teams := []*models.Team{}
+	for rows.Next() {
+		var id int64
+		team := models.Team{}
+		if err := rows.Scan(&id, &team.Name, &team.UUID); err != nil {
+			return nil, err
+		}
+		team.ID = strconv.FormatInt(id, 10)
+		teams = append(teams, &team)
+	}
+	return teams, rows.Err()
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// callsArrangedNext7Days returns the number of calls arranged for the 7 days
+// after now
+func callsArrangedNext7Days(now time.Time) (uint, error) {
+	now = now.UTC()
+	count, err := datastore.Total("calls", datastore.Window{From: now, To: now.AddDate(0, 0, 7)}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return uint(count), nil
+}
+
+// errNoReleases means there's no release to count the days since yet
+var errNoReleases = errors.New("no releases have been announced")
+
+// daysSinceLastRelease returns the number of whole days since the most recent
+// release was announced, or errNoReleases
+func daysSinceLastRelease(now time.Time) (uint, error) {
+	now = now.UTC()
+	last, ok, err := datastore.LastOccurred("releases", now)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, errNoReleases
+	}
+	return wholeDaysBetween(last, now), nil
+}
+
+func wholeDaysBetween(from time.Time, to time.Time) uint {
+	if to.Before(from) {
+		return 0
+	}
+	return uint(to.Sub(from).Hours() / 24)
+}
+
+// netGrowth returns the signups minus the unsubscribes on each date, which
+// can be negative. Both series must cover the same dates.
+func netGrowth(signups []datastore.DateCount, unsubscribes []datastore.DateCount) ([]datastore.DateCount, error) {
+	if len(signups) != len(unsubscribes) {
+		return nil, fmt.Errorf("%d dates of signups but %d of unsubscribes", len(signups), len(unsubscribes))
+	}
+
+	growth := []datastore.DateCount{}
+	for i := range signups {
+		growth = append(growth, datastore.DateCount{
+			Date:  signups[i].Date,
+			Count: signups[i].Count - unsubscribes[i].Count,
+		})
+	}
+	return growth, nil
+}
+
+// listSize returns the size of the list at the end of each date, given its
+// size before the first date and its growth on each date
+func listSize(sizeBefore int, growth []datastore.DateCount) []datastore.DateCount {
+	sizes := []datastore.DateCount{}
+	size := sizeBefore
+	for _, dateCount := range growth {
+		size += dateCount.Count
+		sizes = append(sizes, datastore.DateCount{Date: dateCount.Date, Count: size})
+	}
+	return sizes
+}
+
+// listSizeBefore returns all the signups before t minus all the unsubscribes
+func listSizeBefore(t time.Time) (int, error) {
+	signups, err := datastore.Total("signups", datastore.Window{To: t}, nil)
+	if err != nil {
+		return 0, err
+	}
+	unsubscribes, err := datastore.Total("unsubscribes", datastore.Window{To: t}, nil)
+	if err != nil {
+		return 0, err
+	}
+	return signups - unsubscribes, nil
+}
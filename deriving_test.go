@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+func TestNetGrowthAndListSize(t *testing.T) {
+	day := func(d int) datastore.JSONDate { return datastore.JSONDate(time.Date(2019, 4, d, 0, 0, 0, 0, time.UTC)) }
+
+	signups := []datastore.DateCount{{Date: day(1), Count: 3}, {Date: day(2), Count: 0}, {Date: day(3), Count: 1}}
+	unsubscribes := []datastore.DateCount{{Date: day(1), Count: 1}, {Date: day(2), Count: 2}, {Date: day(3), Count: 0}}
+
+	growth, err := netGrowth(signups, unsubscribes)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	assertCounts(t, []int{2, -2, 1}, growth)
+	assertCounts(t, []int{12, 10, 11}, listSize(10, growth))
+
+	if _, err := netGrowth(signups, unsubscribes[1:]); err == nil {
+		t.Errorf("expected error for series of different lengths")
+	}
+}
+
+func TestWholeDaysBetween(t *testing.T) {
+	release := time.Date(2019, 3, 25, 14, 0, 0, 0, time.UTC)
+
+	for _, test := range []struct {
+		now      time.Time
+		expected uint
+	}{
+		{time.Date(2019, 3, 25, 18, 0, 0, 0, time.UTC), 0},
+		{time.Date(2019, 3, 26, 13, 59, 0, 0, time.UTC), 0},
+		{time.Date(2019, 4, 1, 14, 0, 0, 0, time.UTC), 7},
+		{time.Date(2019, 3, 24, 0, 0, 0, 0, time.UTC), 0},
+	} {
+		if got := wholeDaysBetween(release, test.now); got != test.expected {
+			t.Errorf("%v: expected %d, got %d", test.now, test.expected, got)
+		}
+	}
+}
+
+func assertCounts(t *testing.T, expected []int, got []datastore.DateCount) {
+	t.Helper()
+
+	if len(expected) != len(got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if expected[i] != got[i].Count {
+			t.Errorf("date %d: expected %d, got %d", i, expected[i], got[i].Count)
+		}
+	}
+}
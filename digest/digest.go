@@ -0,0 +1,122 @@
+// Package digest renders the weekly summary of the dashboard metrics and sends
+// it by email.
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+// Summary is everything that goes into one weekly digest
+type Summary struct {
+	WeekStarting time.Time
+	WeekEnding   time.Time
+
+	Totals []Total
+
+	CallsArrangedNext7Days uint
+	CallsArrangedStatus    rag.Status
+
+	DaysUntilNextReleaseDue int
+	ReleaseDueStatus        rag.Status
+
+	ReleasesShipped int
+	CallsHeld       int
+}
+
+// Total compares a metric's total for this week with the week before
+type Total struct {
+	Name     string
+	ThisWeek int
+	LastWeek int
+}
+
+// Change returns the difference between this week and last week
+func (t Total) Change() int {
+	return t.ThisWeek - t.LastWeek
+}
+
+// ChangeDescription returns the week-over-week change as e.g. "+3 (+50%)"
+func (t Total) ChangeDescription() string {
+	if t.LastWeek == 0 {
+		return fmt.Sprintf("%+d", t.Change())
+	}
+	percent := 100 * float64(t.Change()) / float64(t.LastWeek)
+	return fmt.Sprintf("%+d (%+d%%)", t.Change(), int(math.Round(percent)))
+}
+
+// Subject returns the email subject line for the digest
+func (s Summary) Subject() string {
+	return "Fluidkeys weekly digest: week ending " + s.WeekEnding.Format("2 January 2006")
+}
+
+// Render returns the HTML and plain text versions of the digest
+func Render(summary Summary) (htmlBody string, textBody string, err error) {
+	var htmlBuffer, textBuffer bytes.Buffer
+
+	if err := htmlTemplate.Execute(&htmlBuffer, summary); err != nil {
+		return "", "", err
+	}
+	if err := textTemplate.Execute(&textBuffer, summary); err != nil {
+		return "", "", err
+	}
+	return htmlBuffer.String(), textBuffer.String(), nil
+}
+
+func absInt(number int) int {
+	if number < 0 {
+		return -number
+	}
+	return number
+}
+
+var templateFuncs = map[string]interface{}{
+	"date": func(t time.Time) string { return t.Format("Mon 2 Jan") },
+	"abs":  absInt,
+}
+
+var htmlTemplate = htmltemplate.Must(htmltemplate.New("html").Funcs(templateFuncs).Parse(`<!doctype html>
+<html>
+<body style="font-family: Helvetica, Arial, sans-serif;">
+  <h1>Fluidkeys weekly digest</h1>
+  <p>{{date .WeekStarting}} to {{date .WeekEnding}}</p>
+
+  <table cellpadding="6">
+    <tr><th align="left">Metric</th><th align="right">This week</th><th align="right">Last week</th><th align="right">Change</th></tr>
+    {{- range .Totals}}
+    <tr><td>{{.Name}}</td><td align="right">{{.ThisWeek}}</td><td align="right">{{.LastWeek}}</td><td align="right">{{.ChangeDescription}}</td></tr>
+    {{- end}}
+    <tr><td>Releases shipped</td><td align="right">{{.ReleasesShipped}}</td><td></td><td></td></tr>
+    <tr><td>Calls held</td><td align="right">{{.CallsHeld}}</td><td></td><td></td></tr>
+  </table>
+
+  <h2>Status</h2>
+  <ul>
+    <li class="{{.CallsArrangedStatus}}">{{.CallsArrangedNext7Days}} calls arranged in the next 7 days: <strong>{{.CallsArrangedStatus}}</strong></li>
+    <li class="{{.ReleaseDueStatus}}">
+      {{- if lt .DaysUntilNextReleaseDue 0}}{{abs .DaysUntilNextReleaseDue}} days overdue to release{{else}}{{.DaysUntilNextReleaseDue}} days until release is due{{end}}:
+      <strong>{{.ReleaseDueStatus}}</strong></li>
+  </ul>
+</body>
+</html>
+`))
+
+var textTemplate = texttemplate.Must(texttemplate.New("text").Funcs(templateFuncs).Parse(`Fluidkeys weekly digest
+{{date .WeekStarting}} to {{date .WeekEnding}}
+
+{{range .Totals -}}
+{{.Name}}: {{.ThisWeek}} (last week {{.LastWeek}}, {{.ChangeDescription}})
+{{end -}}
+Releases shipped: {{.ReleasesShipped}}
+Calls held: {{.CallsHeld}}
+
+Status
+* {{.CallsArrangedNext7Days}} calls arranged in the next 7 days: {{.CallsArrangedStatus}}
+* {{if lt .DaysUntilNextReleaseDue 0}}{{abs .DaysUntilNextReleaseDue}} days overdue to release{{else}}{{.DaysUntilNextReleaseDue}} days until release is due{{end}}: {{.ReleaseDueStatus}}
+`))
@@ -0,0 +1,143 @@
+package digest
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+var exampleSummary = Summary{
+	WeekStarting: time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC),
+	WeekEnding:   time.Date(2019, 4, 7, 0, 0, 0, 0, time.UTC),
+	Totals: []Total{
+		{Name: "Release note signups", ThisWeek: 6, LastWeek: 4},
+		{Name: "Trials started", ThisWeek: 1, LastWeek: 0},
+	},
+	CallsArrangedNext7Days:  2,
+	CallsArrangedStatus:     rag.Red,
+	DaysUntilNextReleaseDue: -3,
+	ReleaseDueStatus:        rag.Amber,
+	ReleasesShipped:         1,
+	CallsHeld:               5,
+}
+
+func TestRender(t *testing.T) {
+	htmlBody, textBody, err := Render(exampleSummary)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for _, expected := range []string{
+		"Release note signups: 6 (last week 4, +2 (+50%))",
+		"Trials started: 1 (last week 0, +1)",
+		"Calls held: 5",
+		"2 calls arranged in the next 7 days: red",
+		"3 days overdue to release: amber",
+	} {
+		if !strings.Contains(textBody, expected) {
+			t.Errorf("expected text body to contain %q, got:\n%s", expected, textBody)
+		}
+	}
+
+	if !strings.Contains(htmlBody, "<td>Release note signups</td>") {
+		t.Errorf("expected HTML body to contain signups row, got:\n%s", htmlBody)
+	}
+}
+
+func TestSend(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go runSMTPSink(t, listener, received)
+
+	host, port, _ := net.SplitHostPort(listener.Addr().String())
+	config := SMTPConfig{
+		Host: host,
+		Port: port,
+		From: "dashboard@example.com",
+		To:   []string{"team@example.com"},
+	}
+
+	htmlBody, textBody, _ := Render(exampleSummary)
+	if err := Send(config, exampleSummary.Subject(), htmlBody, textBody); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	message := <-received
+	for _, expected := range []string{
+		"Subject: Fluidkeys weekly digest: week ending 7 April 2019",
+		"Content-Type: multipart/alternative",
+		"Content-Type: text/plain; charset=utf-8",
+		"Content-Type: text/html; charset=utf-8",
+		"Calls held: 5",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("expected message to contain %q, got:\n%s", expected, message)
+		}
+	}
+}
+
+// runSMTPSink accepts a single SMTP conversation and sends the message data
+// to `received`
+func runSMTPSink(t *testing.T, listener net.Listener, received chan<- string) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 localhost ESMTP sink")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+
+		switch command := strings.ToUpper(strings.SplitN(line, " ", 2)[0]); command {
+		case "EHLO", "HELO":
+			text.PrintfLine("250 localhost")
+		case "MAIL", "RCPT", "RSET", "NOOP":
+			text.PrintfLine("250 OK")
+		case "DATA":
+			text.PrintfLine("354 go ahead")
+			data, err := readDotLines(text.R)
+			if err != nil {
+				t.Errorf("failed to read DATA: %v", err)
+				return
+			}
+			received <- data
+			text.PrintfLine("250 OK")
+		case "QUIT":
+			text.PrintfLine("221 bye")
+			return
+		default:
+			text.PrintfLine("502 not implemented")
+		}
+	}
+}
+
+func readDotLines(reader *bufio.Reader) (string, error) {
+	var lines []string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "." {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+	}
+}
@@ -0,0 +1,93 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"strings"
+	"time"
+)
+
+// SMTPConfig says which SMTP server to send the digest through and who to
+// send it to
+type SMTPConfig struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+	To       []string
+}
+
+// Send emails the digest as a multipart/alternative message with both the
+// plain text and HTML versions
+func Send(config SMTPConfig, subject string, htmlBody string, textBody string) error {
+	if len(config.To) == 0 {
+		return fmt.Errorf("no recipients for digest")
+	}
+
+	message, err := buildMessage(config.From, config.To, subject, htmlBody, textBody)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+
+	address := net.JoinHostPort(config.Host, config.Port)
+	if err := smtp.SendMail(address, auth, config.From, config.To, message); err != nil {
+		return fmt.Errorf("failed to send digest via %s: %v", address, err)
+	}
+	return nil
+}
+
+func buildMessage(from string, to []string, subject string, htmlBody string, textBody string) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		// least preferred first, per RFC 2046
+		{"text/plain; charset=utf-8", textBody},
+		{"text/html; charset=utf-8", htmlBody},
+	}
+
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{
+			"Content-Type": {part.contentType},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if _, err := partWriter.Write([]byte(crlf(part.content))); err != nil {
+			return nil, err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	var message bytes.Buffer
+	fmt.Fprintf(&message, "From: %s\r\n", from)
+	fmt.Fprintf(&message, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&message, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&message, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&message, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&message, "Content-Type: multipart/alternative; boundary=%s\r\n", writer.Boundary())
+	fmt.Fprintf(&message, "\r\n")
+	message.Write(body.Bytes())
+
+	return message.Bytes(), nil
+}
+
+// crlf converts bare newlines to CRLF as required by SMTP
+func crlf(text string) string {
+	return strings.Replace(strings.Replace(text, "\r\n", "\n", -1), "\n", "\r\n", -1)
+}
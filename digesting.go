@@ -0,0 +1,156 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/digest"
+	"github.com/fluidkeys/dashboard/rag"
+)
+
+// runDigest renders the weekly digest and emails it to DIGEST_TO.
+//
+// If DIGEST_WEEKDAY is set (e.g. "Monday") it only sends on that day, so it can
+// be run daily from a scheduler.
+func runDigest(arguments []string) exitCode {
+	flags := flag.NewFlagSet("digest", flag.ExitOnError)
+	toStdout := flags.Bool("stdout", false, "print the digest instead of emailing it")
+	force := flags.Bool("force", false, "send even if today isn't DIGEST_WEEKDAY")
+	flags.Parse(arguments)
+
+	now := time.Now()
+
+	if weekday, got := os.LookupEnv("DIGEST_WEEKDAY"); got && !*force && !*toStdout {
+		if !strings.EqualFold(weekday, now.Weekday().String()) {
+			fmt.Printf("Not sending digest: today is %s, DIGEST_WEEKDAY is %s\n", now.Weekday(), weekday)
+			return 0
+		}
+	}
+
+	summary, err := getDigestSummary(now)
+	if err != nil {
+		fmt.Printf("Failed to get metrics for digest: %v\n", err)
+		return 1
+	}
+
+	htmlBody, textBody, err := digest.Render(*summary)
+	if err != nil {
+		fmt.Printf("Failed to render digest: %v\n", err)
+		return 1
+	}
+
+	if *toStdout {
+		fmt.Print(textBody)
+		return 0
+	}
+
+	config, err := getSMTPConfig()
+	if err != nil {
+		fmt.Print(err.Error() + "\n")
+		return 1
+	}
+
+	if err := digest.Send(*config, summary.Subject(), htmlBody, textBody); err != nil {
+		fmt.Print(err.Error() + "\n")
+		return 1
+	}
+
+	fmt.Printf("Sent digest to %s\n", strings.Join(config.To, ", "))
+	return 0
+}
+
+// getDigestSummary returns the digest for the 7 days up to and including today
+func getDigestSummary(now time.Time) (*digest.Summary, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	thisWeekStart := today.AddDate(0, 0, -6)
+	thisWeekEnd := today.AddDate(0, 0, 1)
+	lastWeekStart := thisWeekStart.AddDate(0, 0, -7)
+
+	summary := digest.Summary{
+		WeekStarting: thisWeekStart,
+		WeekEnding:   today,
+	}
+
+	weeklyTotals := []struct {
+		name   string
+		metric string
+	}{
+		{"Release note signups", "signups"},
+		{"Release note unsubscribes", "unsubscribes"},
+		{"Trials started", "trials"},
+	}
+
+	thisWeekWindow := datastore.Window{From: thisWeekStart, To: thisWeekEnd}
+	lastWeekWindow := datastore.Window{From: lastWeekStart, To: thisWeekStart}
+
+	for _, weeklyTotal := range weeklyTotals {
+		thisWeek, err := datastore.Total(weeklyTotal.metric, thisWeekWindow, nil)
+		if err != nil {
+			return nil, err
+		}
+		lastWeek, err := datastore.Total(weeklyTotal.metric, lastWeekWindow, nil)
+		if err != nil {
+			return nil, err
+		}
+		summary.Totals = append(summary.Totals, digest.Total{
+			Name: weeklyTotal.name, ThisWeek: thisWeek, LastWeek: lastWeek,
+		})
+	}
+
+	var err error
+
+	summary.ReleasesShipped, err = datastore.Total("releases", thisWeekWindow, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.CallsHeld, err = datastore.Total("calls", datastore.Window{From: thisWeekStart, To: now}, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.CallsArrangedNext7Days, err = callsArrangedNext7Days(now)
+	if err != nil {
+		return nil, err
+	}
+	summary.CallsArrangedStatus = rag.CallsArranged(summary.CallsArrangedNext7Days)
+
+	daysSinceLastRelease, err := daysSinceLastRelease(now)
+	if err != nil {
+		return nil, err
+	}
+	summary.DaysUntilNextReleaseDue = rag.DaysUntilNextReleaseDue(daysSinceLastRelease)
+	summary.ReleaseDueStatus = rag.ReleaseDue(daysSinceLastRelease)
+
+	return &summary, nil
+}
+
+// getSMTPConfig reads the SMTP server and recipients from the environment
+func getSMTPConfig() (*digest.SMTPConfig, error) {
+	config := digest.SMTPConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Port:     os.Getenv("SMTP_PORT"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("DIGEST_FROM"),
+		To:       splitEnvList("DIGEST_TO"),
+	}
+
+	if config.Host == "" {
+		return nil, fmt.Errorf("Missing SMTP_HOST environment variable")
+	}
+	if config.Port == "" {
+		config.Port = "25"
+	}
+	if config.From == "" {
+		return nil, fmt.Errorf("Missing DIGEST_FROM environment variable")
+	}
+	if len(config.To) == 0 {
+		return nil, fmt.Errorf("Missing DIGEST_TO environment variable")
+	}
+	return &config, nil
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// downloadsMetric has an event for each day and release version with the
+// number of downloads as its value, labelled e.g. {"version": "0.2.6"}
+const downloadsMetric = "downloads"
+
+// uptakeDays is how many days after each release /api/releases/downloads
+// charts, unless `days` is given
+const uptakeDays = 30
+
+var validVersion = regexp.MustCompile(`^v?(\d+(?:\.\d+)+(?:[-+][0-9A-Za-z.-]+)?)$`)
+
+// syncDownloads records the daily downloads of each release from the JSON
+// stats endpoint at DOWNLOAD_STATS_URL, sending DOWNLOAD_STATS_TOKEN as a
+// bearer token if it's set. It's skipped unless DOWNLOAD_STATS_URL is set;
+// `dashboard ingest-logs --downloads` counts them from access logs instead.
+func syncDownloads(ctx context.Context, clients apiClients, store collectorStore) error {
+	statsURL, got := os.LookupEnv("DOWNLOAD_STATS_URL")
+	if !got {
+		fmt.Print("Skipping downloads: no DOWNLOAD_STATS_URL environment variable\n")
+		return errSkipped
+	}
+
+	downloads, err := getDownloadStats(ctx, clients.web, statsURL, os.Getenv("DOWNLOAD_STATS_TOKEN"))
+	if err != nil {
+		return err
+	}
+
+	return store.SetMetricEvents(downloadsMetric, downloads)
+}
+
+// getDownloadStats reads download counts from a stats endpoint returning e.g.
+//
+//	{"downloads": [{"version": "0.2.6", "date": "2019-03-27", "count": 42}, ...]}
+func getDownloadStats(ctx context.Context, client *http.Client, statsURL string, token string) (
+	[]datastore.Event, error) {
+
+	request, err := http.NewRequest("GET", statsURL, nil)
+	if err != nil {
+		return nil, configErrorf("invalid DOWNLOAD_STATS_URL '%s': %v", statsURL, err)
+	}
+	if token != "" {
+		request.Header.Set("authorization", "Bearer "+token)
+	}
+
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, sourceErrorf("failed to get download stats: %w", err)
+	}
+	defer response.Body.Close()
+
+	if err := statusError("failed to get download stats", response); err != nil {
+		return nil, err
+	}
+
+	body := struct {
+		Downloads []struct {
+			Version string `json:"version"`
+			Date    string `json:"date"`
+			Count   *int   `json:"count"`
+		} `json:"downloads"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, parseErrorf("failed to parse download stats: %v", err)
+	}
+	if body.Downloads == nil {
+		return nil, parseErrorf("failed to parse download stats: no downloads in response")
+	}
+
+	downloads := []datastore.Event{}
+	for i, row := range body.Downloads {
+		match := validVersion.FindStringSubmatch(row.Version)
+		if match == nil {
+			return nil, parseErrorf("invalid version '%s' in download stats row %d", row.Version, i+1)
+		}
+		date, err := time.Parse("2006-01-02", row.Date)
+		if err != nil {
+			return nil, parseErrorf("invalid date '%s' in download stats row %d", row.Date, i+1)
+		}
+		if row.Count == nil || *row.Count < 0 {
+			return nil, parseErrorf("missing or negative count in download stats row %d", i+1)
+		}
+
+		count := float64(*row.Count)
+		downloads = append(downloads, datastore.Event{
+			OccurredAt: date,
+			Value:      &count,
+			Labels:     map[string]string{"version": match[1]},
+		})
+	}
+	return downloads, nil
+}
+
+// releaseDownloads is a release's uptake: its downloads on each day after it
+// was released
+type releaseDownloads struct {
+	Version string `json:"version"`
+
+	// ReleasedAt is missing for versions that were never announced
+	ReleasedAt *datastore.JSONDate `json:"releasedAt,omitempty"`
+
+	// Downloads is the total of all time
+	Downloads int `json:"downloads"`
+
+	// Series starts on the day of the release, or of its first download if
+	// it wasn't announced
+	Series []datastore.DateCount `json:"series"`
+}
+
+// handleReleaseDownloads serves /api/releases/downloads: the downloads of
+// each version, newest release first, each with a series of the `days`
+// days (default 30) from its release
+func handleReleaseDownloads(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	days := uptakeDays
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		var err error
+		days, err = strconv.Atoi(daysParam)
+		if err != nil || days < 1 || days > 366 {
+			http.Error(w, "invalid days, expected a number from 1 to 366", http.StatusBadRequest)
+			return
+		}
+	}
+
+	releases, err := getReleaseDownloads(days, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	writeJSON(w, releases)
+}
+
+// getReleaseDownloads joins the downloads of each version to its release
+// announcement
+func getReleaseDownloads(days int, now time.Time) ([]releaseDownloads, error) {
+	released, err := datastore.FirstOccurredByLabel("releases", "version")
+	if err != nil {
+		return nil, err
+	}
+	firstDownloaded, err := datastore.FirstOccurredByLabel(downloadsMetric, "version")
+	if err != nil {
+		return nil, err
+	}
+
+	starts := releaseStarts(released, firstDownloaded)
+	tomorrow := datastore.LastNDays(1, now).To
+
+	releases := []releaseDownloads{}
+	for _, start := range starts {
+		release := releaseDownloads{Version: start.version}
+		if releasedAt, ok := released[start.version]; ok {
+			date := datastore.JSONDate(releasedAt)
+			release.ReleasedAt = &date
+		}
+
+		filters := datastore.Filters{"version": start.version}
+
+		if release.Downloads, err = datastore.Total(downloadsMetric, datastore.Window{}, filters); err != nil {
+			return nil, err
+		}
+
+		window := datastore.Window{From: start.day, To: start.day.AddDate(0, 0, days)}
+		if window.To.After(tomorrow) {
+			window.To = tomorrow
+		}
+		release.Series = []datastore.DateCount{}
+		if window.From.Before(window.To) {
+			if release.Series, err = datastore.Series(downloadsMetric, window, datastore.Day, filters); err != nil {
+				return nil, err
+			}
+		}
+
+		releases = append(releases, release)
+	}
+	return releases, nil
+}
+
+type releaseStart struct {
+	version string
+
+	// day is midnight UTC
+	day time.Time
+}
+
+// releaseStarts returns each version that was released or downloaded, with
+// the day its uptake starts: when it was released, or else when it was first
+// downloaded. The newest come first.
+func releaseStarts(released map[string]time.Time, firstDownloaded map[string]time.Time) []releaseStart {
+	starts := []releaseStart{}
+	for version, releasedAt := range released {
+		starts = append(starts, releaseStart{version: version, day: releasedAt.UTC().Truncate(24 * time.Hour)})
+	}
+	for version, downloadedAt := range firstDownloaded {
+		if _, ok := released[version]; !ok {
+			starts = append(starts, releaseStart{version: version, day: downloadedAt.UTC().Truncate(24 * time.Hour)})
+		}
+	}
+
+	sort.Slice(starts, func(i, j int) bool {
+		if !starts[i].day.Equal(starts[j].day) {
+			return starts[i].day.After(starts[j].day)
+		}
+		return starts[i].version > starts[j].version
+	})
+	return starts
+}
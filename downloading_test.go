@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/fakeapi"
+)
+
+const testDownloadStatsURL = "https://downloads.fluidkeys.com/stats.json"
+
+func TestGetDownloadStats(t *testing.T) {
+	t.Run("reads each day and version", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+		fake.SetFile("/stats.json", "application/json", `{"downloads": [
+			{"version": "0.2.6", "date": "2019-03-26", "count": 42},
+			{"version": "v0.2.6", "date": "2019-03-27", "count": 17},
+			{"version": "0.2.5", "date": "2019-03-27", "count": 0}
+		]}`)
+
+		downloads, err := getDownloadStats(context.Background(), fake.Client(), testDownloadStatsURL, "")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertEventTimes(t, []time.Time{
+			time.Date(2019, 3, 26, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, 3, 27, 0, 0, 0, 0, time.UTC),
+			time.Date(2019, 3, 27, 0, 0, 0, 0, time.UTC),
+		}, downloads)
+
+		if *downloads[0].Value != 42 || downloads[1].Labels["version"] != "0.2.6" {
+			t.Errorf("expected counts labelled with the version without a 'v', got %+v", downloads)
+		}
+	})
+
+	for _, test := range []struct {
+		name         string
+		body         string
+		failStatus   int
+		expectedKind errorKind
+	}{
+		{"invalid version", `{"downloads": [{"version": "latest", "date": "2019-03-26", "count": 1}]}`, 0, parseError},
+		{"invalid date", `{"downloads": [{"version": "0.2.6", "date": "26/03/2019", "count": 1}]}`, 0, parseError},
+		{"missing count", `{"downloads": [{"version": "0.2.6", "date": "2019-03-26"}]}`, 0, parseError},
+		{"not stats", `{"error": "oops"}`, 0, parseError},
+		{"unauthorized", `{"downloads": []}`, http.StatusUnauthorized, authError},
+		{"unavailable", `{"downloads": []}`, http.StatusServiceUnavailable, sourceError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakeapi.NewServer()
+			defer fake.Close()
+			fake.SetFile("/stats.json", "application/json", test.body)
+			if test.failStatus != 0 {
+				fake.FailNext("/stats.json", test.failStatus, "")
+			}
+
+			_, err := getDownloadStats(context.Background(), fake.Client(), testDownloadStatsURL, "")
+			assertErrorKind(t, err, test.expectedKind)
+		})
+	}
+}
+
+func TestReleaseStarts(t *testing.T) {
+	released := map[string]time.Time{
+		"0.2.5": time.Date(2019, 2, 12, 0, 0, 0, 0, time.UTC),
+		"0.2.6": time.Date(2019, 3, 26, 10, 0, 0, 0, time.UTC),
+	}
+	firstDownloaded := map[string]time.Time{
+		"0.2.6": time.Date(2019, 3, 25, 0, 0, 0, 0, time.UTC), // a pre-release download
+		"0.2.4": time.Date(2019, 1, 7, 0, 0, 0, 0, time.UTC),  // never announced
+	}
+
+	starts := releaseStarts(released, firstDownloaded)
+
+	expected := []releaseStart{
+		{"0.2.6", time.Date(2019, 3, 26, 0, 0, 0, 0, time.UTC)},
+		{"0.2.5", time.Date(2019, 2, 12, 0, 0, 0, 0, time.UTC)},
+		{"0.2.4", time.Date(2019, 1, 7, 0, 0, 0, 0, time.UTC)},
+	}
+	if len(starts) != len(expected) {
+		t.Fatalf("expected %+v, got %+v", expected, starts)
+	}
+	for i := range expected {
+		if starts[i].version != expected[i].version || !starts[i].day.Equal(expected[i].day) {
+			t.Errorf("expected %+v, got %+v", expected[i], starts[i])
+		}
+	}
+}
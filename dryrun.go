@@ -0,0 +1,236 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/funnel"
+)
+
+// collectorStore is where the collectors save what they fetch
+type collectorStore interface {
+	// SetMetricTimes replaces all the rows of a metric, e.g. "signups"
+	SetMetricTimes(metric string, times []time.Time) error
+
+	// SetMetricEvents is SetMetricTimes for events with a value, source ID
+	// or labels
+	SetMetricEvents(metric string, events []datastore.Event) error
+
+	// SetMetricSnapshot records today's value of a scalar metric
+	SetMetricSnapshot(metric string, value float64, takenAt time.Time) error
+
+	// SetLabelledMetricSnapshot records today's value of one part of a
+	// scalar metric, e.g. one repository's stars
+	SetLabelledMetricSnapshot(metric string, labels map[string]string, value float64, takenAt time.Time) error
+
+	// RecordFunnelEvents adds funnel events, keeping the earliest for each
+	// contact and stage
+	RecordFunnelEvents(events []funnel.Event) error
+
+	// SetTeams replaces all the stored teams
+	SetTeams(teams []datastore.TeamRow) error
+
+	// HTTPResponse returns the last response to a URL that had an ETag, or
+	// nil, for making conditional requests
+	HTTPResponse(url string) (*datastore.HTTPResponse, error)
+
+	// SetHTTPResponse keeps the response to a URL for next time
+	SetHTTPResponse(url string, response datastore.HTTPResponse) error
+
+	// SetCollectorSucceeded records that a collector ran without an error,
+	// for /readyz
+	SetCollectorSucceeded(collector string, succeededAt time.Time) error
+
+	// SetCollectorSkipped records that a collector wasn't configured
+	SetCollectorSkipped(collector string, skippedAt time.Time) error
+}
+
+// databaseStore saves to the database
+type databaseStore struct{}
+
+func (databaseStore) SetMetricTimes(metric string, times []time.Time) error {
+	return datastore.SetMetricTimes(metric, times)
+}
+
+func (databaseStore) SetMetricEvents(metric string, events []datastore.Event) error {
+	return datastore.SetMetricEvents(metric, events)
+}
+
+func (databaseStore) SetMetricSnapshot(metric string, value float64, takenAt time.Time) error {
+	return datastore.SetMetricSnapshot(metric, value, takenAt)
+}
+
+func (databaseStore) SetLabelledMetricSnapshot(metric string, labels map[string]string, value float64,
+	takenAt time.Time) error {
+	return datastore.SetLabelledMetricSnapshot(metric, labels, value, takenAt)
+}
+
+func (databaseStore) RecordFunnelEvents(events []funnel.Event) error {
+	return datastore.RecordFunnelEvents(events)
+}
+
+func (databaseStore) SetTeams(teams []datastore.TeamRow) error {
+	return datastore.SetTeams(teams, time.Now())
+}
+
+func (databaseStore) HTTPResponse(url string) (*datastore.HTTPResponse, error) {
+	return datastore.GetHTTPResponse(url)
+}
+
+func (databaseStore) SetHTTPResponse(url string, response datastore.HTTPResponse) error {
+	return datastore.SetHTTPResponse(url, response, time.Now())
+}
+
+func (databaseStore) SetCollectorSucceeded(collector string, succeededAt time.Time) error {
+	return datastore.SetCollectorSucceeded(collector, succeededAt)
+}
+
+func (databaseStore) SetCollectorSkipped(collector string, skippedAt time.Time) error {
+	return datastore.SetCollectorSkipped(collector, skippedAt)
+}
+
+// dryRunStore saves nothing. Instead it works out how the database would
+// change, for `dashboard collect --dry-run`.
+type dryRunStore struct {
+	eventsDiffs []*datastore.EventsDiff
+	snapshots   []snapshotValue
+	funnelDiffs []*datastore.FunnelDiff
+	teamsDiffs  []*datastore.TeamsDiff
+}
+
+type snapshotValue struct {
+	metric string
+	labels map[string]string
+	value  float64
+}
+
+func (s *dryRunStore) SetMetricTimes(metric string, times []time.Time) error {
+	events := []datastore.Event{}
+	for _, t := range times {
+		events = append(events, datastore.Event{OccurredAt: t})
+	}
+	return s.SetMetricEvents(metric, events)
+}
+
+func (s *dryRunStore) SetMetricEvents(metric string, events []datastore.Event) error {
+	diff, err := datastore.DiffMetricEvents(metric, events)
+	if err != nil {
+		return err
+	}
+	s.eventsDiffs = append(s.eventsDiffs, diff)
+	return nil
+}
+
+func (s *dryRunStore) SetMetricSnapshot(metric string, value float64, takenAt time.Time) error {
+	return s.SetLabelledMetricSnapshot(metric, nil, value, takenAt)
+}
+
+func (s *dryRunStore) SetLabelledMetricSnapshot(metric string, labels map[string]string, value float64,
+	takenAt time.Time) error {
+	s.snapshots = append(s.snapshots, snapshotValue{metric: metric, labels: labels, value: value})
+	return nil
+}
+
+func (s *dryRunStore) RecordFunnelEvents(events []funnel.Event) error {
+	diff, err := datastore.DiffFunnelEvents(events)
+	if err != nil {
+		return err
+	}
+	s.funnelDiffs = append(s.funnelDiffs, diff)
+	return nil
+}
+
+func (s *dryRunStore) SetTeams(teams []datastore.TeamRow) error {
+	diff, err := datastore.DiffTeams(teams)
+	if err != nil {
+		return err
+	}
+	s.teamsDiffs = append(s.teamsDiffs, diff)
+	return nil
+}
+
+// HTTPResponse uses the stored responses, so a dry run makes the same
+// conditional requests as a real one
+func (s *dryRunStore) HTTPResponse(url string) (*datastore.HTTPResponse, error) {
+	return datastore.GetHTTPResponse(url)
+}
+
+func (s *dryRunStore) SetHTTPResponse(url string, response datastore.HTTPResponse) error {
+	return nil
+}
+
+func (s *dryRunStore) SetCollectorSucceeded(collector string, succeededAt time.Time) error {
+	return nil
+}
+
+func (s *dryRunStore) SetCollectorSkipped(collector string, skippedAt time.Time) error {
+	return nil
+}
+
+// printDiffs writes a summary of each metric's changes, e.g.
+//
+//	signups: 812 → 815 events (+3): 4 added, 1 removed
+//	    now:   2018-11-02 to 2019-04-01
+//	    after: 2018-11-02 to 2019-04-03
+func (s *dryRunStore) printDiffs(out io.Writer) {
+	for _, diff := range s.eventsDiffs {
+		fmt.Fprintf(out, "%s: %d → %d events (%s): %d added, %d removed\n",
+			diff.Metric, diff.Before, diff.After, signedChange(diff.After-diff.Before),
+			diff.Added, diff.Removed)
+		fmt.Fprintf(out, "    now:   %s\n", describeDateRange(diff.OldestBefore, diff.NewestBefore))
+		fmt.Fprintf(out, "    after: %s\n", describeDateRange(diff.OldestAfter, diff.NewestAfter))
+	}
+
+	for _, snapshot := range s.snapshots {
+		fmt.Fprintf(out, "%s%s: today's snapshot would be %v\n",
+			snapshot.metric, describeLabels(snapshot.labels), snapshot.value)
+	}
+
+	for _, diff := range s.funnelDiffs {
+		fmt.Fprintf(out, "funnel_events: %d events fetched: %d new, %d earlier than the stored event\n",
+			diff.Events, diff.New, diff.Earlier)
+	}
+
+	for _, diff := range s.teamsDiffs {
+		fmt.Fprintf(out, "teams: %d → %d teams (%s): %d added, %d removed, %d changed\n",
+			diff.Before, diff.After, signedChange(diff.After-diff.Before), diff.Added, diff.Removed, diff.Changed)
+	}
+}
+
+func signedChange(change int) string {
+	if change > 0 {
+		return fmt.Sprintf("+%d", change)
+	}
+	return fmt.Sprintf("%d", change)
+}
+
+// describeLabels formats labels like {repository="fluidkeys/fluidkeys"}, in
+// order of name, or "" if there aren't any
+func describeLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	names := []string{}
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	pairs := []string{}
+	for _, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=%q", name, labels[name]))
+	}
+	return "{" + strings.Join(pairs, ", ") + "}"
+}
+
+func describeDateRange(oldest time.Time, newest time.Time) string {
+	if oldest.IsZero() && newest.IsZero() {
+		return "no events"
+	}
+	return fmt.Sprintf("%s to %s", oldest.Format("2006-01-02"), newest.Format("2006-01-02"))
+}
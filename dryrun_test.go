@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+func TestDryRunStore(t *testing.T) {
+	initializeTestDatabase(t)
+
+	day := func(d int) time.Time { return time.Date(2019, 4, d, 9, 0, 0, 0, time.UTC) }
+	one, two := 1.0, 2.0
+
+	stored := []datastore.Event{
+		{OccurredAt: day(1), Value: &one, Labels: map[string]string{"repository": "a"}},
+		{OccurredAt: day(2), Value: &one, Labels: map[string]string{"repository": "a"}},
+	}
+	if err := datastore.SetMetricEvents("pullRequestsMerged", stored); err != nil {
+		t.Fatal(err)
+	}
+	if err := datastore.SetTeams([]datastore.TeamRow{{UUID: "a", Name: "Imagine Corporation", MemberCount: 3}},
+		day(2)); err != nil {
+		t.Fatal(err)
+	}
+
+	store := &dryRunStore{}
+
+	// the same times, but one value and one repository have changed
+	err := store.SetMetricEvents("pullRequestsMerged", []datastore.Event{
+		{OccurredAt: day(1), Value: &two, Labels: map[string]string{"repository": "a"}},
+		{OccurredAt: day(2), Value: &one, Labels: map[string]string{"repository": "b"}},
+		{OccurredAt: day(3), Value: &one, Labels: map[string]string{"repository": "a"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetMetricTimes("signups", []time.Time{day(4)}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetMetricSnapshot("githubStars", 12, day(4)); err != nil {
+		t.Fatal(err)
+	}
+	err = store.SetLabelledMetricSnapshot("githubStars", map[string]string{"repository": "a"}, 9, day(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.SetTeams([]datastore.TeamRow{
+		{UUID: "a", Name: "Imagine Corporation", MemberCount: 4},
+		{UUID: "b", Name: "Flex Tech Inc.", MemberCount: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	store.printDiffs(&out)
+
+	expected := "pullRequestsMerged: 2 → 3 events (+1): 3 added, 2 removed\n" +
+		"    now:   2019-04-01 to 2019-04-02\n" +
+		"    after: 2019-04-01 to 2019-04-03\n" +
+		"signups: 0 → 1 events (+1): 1 added, 0 removed\n" +
+		"    now:   no events\n" +
+		"    after: 2019-04-04 to 2019-04-04\n" +
+		"githubStars: today's snapshot would be 12\n" +
+		"githubStars{repository=\"a\"}: today's snapshot would be 9\n" +
+		"teams: 1 → 2 teams (+1): 1 added, 0 removed, 1 changed\n"
+	if out.String() != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, out.String())
+	}
+
+	// and nothing was saved
+	rows, err := datastore.MetricRows("pullRequestsMerged", datastore.Window{}, nil)
+	if err != nil || len(rows) != len(stored) {
+		t.Errorf("expected the %d stored events to be unchanged, got %+v, %v", len(stored), rows, err)
+	}
+	teams, err := datastore.TeamRows()
+	if err != nil || len(teams) != 1 || teams[0].MemberCount != 3 {
+		t.Errorf("expected the stored team to be unchanged, got %+v, %v", teams, err)
+	}
+}
+
+func TestSignedChange(t *testing.T) {
+	for change, expected := range map[int]string{3: "+3", 0: "0", -2: "-2"} {
+		if got := signedChange(change); got != expected {
+			t.Errorf("%d: expected %s, got %s", change, expected, got)
+		}
+	}
+}
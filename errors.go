@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/fluidkeys/dashboard/github"
+	"github.com/fluidkeys/dashboard/mailinglist"
+
+	"golang.org/x/oauth2"
+	"google.golang.org/api/googleapi"
+)
+
+// errorKind is the category of a collector error. It decides the exit code
+// of `dashboard collect`, so a scheduler can tell a broken config from a
+// flaky source.
+type errorKind int
+
+const (
+	// otherError is anything we didn't expect, including a collector panicking
+	otherError errorKind = iota
+
+	// configError means an environment variable is missing or invalid
+	configError
+
+	// authError means a source rejected our credentials
+	authError
+
+	// sourceError means a source couldn't be reached or returned an error
+	sourceError
+
+	// parseError means a source returned data we couldn't understand
+	parseError
+)
+
+const (
+	exitOK          exitCode = 0
+	exitOtherError  exitCode = 1
+	exitConfigError exitCode = 2
+	exitAuthError   exitCode = 3
+	exitSourceError exitCode = 4
+	exitParseError  exitCode = 5
+)
+
+func (k errorKind) exitCode() exitCode {
+	switch k {
+	case configError:
+		return exitConfigError
+	case authError:
+		return exitAuthError
+	case sourceError:
+		return exitSourceError
+	case parseError:
+		return exitParseError
+	default:
+		return exitOtherError
+	}
+}
+
+// precedence is used to choose a single exit code when collectors fail in
+// different ways: the ones that need a person to fix something come first
+func (k errorKind) precedence() int {
+	switch k {
+	case configError:
+		return 4
+	case authError:
+		return 3
+	case parseError:
+		return 2
+	case sourceError:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// errSkipped is returned by a collector that isn't configured, so it has
+// nothing to collect. It isn't a failure, but it isn't a success either.
+var errSkipped = errors.New("skipped")
+
+// collectError is an error with a kind
+type collectError struct {
+	kind errorKind
+	err  error
+}
+
+func (e *collectError) Error() string {
+	return e.err.Error()
+}
+
+func (e *collectError) Unwrap() error {
+	return e.err
+}
+
+func configErrorf(format string, args ...interface{}) error {
+	return newCollectError(configError, fmt.Errorf(format, args...))
+}
+
+// sourceErrorf returns a source error, or an auth error if it wraps a
+// rejected token or a 401/403 from a Google API, the mailing list API or GitHub
+func sourceErrorf(format string, args ...interface{}) error {
+	err := fmt.Errorf(format, args...)
+
+	var retrieveError *oauth2.RetrieveError
+	if errors.As(err, &retrieveError) {
+		return newCollectError(authError, err)
+	}
+
+	var apiError *googleapi.Error
+	if errors.As(err, &apiError) && isAuthFailure(apiError) {
+		return newCollectError(authError, err)
+	}
+
+	var mailingListError *mailinglist.APIError
+	if errors.As(err, &mailingListError) && mailingListError.IsAuthFailure() {
+		return newCollectError(authError, err)
+	}
+
+	var githubAPIError *github.APIError
+	if errors.As(err, &githubAPIError) && githubAPIError.IsAuthFailure() {
+		return newCollectError(authError, err)
+	}
+
+	return newCollectError(sourceError, err)
+}
+
+// isAuthFailure returns true for 401s, and for 403s that aren't rate limits,
+// which Google APIs also return as 403
+func isAuthFailure(apiError *googleapi.Error) bool {
+	switch apiError.Code {
+	case http.StatusUnauthorized:
+		return true
+	case http.StatusForbidden:
+		for _, item := range apiError.Errors {
+			if strings.HasSuffix(strings.ToLower(item.Reason), "ratelimitexceeded") {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func parseErrorf(format string, args ...interface{}) error {
+	return newCollectError(parseError, fmt.Errorf(format, args...))
+}
+
+// apiError returns a parse error if an API client returned unexpected, meaning
+// the API returned something we couldn't read, otherwise a source error (or
+// auth error)
+func apiError(message string, err error, unexpected error) error {
+	if errors.Is(err, unexpected) {
+		return parseErrorf("%s: %w", message, err)
+	}
+	return sourceErrorf("%s: %w", message, err)
+}
+
+// statusError returns nil if the response is a 200, an auth error if it's a
+// 401 or 403, otherwise a source error
+func statusError(message string, response *http.Response) error {
+	switch response.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return newCollectError(authError, fmt.Errorf("%s: %s", message, response.Status))
+	default:
+		return sourceErrorf("%s: %s", message, response.Status)
+	}
+}
+
+// newCollectError wraps err with the given kind, unless it already wraps an
+// error with a kind, which is kept: a parse error returned from inside a
+// paging callback is still a parse error once the caller has wrapped it.
+func newCollectError(kind errorKind, err error) error {
+	var existing *collectError
+	if errors.As(err, &existing) {
+		kind = existing.kind
+	}
+	return &collectError{kind: kind, err: err}
+}
+
+// kindOf returns the kind of err, or otherError if it doesn't have one
+func kindOf(err error) errorKind {
+	var typed *collectError
+	if errors.As(err, &typed) {
+		return typed.kind
+	}
+	return otherError
+}
+
+// exitCodeFor returns the exit code for the most important of the errors
+func exitCodeFor(errs []error) exitCode {
+	if len(errs) == 0 {
+		return exitOK
+	}
+
+	worst := kindOf(errs[0])
+	for _, err := range errs[1:] {
+		if kind := kindOf(err); kind.precedence() > worst.precedence() {
+			worst = kind
+		}
+	}
+	return worst.exitCode()
+}
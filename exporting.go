@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// exportRequest describes what to export: which metric, in what format, over
+// which dates and whether to bucket it into daily, weekly or monthly counts
+//
+// Raw rows have no limit on the dates by default, but bucketed counts default
+// to today for `to`, and the 30 days up to `to` if there's no `from`.
+type exportRequest struct {
+	metric string
+	format string
+	from   time.Time // inclusive, zero for no limit (or 29 days before `to`, if bucketed)
+	to     time.Time // inclusive, zero for no limit (or today, if bucketed)
+	bucket string    // "" for raw rows, or "day", "week" or "month"
+
+	// labels only exports events with all of these labels
+	labels datastore.Filters
+}
+
+// handleExport serves /api/export/{metric}.csv and /api/export/{metric}.json
+// with optional `from`, `to` (YYYY-MM-DD), `bucket` (day, week or month) and
+// `label` (key=value, can be repeated) query parameters. Without `from`, a
+// bucketed export is of the last 30 days.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	filename := strings.TrimPrefix(r.URL.Path, "/api/export/")
+	extension := path.Ext(filename)
+
+	request := exportRequest{
+		metric: strings.TrimSuffix(filename, extension),
+		format: strings.TrimPrefix(extension, "."),
+		bucket: r.URL.Query().Get("bucket"),
+	}
+
+	if !datastore.IsMetric(request.metric) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var err error
+	request.from, err = parseExportDate(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.to, err = parseExportDate(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	request.labels, err = parseLabelFilters(r.URL.Query()["label"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := request.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch request.format {
+	case "csv":
+		w.Header().Set("content-type", "text/csv")
+	case "json":
+		w.Header().Set("content-type", "application/json")
+	}
+
+	if err := writeExport(w, request); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
+// runExport writes a metric export to stdout or the given --output file
+func runExport(arguments []string) exitCode {
+	var labels stringList
+
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	metric := flags.String("metric", "", "metric to export: "+strings.Join(datastore.MetricNames(), ", "))
+	format := flags.String("format", "csv", "csv or json")
+	from := flags.String("from", "", "first date to export, YYYY-MM-DD. "+
+		"Defaults to the first event, or 29 days before --to for counts.")
+	to := flags.String("to", "", "last date to export, YYYY-MM-DD. "+
+		"Defaults to the last event, or today for counts.")
+	bucket := flags.String("bucket", "", "leave empty for raw rows, or 'day', 'week' or 'month' for counts")
+	flags.Var(&labels, "label", "only export events with this label, e.g. 'repository=fluidkeys/fluidkeys'. "+
+		"Can be given more than once.")
+	output := flags.String("output", "", "file to write to instead of stdout")
+	flags.Parse(arguments)
+
+	request := exportRequest{metric: *metric, format: *format, bucket: *bucket}
+
+	if !datastore.IsMetric(request.metric) {
+		fmt.Printf("Unknown metric '%s', expected one of: %s\n",
+			request.metric, strings.Join(datastore.MetricNames(), ", "))
+		return 1
+	}
+
+	var err error
+	if request.from, err = parseExportDate(*from); err != nil {
+		fmt.Print(err.Error() + "\n")
+		return 1
+	}
+	if request.to, err = parseExportDate(*to); err != nil {
+		fmt.Print(err.Error() + "\n")
+		return 1
+	}
+	if request.labels, err = parseLabelFilters(labels); err != nil {
+		fmt.Print(err.Error() + "\n")
+		return 1
+	}
+
+	if err := request.validate(); err != nil {
+		fmt.Print(err.Error() + "\n")
+		return 1
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		file, err := os.Create(*output)
+		if err != nil {
+			fmt.Print(err.Error() + "\n")
+			return 1
+		}
+		defer file.Close()
+		out = file
+	}
+
+	if err := writeExport(out, request); err != nil {
+		fmt.Printf("Failed to export %s: %v\n", request.metric, err)
+		return 1
+	}
+	return 0
+}
+
+func (e exportRequest) validate() error {
+	if e.format != "csv" && e.format != "json" {
+		return fmt.Errorf("invalid format '%s', expected csv or json", e.format)
+	}
+	if e.bucket != "" && !datastore.IsBucket(e.bucket) {
+		return fmt.Errorf("invalid bucket '%s', expected day, week or month", e.bucket)
+	}
+	if !e.from.IsZero() && !e.to.IsZero() && e.to.Before(e.from) {
+		return fmt.Errorf("'to' date is before 'from' date")
+	}
+	return nil
+}
+
+// writeExport writes either the raw rows (with their value and labels, if
+// they have them) or the bucketed counts of the requested metric as CSV or
+// JSON. In CSV, labels are a JSON object.
+func writeExport(w io.Writer, request exportRequest) error {
+	if request.bucket == "" {
+		window := datastore.Window{From: request.from, To: request.to}
+		if !window.To.IsZero() {
+			window.To = window.To.AddDate(0, 0, 1) // a Window's `To` is exclusive
+		}
+
+		rows, err := datastore.MetricRows(request.metric, window, request.labels)
+		if err != nil {
+			return err
+		}
+
+		if request.format == "json" {
+			return writeJSON(w, rows)
+		}
+
+		records := [][]string{{"id", "timestamp", "value", "labels"}}
+		for _, row := range rows {
+			var value, labels string
+			if row.Value != nil {
+				value = strconv.FormatFloat(*row.Value, 'f', -1, 64)
+			}
+			if len(row.Labels) > 0 {
+				encoded, err := json.Marshal(row.Labels)
+				if err != nil {
+					return err
+				}
+				labels = string(encoded)
+			}
+
+			records = append(records, []string{
+				strconv.FormatInt(row.ID, 10),
+				row.Timestamp.Format(time.RFC3339),
+				value,
+				labels,
+			})
+		}
+		return csv.NewWriter(w).WriteAll(records)
+	}
+
+	from, to := request.from, request.to
+	if to.IsZero() {
+		to = time.Now()
+	}
+	if from.IsZero() {
+		from = to.AddDate(0, 0, -29)
+	}
+
+	dateCounts, err := datastore.Series(request.metric, datastore.Dates(from, to),
+		datastore.Bucket(request.bucket), request.labels)
+	if err != nil {
+		return err
+	}
+
+	if request.format == "json" {
+		return writeJSON(w, dateCounts)
+	}
+
+	records := [][]string{{"date", "count"}}
+	for _, dateCount := range dateCounts {
+		records = append(records, []string{
+			time.Time(dateCount.Date).Format("2006-01-02"),
+			strconv.Itoa(dateCount.Count),
+		})
+	}
+	return csv.NewWriter(w).WriteAll(records)
+}
+
+func writeJSON(w io.Writer, value interface{}) error {
+	out, err := json.MarshalIndent(value, "", "    ")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(out)
+	return err
+}
+
+// parseExportDate parses a YYYY-MM-DD date, returning a zero time for an empty
+// string
+func parseExportDate(date string) (time.Time, error) {
+	if date == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid date '%s', expected YYYY-MM-DD", date)
+	}
+	return t, nil
+}
+
+// parseLabelFilters parses labels given as key=value
+func parseLabelFilters(labels []string) (datastore.Filters, error) {
+	filters := datastore.Filters{}
+	for _, label := range labels {
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid label '%s', expected key=value", label)
+		}
+		filters[parts[0]] = parts[1]
+	}
+	return filters, nil
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+func TestExport(t *testing.T) {
+	initializeTestDatabase(t)
+
+	day := func(d int) time.Time { return time.Date(2019, 4, d, 9, 0, 0, 0, time.UTC) }
+	three := 3.0
+
+	err := datastore.SetMetricEvents("pullRequestsMerged", []datastore.Event{
+		{OccurredAt: day(1), Value: &three, Labels: map[string]string{"repository": "fluidkeys/fluidkeys"}},
+		{OccurredAt: day(2), Labels: map[string]string{"repository": "fluidkeys/dashboard"}},
+		{OccurredAt: day(3)},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(t *testing.T, url string) *httptest.ResponseRecorder {
+		t.Helper()
+		response := httptest.NewRecorder()
+		handleExport(response, httptest.NewRequest("GET", url, nil))
+		return response
+	}
+
+	t.Run("raw rows as CSV", func(t *testing.T) {
+		response := get(t, "/api/export/pullRequestsMerged.csv?from=2019-04-01&to=2019-04-02")
+
+		expected := "id,timestamp,value,labels\n" +
+			`1,2019-04-01T09:00:00Z,3,"{""repository"":""fluidkeys/fluidkeys""}"` + "\n" +
+			`2,2019-04-02T09:00:00Z,,"{""repository"":""fluidkeys/dashboard""}"` + "\n"
+		if response.Code != http.StatusOK || response.Body.String() != expected {
+			t.Errorf("expected:\n%s\ngot %d:\n%s", expected, response.Code, response.Body)
+		}
+		if contentType := response.Header().Get("content-type"); contentType != "text/csv" {
+			t.Errorf("expected text/csv, got %s", contentType)
+		}
+	})
+
+	t.Run("raw rows as JSON, filtered by label", func(t *testing.T) {
+		response := get(t, "/api/export/pullRequestsMerged.json?label=repository=fluidkeys/fluidkeys")
+
+		rows := []datastore.EventRow{}
+		if err := json.Unmarshal(response.Body.Bytes(), &rows); err != nil {
+			t.Fatalf("invalid JSON: %v: %s", err, response.Body)
+		}
+		if len(rows) != 1 || rows[0].Value == nil || *rows[0].Value != 3 ||
+			rows[0].Labels["repository"] != "fluidkeys/fluidkeys" {
+			t.Errorf("expected the fluidkeys/fluidkeys row with its value, got %+v", rows)
+		}
+	})
+
+	t.Run("bucketed counts default to the 30 days up to 'to'", func(t *testing.T) {
+		response := get(t, "/api/export/pullRequestsMerged.csv?bucket=day&to=2019-04-02")
+
+		lines := strings.Split(strings.TrimSpace(response.Body.String()), "\n")
+		if len(lines) != 31 || lines[1] != "2019-03-04,0" || lines[29] != "2019-04-01,3" || lines[30] != "2019-04-02,1" {
+			t.Errorf("expected a header and 30 days to 2019-04-02, got %d lines: %v", len(lines), lines)
+		}
+	})
+
+	t.Run("bad requests", func(t *testing.T) {
+		for url, expected := range map[string]int{
+			"/api/export/pullRequestsMerged.xml":                 http.StatusBadRequest,
+			"/api/export/pullRequestsMerged.csv?bucket=year":     http.StatusBadRequest,
+			"/api/export/pullRequestsMerged.csv?from=1/4/2019":   http.StatusBadRequest,
+			"/api/export/pullRequestsMerged.csv?label=no-equals": http.StatusBadRequest,
+			"/api/export/unknown.csv":                            http.StatusNotFound,
+		} {
+			if response := get(t, url); response.Code != expected {
+				t.Errorf("%s: expected %d, got %d", url, expected, response.Code)
+			}
+		}
+	})
+
+	t.Run("command", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "export.csv")
+
+		code := runExport([]string{"--metric", "pullRequestsMerged", "--from", "2019-04-03", "--output", output})
+		if code != 0 {
+			t.Fatalf("expected exit code 0, got %d", code)
+		}
+
+		exported, err := os.ReadFile(output)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "id,timestamp,value,labels\n3,2019-04-03T09:00:00Z,,\n"; string(exported) != expected {
+			t.Errorf("expected:\n%s\ngot:\n%s", expected, exported)
+		}
+
+		if code := runExport([]string{"--metric", "unknown"}); code != 1 {
+			t.Errorf("expected an unknown metric to fail, got exit code %d", code)
+		}
+	})
+}
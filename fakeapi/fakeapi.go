@@ -0,0 +1,591 @@
+// Package fakeapi is a fake of the external APIs the collectors talk to, for
+// testing them without a network: Google Sheets `values.get`, Google Calendar
+// `events.list` (with paging), Mailchimp-compatible list members (with paging),
+// the Fluidkeys server's teams, GitHub repositories (with paging and ETags) and
+// static files such as the blog's RSS feed.
+//
+// Every request sent through Server.Client goes to the fake, whatever its
+// host, so collectors can be tested with their real URLs.
+package fakeapi
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fluidkeys/dashboard/mailinglist"
+
+	"google.golang.org/api/calendar/v3"
+	"google.golang.org/api/sheets/v4"
+)
+
+const (
+	sheetsPrefix      = "/v4/spreadsheets/"
+	calendarPrefix    = "/calendar/v3/calendars/"
+	mailingListPrefix = "/3.0/lists/"
+	teamsPath         = "/v1/admin/teams"
+	githubPrefix      = "/repos/"
+)
+
+// githubBaseURL is used in the Link header of paged GitHub responses, so the
+// next page is requested from the real URL like it would be from GitHub
+const githubBaseURL = "https://api.github.com"
+
+// Server is a fake API server
+type Server struct {
+	*httptest.Server
+
+	// EventsPageSize is the most calendar events returned in one page
+	EventsPageSize int
+
+	// APIKey, if set, is the password required by the mailing list API and
+	// the bearer token required by the Fluidkeys API and GitHub
+	APIKey string
+
+	mutex     sync.Mutex
+	sheets    map[string][][]interface{}
+	calendars map[string][]*calendar.Event
+	lists     map[string][]mailinglist.Member
+	teams     []Team
+	repos     map[string]Repository
+	files     map[string]file
+	failures  map[string][]failure
+	requests  []string
+}
+
+// Team is a team as listed by the Fluidkeys API
+type Team struct {
+	UUID        string `json:"uuid"`
+	Name        string `json:"name"`
+	MemberCount int    `json:"memberCount"`
+	CreatedAt   string `json:"createdAt,omitempty"`
+}
+
+// Repository is a GitHub repository
+type Repository struct {
+	Stars int
+
+	// OpenIssues doesn't include the open pull requests, unlike GitHub's
+	// open_issues_count
+	OpenIssues int
+
+	PullRequests []PullRequest
+
+	// Contributors are the logins of everyone who has committed
+	Contributors []string
+}
+
+// PullRequest is a GitHub pull request
+type PullRequest struct {
+	Number   int    `json:"number"`
+	State    string `json:"state"`
+	MergedAt string `json:"merged_at,omitempty"`
+}
+
+type file struct {
+	contentType string
+	body        string
+}
+
+type failure struct {
+	status int
+	reason string
+}
+
+// NewServer starts a fake API server. Call Close when finished with it.
+func NewServer() *Server {
+	s := &Server{
+		EventsPageSize: 250,
+		sheets:         make(map[string][][]interface{}),
+		calendars:      make(map[string][]*calendar.Event),
+		lists:          make(map[string][]mailinglist.Member),
+		repos:          make(map[string]Repository),
+		files:          make(map[string]file),
+		failures:       make(map[string][]failure),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Client returns an HTTP client that sends every request to the fake server
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: s.Transport()}
+}
+
+// Transport returns a RoundTripper that sends every request to the fake
+// server, for wrapping in another RoundTripper
+func (s *Server) Transport() http.RoundTripper {
+	target, _ := url.Parse(s.URL)
+	return &redirectTransport{target: target, base: s.Server.Client().Transport}
+}
+
+// SetSheetValues sets the rows returned for the given spreadsheet and range,
+// e.g. "Recent signups!A2:B"
+func (s *Server) SetSheetValues(spreadsheetID string, readRange string, values [][]interface{}) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.sheets[spreadsheetID+"/"+readRange] = values
+}
+
+// SetCalendarEvents sets the events listed for the given calendar
+func (s *Server) SetCalendarEvents(calendarID string, events []*calendar.Event) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.calendars[calendarID] = events
+}
+
+// SetListMembers sets the members of the given mailing list. Its member count
+// is the number of them that are subscribed.
+func (s *Server) SetListMembers(listID string, members []mailinglist.Member) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.lists[listID] = members
+}
+
+// SetTeams sets the teams listed by the Fluidkeys API
+func (s *Server) SetTeams(teams []Team) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.teams = teams
+}
+
+// SetRepository sets the GitHub repository with the given full name, e.g.
+// "fluidkeys/fluidkeys"
+func (s *Server) SetRepository(fullName string, repository Repository) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.repos[fullName] = repository
+}
+
+// SetFile serves body at the given path, e.g. "/blog/feed.xml"
+func (s *Server) SetFile(path string, contentType string, body string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.files[path] = file{contentType: contentType, body: body}
+}
+
+// FailNext makes the next request to a path starting with pathPrefix fail
+// with the given status. reason, if set, is included in a Google-style error
+// body, e.g. "rateLimitExceeded", or is the detail of a mailing list API
+// error. A GitHub 403 with the reason "rateLimitExceeded" says the rate limit
+// has been used up. Call it more than once to fail more than one request.
+func (s *Server) FailNext(pathPrefix string, status int, reason string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.failures[pathPrefix] = append(s.failures[pathPrefix], failure{status: status, reason: reason})
+}
+
+// Requests returns the method and path of every request received so far
+func (s *Server) Requests() []string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	if failure, ok := s.takeFailure(r.URL.Path); ok {
+		switch {
+		case strings.HasPrefix(r.URL.Path, mailingListPrefix):
+			writeProblem(w, failure.status, failure.reason)
+		case r.URL.Path == teamsPath:
+			writeFluidkeysError(w, failure.status, failure.reason)
+		case strings.HasPrefix(r.URL.Path, githubPrefix):
+			writeGitHubError(w, failure.status, failure.reason)
+		default:
+			writeGoogleError(w, failure.status, failure.reason)
+		}
+		return
+	}
+
+	switch {
+	case r.Method != "GET":
+		writeGoogleError(w, http.StatusMethodNotAllowed, "")
+
+	case strings.HasPrefix(r.URL.Path, sheetsPrefix):
+		s.serveSheetValues(w, r)
+
+	case strings.HasPrefix(r.URL.Path, calendarPrefix):
+		s.serveCalendarEvents(w, r)
+
+	case strings.HasPrefix(r.URL.Path, mailingListPrefix):
+		s.serveMailingList(w, r)
+
+	case r.URL.Path == teamsPath:
+		s.serveTeams(w, r)
+
+	case strings.HasPrefix(r.URL.Path, githubPrefix):
+		s.serveGitHub(w, r)
+
+	default:
+		f, ok := s.files[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("content-type", f.contentType)
+		w.Write([]byte(f.body))
+	}
+}
+
+// takeFailure returns the first queued failure for the path, if any. The
+// longest matching prefix wins.
+func (s *Server) takeFailure(path string) (failure, bool) {
+	prefixes := []string{}
+	for prefix, queued := range s.failures {
+		if strings.HasPrefix(path, prefix) && len(queued) > 0 {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return failure{}, false
+	}
+	sort.Slice(prefixes, func(i, j int) bool { return len(prefixes[i]) > len(prefixes[j]) })
+
+	queued := s.failures[prefixes[0]]
+	s.failures[prefixes[0]] = queued[1:]
+	return queued[0], true
+}
+
+// serveSheetValues serves /v4/spreadsheets/{spreadsheetId}/values/{range}
+func (s *Server) serveSheetValues(w http.ResponseWriter, r *http.Request) {
+	parts := strings.SplitN(strings.TrimPrefix(r.URL.Path, sheetsPrefix), "/values/", 2)
+	if len(parts) != 2 {
+		writeGoogleError(w, http.StatusNotFound, "notFound")
+		return
+	}
+
+	values, ok := s.sheets[parts[0]+"/"+parts[1]]
+	if !ok {
+		writeGoogleError(w, http.StatusNotFound, "notFound")
+		return
+	}
+
+	writeJSON(w, sheets.ValueRange{Range: parts[1], MajorDimension: "ROWS", Values: values})
+}
+
+// serveCalendarEvents serves /calendar/v3/calendars/{calendarId}/events,
+// returning EventsPageSize events per page
+func (s *Server) serveCalendarEvents(w http.ResponseWriter, r *http.Request) {
+	calendarID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, calendarPrefix), "/events")
+
+	events, ok := s.calendars[calendarID]
+	if !ok {
+		writeGoogleError(w, http.StatusNotFound, "notFound")
+		return
+	}
+
+	start := 0
+	if pageToken := r.URL.Query().Get("pageToken"); pageToken != "" {
+		var err error
+		start, err = strconv.Atoi(pageToken)
+		if err != nil || start < 0 || start > len(events) {
+			writeGoogleError(w, http.StatusBadRequest, "invalid")
+			return
+		}
+	}
+
+	end := start + s.EventsPageSize
+	if end > len(events) {
+		end = len(events)
+	}
+
+	page := calendar.Events{Kind: "calendar#events", Items: events[start:end]}
+	if end < len(events) {
+		page.NextPageToken = strconv.Itoa(end)
+	}
+	writeJSON(w, page)
+}
+
+// serveMailingList serves /3.0/lists/{listId} and
+// /3.0/lists/{listId}/members, paged with `count` and `offset`
+func (s *Server) serveMailingList(w http.ResponseWriter, r *http.Request) {
+	if _, password, ok := r.BasicAuth(); s.APIKey != "" && (!ok || password != s.APIKey) {
+		writeProblem(w, http.StatusUnauthorized, "Your API key may be invalid.")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, mailingListPrefix), "/")
+	members, ok := s.lists[parts[0]]
+	if !ok {
+		writeProblem(w, http.StatusNotFound, "The requested resource could not be found.")
+		return
+	}
+
+	switch {
+	case len(parts) == 1:
+		memberCount := 0
+		for _, member := range members {
+			if member.Status == mailinglist.Subscribed {
+				memberCount++
+			}
+		}
+		writeJSON(w, map[string]interface{}{
+			"id":    parts[0],
+			"stats": map[string]int{"member_count": memberCount},
+		})
+
+	case len(parts) == 2 && parts[1] == "members":
+		count, err := strconv.Atoi(r.URL.Query().Get("count"))
+		if err != nil || count < 1 || count > 1000 {
+			writeProblem(w, http.StatusBadRequest, "count must be from 1 to 1000")
+			return
+		}
+		offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+		if err != nil || offset < 0 {
+			writeProblem(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+
+		start, end := offset, offset+count
+		if start > len(members) {
+			start = len(members)
+		}
+		if end > len(members) {
+			end = len(members)
+		}
+		writeJSON(w, map[string]interface{}{
+			"members":     members[start:end],
+			"total_items": len(members),
+		})
+
+	default:
+		writeProblem(w, http.StatusNotFound, "The requested resource could not be found.")
+	}
+}
+
+// serveTeams serves /v1/admin/teams
+func (s *Server) serveTeams(w http.ResponseWriter, r *http.Request) {
+	if s.APIKey != "" && r.Header.Get("authorization") != "Bearer "+s.APIKey {
+		writeFluidkeysError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	teams := s.teams
+	if teams == nil {
+		teams = []Team{}
+	}
+	writeJSON(w, map[string]interface{}{"teams": teams})
+}
+
+// serveGitHub serves /repos/{owner}/{repo}, and its /pulls (filtered by
+// `state`) and /contributors, paged with `per_page` and `page`. Every
+// response has an ETag, and a request with a matching If-None-Match gets a
+// 304.
+func (s *Server) serveGitHub(w http.ResponseWriter, r *http.Request) {
+	if s.APIKey != "" && r.Header.Get("authorization") != "Bearer "+s.APIKey {
+		writeGitHubError(w, http.StatusUnauthorized, "Bad credentials")
+		return
+	}
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, githubPrefix), "/")
+	if len(parts) < 2 {
+		writeGitHubError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+	fullName := parts[0] + "/" + parts[1]
+	repository, ok := s.repos[fullName]
+	if !ok {
+		writeGitHubError(w, http.StatusNotFound, "Not Found")
+		return
+	}
+
+	switch {
+	case len(parts) == 2:
+		writeGitHubJSON(w, r, map[string]interface{}{
+			"full_name":         fullName,
+			"stargazers_count":  repository.Stars,
+			"open_issues_count": repository.OpenIssues + countOpen(repository.PullRequests),
+		}, "")
+
+	case len(parts) == 3 && parts[2] == "pulls":
+		state := r.URL.Query().Get("state")
+		if state == "" {
+			state = "open"
+		}
+		pulls := []PullRequest{}
+		for _, pull := range repository.PullRequests {
+			if state == "all" || pull.State == state {
+				pulls = append(pulls, pull)
+			}
+		}
+
+		start, end, link, err := githubPage(r, len(pulls))
+		if err != nil {
+			writeGitHubError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeGitHubJSON(w, r, pulls[start:end], link)
+
+	case len(parts) == 3 && parts[2] == "contributors":
+		if len(repository.Contributors) == 0 {
+			// like GitHub, for an empty repository
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		contributors := []map[string]interface{}{}
+		for _, login := range repository.Contributors {
+			contributors = append(contributors, map[string]interface{}{"login": login, "contributions": 1})
+		}
+
+		start, end, link, err := githubPage(r, len(contributors))
+		if err != nil {
+			writeGitHubError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		writeGitHubJSON(w, r, contributors[start:end], link)
+
+	default:
+		writeGitHubError(w, http.StatusNotFound, "Not Found")
+	}
+}
+
+func countOpen(pulls []PullRequest) int {
+	open := 0
+	for _, pull := range pulls {
+		if pull.State == "open" {
+			open++
+		}
+	}
+	return open
+}
+
+// githubPage returns the slice of the results on the requested page, and the
+// Link header pointing at the next page, if any
+func githubPage(r *http.Request, total int) (start int, end int, link string, err error) {
+	query := r.URL.Query()
+
+	perPage := 30
+	if query.Get("per_page") != "" {
+		if perPage, err = strconv.Atoi(query.Get("per_page")); err != nil || perPage < 1 || perPage > 100 {
+			return 0, 0, "", fmt.Errorf("per_page must be from 1 to 100")
+		}
+	}
+	page := 1
+	if query.Get("page") != "" {
+		if page, err = strconv.Atoi(query.Get("page")); err != nil || page < 1 {
+			return 0, 0, "", fmt.Errorf("invalid page")
+		}
+	}
+
+	start, end = (page-1)*perPage, page*perPage
+	if start > total {
+		start = total
+	}
+	if end > total {
+		end = total
+	} else if end < total {
+		query.Set("page", strconv.Itoa(page+1))
+		link = fmt.Sprintf(`<%s%s?%s>; rel="next"`, githubBaseURL, r.URL.Path, query.Encode())
+	}
+	return start, end, link, nil
+}
+
+// writeGitHubJSON writes v with an ETag of its hash, or a 304 if the request
+// already has it
+func writeGitHubJSON(w http.ResponseWriter, r *http.Request, v interface{}, link string) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+		return
+	}
+	hash := sha256.Sum256(body)
+	etag := `"` + hex.EncodeToString(hash[:16]) + `"`
+
+	w.Header().Set("etag", etag)
+	if link != "" {
+		w.Header().Set("link", link)
+	}
+	if r.Header.Get("if-none-match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(body)
+}
+
+// writeGitHubError writes an error in the format returned by GitHub
+func writeGitHubError(w http.ResponseWriter, status int, message string) {
+	if status == http.StatusForbidden && message == "rateLimitExceeded" {
+		w.Header().Set("x-ratelimit-remaining", "0")
+		message = "API rate limit exceeded"
+	}
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// writeFluidkeysError writes an error in the format returned by the Fluidkeys
+// API
+func writeFluidkeysError(w http.ResponseWriter, status int, detail string) {
+	if detail == "" {
+		detail = http.StatusText(status)
+	}
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"detail": detail})
+}
+
+// writeProblem writes an error in the "problem detail" format returned by the
+// mailing list API
+func writeProblem(w http.ResponseWriter, status int, detail string) {
+	w.Header().Set("content-type", "application/problem+json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"type":   "https://mailchimp.com/developer/marketing/docs/errors/",
+		"title":  http.StatusText(status),
+		"status": status,
+		"detail": detail,
+	})
+}
+
+// writeGoogleError writes an error in the format returned by Google APIs
+func writeGoogleError(w http.ResponseWriter, status int, reason string) {
+	body := map[string]interface{}{
+		"code":    status,
+		"message": http.StatusText(status),
+	}
+	if reason != "" {
+		body["errors"] = []map[string]string{{"reason": reason, "message": http.StatusText(status)}}
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{"error": body})
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("content-type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		http.Error(w, fmt.Sprintf("failed to encode response: %v", err), http.StatusInternalServerError)
+	}
+}
+
+// redirectTransport sends requests to target instead of their own host
+type redirectTransport struct {
+	target *url.URL
+	base   http.RoundTripper
+}
+
+func (t *redirectTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	redirected := request.Clone(request.Context())
+	redirected.URL.Scheme = t.target.Scheme
+	redirected.URL.Host = t.target.Host
+	redirected.Host = t.target.Host
+	return t.base.RoundTrip(redirected)
+}
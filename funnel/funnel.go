@@ -0,0 +1,182 @@
+// Package funnel works out how people move from signing up to the release
+// notes, to starting a trial, to paying, grouped into weekly cohorts.
+//
+// People are identified by a salted hash of their email address so that the
+// dashboard never stores the address itself.
+package funnel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stage is a step in the funnel
+type Stage string
+
+const (
+	// Signup is signing up to the release notes
+	Signup Stage = "signup"
+
+	// Trial is starting a team trial
+	Trial Stage = "trial"
+
+	// Paid is becoming a paying customer
+	Paid Stage = "paid"
+)
+
+// Stages are all the stages, in funnel order
+var Stages = []Stage{Signup, Trial, Paid}
+
+// IsStage returns true if stage is one of Stages
+func IsStage(stage Stage) bool {
+	for _, s := range Stages {
+		if s == stage {
+			return true
+		}
+	}
+	return false
+}
+
+// HashContact returns the identifier we store for a contact (e.g. an email
+// address): the hex SHA-256 of the salt and the normalised contact
+func HashContact(salt string, contact string) string {
+	normalised := strings.ToLower(strings.TrimSpace(contact))
+	hash := sha256.Sum256([]byte(salt + normalised))
+	return hex.EncodeToString(hash[:])
+}
+
+// Event is a contact reaching a stage of the funnel
+type Event struct {
+	ContactHash string    `json:"contactHash"`
+	Stage       Stage     `json:"stage"`
+	OccurredAt  time.Time `json:"occurredAt"`
+}
+
+// Cohort is everyone who signed up in the same week and how far they've got
+type Cohort struct {
+	WeekStarting time.Time `json:"weekStarting"`
+
+	Signups int `json:"signups"`
+	Trials  int `json:"trials"`
+	Paid    int `json:"paid"`
+
+	// Conversion rates are between 0 and 1, and null if the earlier stage
+	// has nobody in it
+	SignupToTrialRate *float64 `json:"signupToTrialRate"`
+	TrialToPaidRate   *float64 `json:"trialToPaidRate"`
+	SignupToPaidRate  *float64 `json:"signupToPaidRate"`
+
+	// Median times are in hours, and null if nobody has made that step
+	MedianHoursSignupToTrial *float64 `json:"medianHoursSignupToTrial"`
+	MedianHoursTrialToPaid   *float64 `json:"medianHoursTrialToPaid"`
+}
+
+// Cohorts groups contacts into weekly cohorts by when they signed up, oldest
+// first. Contacts with no signup event aren't in any cohort. If a contact has
+// more than one event for the same stage, the earliest counts.
+func Cohorts(events []Event) []Cohort {
+	contacts := make(map[string]map[Stage]time.Time)
+
+	for _, event := range events {
+		stages, ok := contacts[event.ContactHash]
+		if !ok {
+			stages = make(map[Stage]time.Time)
+			contacts[event.ContactHash] = stages
+		}
+		if existing, ok := stages[event.Stage]; !ok || event.OccurredAt.Before(existing) {
+			stages[event.Stage] = event.OccurredAt
+		}
+	}
+
+	type cohortDurations struct {
+		signupToTrial []time.Duration
+		trialToPaid   []time.Duration
+	}
+
+	cohorts := make(map[time.Time]*Cohort)
+	durations := make(map[time.Time]*cohortDurations)
+
+	for _, stages := range contacts {
+		signedUpAt, ok := stages[Signup]
+		if !ok {
+			continue
+		}
+
+		week := WeekStarting(signedUpAt)
+		cohort, ok := cohorts[week]
+		if !ok {
+			cohort = &Cohort{WeekStarting: week}
+			cohorts[week] = cohort
+			durations[week] = &cohortDurations{}
+		}
+
+		cohort.Signups++
+
+		trialAt, trialled := stages[Trial]
+		if trialled {
+			cohort.Trials++
+			if !trialAt.Before(signedUpAt) {
+				durations[week].signupToTrial = append(durations[week].signupToTrial, trialAt.Sub(signedUpAt))
+			}
+		}
+
+		if paidAt, paid := stages[Paid]; paid {
+			cohort.Paid++
+			if trialled && !paidAt.Before(trialAt) {
+				durations[week].trialToPaid = append(durations[week].trialToPaid, paidAt.Sub(trialAt))
+			}
+		}
+	}
+
+	result := []Cohort{}
+	for week, cohort := range cohorts {
+		cohort.SignupToTrialRate = rate(cohort.Trials, cohort.Signups)
+		cohort.TrialToPaidRate = rate(cohort.Paid, cohort.Trials)
+		cohort.SignupToPaidRate = rate(cohort.Paid, cohort.Signups)
+		cohort.MedianHoursSignupToTrial = medianHours(durations[week].signupToTrial)
+		cohort.MedianHoursTrialToPaid = medianHours(durations[week].trialToPaid)
+		result = append(result, *cohort)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].WeekStarting.Before(result[j].WeekStarting)
+	})
+	return result
+}
+
+// WeekStarting returns midnight UTC on the Monday of the week containing t
+func WeekStarting(t time.Time) time.Time {
+	t = t.UTC()
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, time.UTC)
+}
+
+func rate(numerator int, denominator int) *float64 {
+	if denominator == 0 {
+		return nil
+	}
+	r := float64(numerator) / float64(denominator)
+	return &r
+}
+
+func medianHours(durations []time.Duration) *float64 {
+	if len(durations) == 0 {
+		return nil
+	}
+
+	sort.Slice(durations, func(i, j int) bool { return durations[i] < durations[j] })
+
+	var median time.Duration
+	middle := len(durations) / 2
+	if len(durations)%2 == 1 {
+		median = durations[middle]
+	} else {
+		median = (durations[middle-1] + durations[middle]) / 2
+	}
+
+	hours := median.Hours()
+	return &hours
+}
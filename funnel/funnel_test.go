@@ -0,0 +1,86 @@
+package funnel
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHashContact(t *testing.T) {
+	if HashContact("salt", " Jane@Example.com ") != HashContact("salt", "jane@example.com") {
+		t.Errorf("expected hash to ignore case and whitespace")
+	}
+	if HashContact("salt", "jane@example.com") == HashContact("pepper", "jane@example.com") {
+		t.Errorf("expected hash to depend on salt")
+	}
+}
+
+func TestWeekStarting(t *testing.T) {
+	monday := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, day := range []time.Time{
+		monday,
+		time.Date(2019, 4, 3, 15, 4, 5, 0, time.UTC),
+		time.Date(2019, 4, 7, 23, 59, 59, 0, time.UTC),
+	} {
+		if got := WeekStarting(day); !got.Equal(monday) {
+			t.Errorf("WeekStarting(%v): expected %v, got %v", day, monday, got)
+		}
+	}
+}
+
+func TestCohorts(t *testing.T) {
+	at := func(day int, hour int) time.Time {
+		return time.Date(2019, 4, day, hour, 0, 0, 0, time.UTC)
+	}
+
+	events := []Event{
+		// week of 1 April: a signs up, trials and pays; b signs up and trials;
+		// c just signs up
+		{"a", Signup, at(1, 9)},
+		{"a", Trial, at(1, 19)},
+		{"a", Paid, at(3, 19)},
+		{"b", Signup, at(2, 9)},
+		{"b", Trial, at(3, 15)},
+		{"b", Trial, at(2, 13)}, // earlier duplicate wins
+		{"c", Signup, at(4, 9)},
+
+		// week of 8 April: d signs up
+		{"d", Signup, at(8, 9)},
+
+		// e trials without signing up, so isn't in any cohort
+		{"e", Trial, at(2, 9)},
+	}
+
+	cohorts := Cohorts(events)
+
+	if len(cohorts) != 2 {
+		t.Fatalf("expected 2 cohorts, got %d: %+v", len(cohorts), cohorts)
+	}
+
+	first := cohorts[0]
+	if !first.WeekStarting.Equal(at(1, 0)) {
+		t.Errorf("expected first cohort to start 1 April, got %v", first.WeekStarting)
+	}
+	if first.Signups != 3 || first.Trials != 2 || first.Paid != 1 {
+		t.Errorf("expected 3 signups, 2 trials, 1 paid, got %+v", first)
+	}
+	assertFloat(t, "SignupToTrialRate", first.SignupToTrialRate, 2.0/3.0)
+	assertFloat(t, "TrialToPaidRate", first.TrialToPaidRate, 0.5)
+	assertFloat(t, "SignupToPaidRate", first.SignupToPaidRate, 1.0/3.0)
+	assertFloat(t, "MedianHoursSignupToTrial", first.MedianHoursSignupToTrial, 7) // (10 + 4) / 2
+	assertFloat(t, "MedianHoursTrialToPaid", first.MedianHoursTrialToPaid, 48)
+
+	second := cohorts[1]
+	if second.Signups != 1 || second.Trials != 0 || second.TrialToPaidRate != nil || second.MedianHoursSignupToTrial != nil {
+		t.Errorf("unexpected second cohort: %+v", second)
+	}
+}
+
+func assertFloat(t *testing.T, name string, got *float64, expected float64) {
+	t.Helper()
+	if got == nil {
+		t.Errorf("%s: expected %v, got nil", name, expected)
+	} else if *got < expected-0.0001 || *got > expected+0.0001 {
+		t.Errorf("%s: expected %v, got %v", name, expected, *got)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/funnel"
+
+	"google.golang.org/api/sheets/v4"
+)
+
+// funnelSource is a sheet range with a timestamp in column A and an email
+// address in column B, one row per contact reaching the given stage
+type funnelSource struct {
+	stage            funnel.Stage
+	spreadsheetIdEnv string
+	readRange        string
+}
+
+var funnelSources = []funnelSource{
+	{funnel.Signup, "GOOGLE_SHEETS_RELEASE_SIGNUPS_ID", "Recent signups!A2:B"},
+	{funnel.Trial, "GOOGLE_SHEETS_FUNNEL_ID", "Trials!A2:B"},
+	{funnel.Paid, "GOOGLE_SHEETS_FUNNEL_ID", "Paid!A2:B"},
+}
+
+// syncFunnelEvents records a funnel event for every row in the funnelSources.
+// Email addresses are hashed with FUNNEL_HASH_SALT before they're stored.
+func syncFunnelEvents(ctx context.Context, clients apiClients, store collectorStore) error {
+	salt, got := os.LookupEnv("FUNNEL_HASH_SALT")
+	if !got {
+		fmt.Print("Skipping funnel: no FUNNEL_HASH_SALT environment variable\n")
+		return errSkipped
+	}
+
+	googleClient, err := clients.google()
+	if err != nil {
+		return err
+	}
+
+	srv, err := sheets.New(googleClient)
+	if err != nil {
+		return fmt.Errorf("Unable to retrieve Sheets client: %v", err)
+	}
+
+	events := []funnel.Event{}
+
+	for _, source := range funnelSources {
+		spreadsheetId, got := os.LookupEnv(source.spreadsheetIdEnv)
+		if !got {
+			fmt.Printf("Skipping funnel %s stage: no %s environment variable\n",
+				source.stage, source.spreadsheetIdEnv)
+			continue
+		}
+
+		resp, err := srv.Spreadsheets.Values.Get(spreadsheetId, source.readRange).Context(ctx).Do()
+		if err != nil {
+			return sourceErrorf("failed to get funnel %s stage from '%s': %w", source.stage, source.readRange, err)
+		}
+
+		for _, row := range resp.Values {
+			if len(row) < 2 {
+				continue // no email address
+			}
+
+			timestampStr, ok := row[0].(string)
+			if !ok {
+				return parseErrorf("non-string cell in sheet: '%v'", row[0])
+			}
+			contact, ok := row[1].(string)
+			if !ok || strings.TrimSpace(contact) == "" {
+				continue
+			}
+
+			timefmt := "02/01/2006 15:04:05"
+			timestamp, err := time.Parse(timefmt, timestampStr)
+			if err != nil {
+				return parseErrorf("failed to parse timestamp in '%s' "+
+					"(expected format '%s'): %v", source.readRange, timefmt, err)
+			}
+
+			events = append(events, funnel.Event{
+				ContactHash: funnel.HashContact(salt, contact),
+				Stage:       source.stage,
+				OccurredAt:  timestamp,
+			})
+		}
+	}
+
+	return store.RecordFunnelEvents(events)
+}
+
+// handleFunnel serves /api/funnel: weekly cohorts of contacts who signed up in
+// the last `weeks` weeks (default 12)
+func handleFunnel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	weeks := 12
+	if weeksParam := r.URL.Query().Get("weeks"); weeksParam != "" {
+		var err error
+		weeks, err = strconv.Atoi(weeksParam)
+		if err != nil || weeks < 1 {
+			http.Error(w, "invalid weeks, expected a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	since := funnel.WeekStarting(time.Now()).AddDate(0, 0, -7*(weeks-1))
+
+	events, err := datastore.FunnelEvents(since)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responseData := struct {
+		Cohorts []funnel.Cohort `json:"cohorts"`
+	}{
+		Cohorts: funnel.Cohorts(events),
+	}
+
+	w.Header().Set("content-type", "application/json")
+	writeJSON(w, responseData)
+}
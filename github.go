@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/github"
+)
+
+// pullRequestsMergedMetric has an event for each merged pull request, labelled
+// with its repository, e.g. {"repository": "fluidkeys/fluidkeys"}
+const pullRequestsMergedMetric = "pullRequestsMerged"
+
+// the snapshots recorded each time the GitHub collector runs: a total across
+// all the repositories, and one for each repository labelled like the merged
+// pull requests
+const (
+	githubStarsSnapshotMetric        = "githubStars"
+	githubOpenIssuesSnapshotMetric   = "githubOpenIssues"
+	githubOpenPullsSnapshotMetric    = "githubOpenPullRequests"
+	githubContributorsSnapshotMetric = "githubContributors"
+)
+
+// getGitHubRepositories reads GITHUB_REPOSITORIES, a comma separated list of
+// repositories like "fluidkeys/fluidkeys,fluidkeys/dashboard"
+func getGitHubRepositories() ([]string, error) {
+	repositories := []string{}
+	for _, name := range strings.Split(os.Getenv("GITHUB_REPOSITORIES"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !github.ValidFullName(name) {
+			return nil, configErrorf("invalid repository '%s' in GITHUB_REPOSITORIES, "+
+				"expected e.g. 'fluidkeys/fluidkeys'", name)
+		}
+		repositories = append(repositories, name)
+	}
+	if len(repositories) == 0 {
+		return nil, configErrorf("no repositories in GITHUB_REPOSITORIES")
+	}
+	return repositories, nil
+}
+
+// githubActivity is what the GitHub collector records
+type githubActivity struct {
+	merged []datastore.Event
+	repositoryCounts
+
+	// repositories are the counts of each repository, in the order of
+	// GITHUB_REPOSITORIES
+	repositories []repositoryCounts
+}
+
+// repositoryCounts are the numbers snapshotted for one repository, or the
+// total of them all, which has no name
+type repositoryCounts struct {
+	name         string
+	stars        int
+	openIssues   int
+	openPulls    int
+	contributors int
+}
+
+// githubSnapshot is a count with the metric it's recorded as
+type githubSnapshot struct {
+	metric string
+	value  int
+}
+
+func (c repositoryCounts) snapshots() []githubSnapshot {
+	return []githubSnapshot{
+		{githubStarsSnapshotMetric, c.stars},
+		{githubOpenIssuesSnapshotMetric, c.openIssues},
+		{githubOpenPullsSnapshotMetric, c.openPulls},
+		{githubContributorsSnapshotMetric, c.contributors},
+	}
+}
+
+// syncGitHub records the merged pull requests of each of the repositories in
+// GITHUB_REPOSITORIES, and today's stars, open issues, open pull requests and
+// contributors, both in total and of each repository. It's skipped unless
+// GITHUB_REPOSITORIES is set.
+func syncGitHub(ctx context.Context, clients apiClients, store collectorStore) error {
+	if _, got := os.LookupEnv("GITHUB_REPOSITORIES"); !got {
+		fmt.Print("Skipping GitHub: no GITHUB_REPOSITORIES environment variable\n")
+		return errSkipped
+	}
+
+	repositories, err := getGitHubRepositories()
+	if err != nil {
+		return err
+	}
+
+	client := &github.Client{
+		BaseURL:    os.Getenv("GITHUB_API_URL"),
+		Token:      os.Getenv("GITHUB_TOKEN"),
+		HTTPClient: clients.web,
+		Cache:      responseCache{store},
+	}
+
+	activity, err := getGitHubActivity(ctx, client, repositories)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("INFO: %d GitHub requests, %d not modified\n", client.Requests, client.NotModified)
+
+	if err := store.SetMetricEvents(pullRequestsMergedMetric, activity.merged); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	for _, snapshot := range activity.snapshots() {
+		if err := store.SetMetricSnapshot(snapshot.metric, float64(snapshot.value), now); err != nil {
+			return err
+		}
+	}
+	for _, repository := range activity.repositories {
+		labels := map[string]string{"repository": repository.name}
+		for _, snapshot := range repository.snapshots() {
+			err := store.SetLabelledMetricSnapshot(snapshot.metric, labels, float64(snapshot.value), now)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// getGitHubActivity gets the activity of each of the given repositories, and
+// totals it. Someone who has contributed to more than one of them is counted
+// once in the total.
+func getGitHubActivity(ctx context.Context, client *github.Client, repositories []string) (*githubActivity, error) {
+	activity := githubActivity{merged: []datastore.Event{}}
+	contributors := map[string]bool{}
+
+	for _, name := range repositories {
+		repository, err := client.Repository(ctx, name)
+		if err != nil {
+			return nil, apiError("failed to get repository "+name, err, github.ErrUnexpectedResponse)
+		}
+
+		openPulls, err := client.PullRequests(ctx, name, "open")
+		if err != nil {
+			return nil, apiError("failed to get open pull requests of "+name, err, github.ErrUnexpectedResponse)
+		}
+
+		closedPulls, err := client.PullRequests(ctx, name, "closed")
+		if err != nil {
+			return nil, apiError("failed to get closed pull requests of "+name, err, github.ErrUnexpectedResponse)
+		}
+
+		repositoryContributors, err := client.Contributors(ctx, name)
+		if err != nil {
+			return nil, apiError("failed to get contributors of "+name, err, github.ErrUnexpectedResponse)
+		}
+
+		counts := repositoryCounts{
+			name:      name,
+			stars:     repository.Stars,
+			openPulls: len(openPulls),
+			// GitHub counts open pull requests as issues
+			openIssues:   repository.OpenIssuesAndPulls - len(openPulls),
+			contributors: len(repositoryContributors),
+		}
+		if counts.openIssues < 0 {
+			return nil, parseErrorf("got more open pull requests than open issues for %s, can't be right", name)
+		}
+		activity.repositories = append(activity.repositories, counts)
+
+		activity.stars += counts.stars
+		activity.openPulls += counts.openPulls
+		activity.openIssues += counts.openIssues
+
+		for _, pull := range closedPulls {
+			if pull.MergedAt == nil {
+				continue // closed without merging
+			}
+			activity.merged = append(activity.merged, datastore.Event{
+				OccurredAt: pull.MergedAt.UTC(),
+				SourceID:   fmt.Sprintf("%s#%d", name, pull.Number),
+				Labels:     map[string]string{"repository": name},
+			})
+		}
+
+		for _, contributor := range repositoryContributors {
+			contributors[contributor.Login] = true
+		}
+	}
+
+	activity.contributors = len(contributors)
+	return &activity, nil
+}
+
+// responseCache keeps GitHub's responses in the collector's store
+type responseCache struct {
+	store collectorStore
+}
+
+func (c responseCache) Get(url string) (*github.CachedResponse, error) {
+	response, err := c.store.HTTPResponse(url)
+	if err != nil || response == nil {
+		return nil, err
+	}
+	return &github.CachedResponse{ETag: response.ETag, Link: response.Link, Body: response.Body}, nil
+}
+
+func (c responseCache) Set(url string, response github.CachedResponse) error {
+	return c.store.SetHTTPResponse(url, datastore.HTTPResponse{
+		ETag: response.ETag, Link: response.Link, Body: response.Body,
+	})
+}
@@ -0,0 +1,293 @@
+// Package github reads repository activity from the GitHub REST API (v3).
+//
+// Every list is paged, and requests are made conditional on the ETag of the
+// last response for the same URL, if the client has a Cache. GitHub doesn't
+// count a "304 Not Modified" against the rate limit.
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultBaseURL is the public GitHub API
+const DefaultBaseURL = "https://api.github.com"
+
+// DefaultPageSize is the most items requested at once. GitHub allows up to
+// 100.
+const DefaultPageSize = 100
+
+// ErrUnexpectedResponse means the API returned something that isn't the JSON
+// we expected
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+// Repository is the part of a repository we're interested in
+type Repository struct {
+	FullName string `json:"full_name"`
+	Stars    int    `json:"stargazers_count"`
+
+	// OpenIssuesAndPulls is GitHub's `open_issues_count`, which counts open
+	// pull requests as issues too
+	OpenIssuesAndPulls int `json:"open_issues_count"`
+}
+
+// PullRequest is a single pull request
+type PullRequest struct {
+	Number int    `json:"number"`
+	State  string `json:"state"`
+
+	// MergedAt is nil unless the pull request was merged
+	MergedAt *time.Time `json:"merged_at"`
+}
+
+// Contributor is someone who has committed to a repository
+type Contributor struct {
+	Login         string `json:"login"`
+	Contributions int    `json:"contributions"`
+}
+
+// APIError is an error returned by the API
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Message    string `json:"message"`
+
+	// RateLimited is true if the request was refused because we've used up
+	// our rate limit, which GitHub reports as a 403
+	RateLimited bool `json:"-"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d %s", e.StatusCode, e.Message)
+}
+
+// IsAuthFailure returns true if the API rejected our token
+func (e *APIError) IsAuthFailure() bool {
+	return e.StatusCode == http.StatusUnauthorized || (e.StatusCode == http.StatusForbidden && !e.RateLimited)
+}
+
+// CachedResponse is the last successful response for a URL
+type CachedResponse struct {
+	ETag string
+
+	// Link is the response's Link header, which has the URL of the next page
+	Link string
+
+	Body []byte
+}
+
+// Cache keeps responses between runs so requests can be conditional
+type Cache interface {
+	// Get returns the cached response for the URL, or nil if there isn't one
+	Get(url string) (*CachedResponse, error)
+
+	Set(url string, response CachedResponse) error
+}
+
+// Client talks to the API
+type Client struct {
+	// BaseURL defaults to DefaultBaseURL
+	BaseURL string
+
+	// Token is optional, but without one the rate limit is very low
+	Token string
+
+	HTTPClient *http.Client
+
+	// Cache, if set, makes requests conditional
+	Cache Cache
+
+	// PageSize defaults to DefaultPageSize
+	PageSize int
+
+	// Requests is the number of requests made, and NotModified how many of
+	// them were answered from the Cache
+	Requests    int
+	NotModified int
+}
+
+var validFullName = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9._-]+$`)
+
+// ValidFullName returns true if name looks like "owner/repository"
+func ValidFullName(name string) bool {
+	return validFullName.MatchString(name)
+}
+
+// Repository returns the repository with the given full name, e.g.
+// "fluidkeys/fluidkeys"
+func (c *Client) Repository(ctx context.Context, fullName string) (*Repository, error) {
+	repository := Repository{}
+	if _, err := c.get(ctx, c.url("/repos/"+fullName, nil), &repository); err != nil {
+		return nil, err
+	}
+	if repository.FullName == "" {
+		return nil, fmt.Errorf("%w: no full_name for repository %s", ErrUnexpectedResponse, fullName)
+	}
+	return &repository, nil
+}
+
+// PullRequests returns every pull request in the given state: "open",
+// "closed" or "all"
+func (c *Client) PullRequests(ctx context.Context, fullName string, state string) ([]PullRequest, error) {
+	query := url.Values{}
+	query.Set("state", state)
+
+	pulls := []PullRequest{}
+	err := c.getPages(ctx, c.url("/repos/"+fullName+"/pulls", query), func(body []byte) error {
+		page := []PullRequest{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		pulls = append(pulls, page...)
+		return nil
+	})
+	return pulls, err
+}
+
+// Contributors returns everyone who has committed to the repository
+func (c *Client) Contributors(ctx context.Context, fullName string) ([]Contributor, error) {
+	contributors := []Contributor{}
+	err := c.getPages(ctx, c.url("/repos/"+fullName+"/contributors", nil), func(body []byte) error {
+		page := []Contributor{}
+		if err := json.Unmarshal(body, &page); err != nil {
+			return err
+		}
+		contributors = append(contributors, page...)
+		return nil
+	})
+	return contributors, err
+}
+
+// url returns the URL of the first page of the given path
+func (c *Client) url(path string, query url.Values) string {
+	baseURL := c.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+	if query == nil {
+		query = url.Values{}
+	}
+	query.Set("per_page", strconv.Itoa(pageSize))
+
+	return strings.TrimSuffix(baseURL, "/") + path + "?" + query.Encode()
+}
+
+// getPages calls addPage with the body of each page, following the Link
+// header's "next" URL until there isn't one
+func (c *Client) getPages(ctx context.Context, pageURL string, addPage func(body []byte) error) error {
+	for pageURL != "" {
+		response, err := c.get(ctx, pageURL, nil)
+		if err != nil {
+			return err
+		}
+		if err := addPage(response.Body); err != nil {
+			return fmt.Errorf("%w: %v", ErrUnexpectedResponse, err)
+		}
+		pageURL = nextPageURL(response.Link)
+	}
+	return nil
+}
+
+// get fetches the URL, decoding the response into v if it's not nil. If the
+// cache has a response for the URL and it hasn't changed, that's returned
+// instead.
+func (c *Client) get(ctx context.Context, requestURL string, v interface{}) (*CachedResponse, error) {
+	request, err := http.NewRequest("GET", requestURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("accept", "application/vnd.github.v3+json")
+	if c.Token != "" {
+		request.Header.Set("authorization", "Bearer "+c.Token)
+	}
+
+	var cached *CachedResponse
+	if c.Cache != nil {
+		if cached, err = c.Cache.Get(requestURL); err != nil {
+			return nil, fmt.Errorf("failed to read cached response: %v", err)
+		}
+		if cached != nil {
+			request.Header.Set("if-none-match", cached.ETag)
+		}
+	}
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	c.Requests++
+	response, err := httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+
+	var result *CachedResponse
+
+	switch {
+	case response.StatusCode == http.StatusNotModified && cached != nil:
+		c.NotModified++
+		result = cached
+
+	case response.StatusCode == http.StatusNoContent:
+		// GitHub lists the contributors of an empty repository like this
+		result = &CachedResponse{Body: []byte("[]")}
+
+	case response.StatusCode == http.StatusOK:
+		body, err := ioutil.ReadAll(response.Body)
+		if err != nil {
+			return nil, err
+		}
+		result = &CachedResponse{ETag: response.Header.Get("etag"), Link: response.Header.Get("link"), Body: body}
+
+		if c.Cache != nil && result.ETag != "" {
+			if err := c.Cache.Set(requestURL, *result); err != nil {
+				return nil, fmt.Errorf("failed to cache response: %v", err)
+			}
+		}
+
+	default:
+		apiError := &APIError{}
+		if err := json.NewDecoder(response.Body).Decode(apiError); err != nil || apiError.Message == "" {
+			apiError.Message = http.StatusText(response.StatusCode)
+		}
+		apiError.StatusCode = response.StatusCode
+		apiError.RateLimited = response.Header.Get("x-ratelimit-remaining") == "0"
+		return nil, apiError
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(result.Body, v); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrUnexpectedResponse, err)
+		}
+	}
+	return result, nil
+}
+
+var nextLink = regexp.MustCompile(`<([^>]+)>;\s*rel="next"`)
+
+// nextPageURL returns the "next" URL from a Link header like
+// `<https://api.github.com/...&page=2>; rel="next", <...>; rel="last"`, or ""
+// on the last page
+func nextPageURL(link string) string {
+	for _, part := range strings.Split(link, ",") {
+		if match := nextLink.FindStringSubmatch(part); match != nil {
+			return match[1]
+		}
+	}
+	return ""
+}
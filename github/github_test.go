@@ -0,0 +1,33 @@
+package github
+
+import "testing"
+
+func TestNextPageURL(t *testing.T) {
+	for link, expected := range map[string]string{
+		`<https://api.github.com/repositories/1/pulls?page=2>; rel="next", ` +
+			`<https://api.github.com/repositories/1/pulls?page=5>; rel="last"`: "https://api.github.com/repositories/1/pulls?page=2",
+		`<https://api.github.com/repositories/1/pulls?page=4>; rel="prev", ` +
+			`<https://api.github.com/repositories/1/pulls?page=1>; rel="first"`: "",
+		"": "",
+	} {
+		if got := nextPageURL(link); got != expected {
+			t.Errorf("%q: expected %q, got %q", link, expected, got)
+		}
+	}
+}
+
+func TestIsAuthFailure(t *testing.T) {
+	for _, test := range []struct {
+		err      APIError
+		expected bool
+	}{
+		{APIError{StatusCode: 401}, true},
+		{APIError{StatusCode: 403}, true},
+		{APIError{StatusCode: 403, RateLimited: true}, false},
+		{APIError{StatusCode: 404}, false},
+	} {
+		if got := test.err.IsAuthFailure(); got != test.expected {
+			t.Errorf("%+v: expected %v, got %v", test.err, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/fakeapi"
+	"github.com/fluidkeys/dashboard/github"
+)
+
+const testGitHubToken = "github-token"
+
+func newTestGitHub() *fakeapi.Server {
+	fake := fakeapi.NewServer()
+	fake.APIKey = testGitHubToken
+	fake.SetRepository("fluidkeys/fluidkeys", fakeapi.Repository{
+		Stars:      120,
+		OpenIssues: 7,
+		PullRequests: []fakeapi.PullRequest{
+			{Number: 1, State: "closed", MergedAt: "2019-03-25T14:02:19Z"},
+			{Number: 2, State: "closed"}, // closed without merging
+			{Number: 3, State: "closed", MergedAt: "2019-04-01T09:00:00+01:00"},
+			{Number: 4, State: "open"},
+			{Number: 5, State: "open"},
+		},
+		Contributors: []string{"paulfurley", "sammyt", "octocat"},
+	})
+	fake.SetRepository("fluidkeys/dashboard", fakeapi.Repository{
+		Stars: 3,
+		PullRequests: []fakeapi.PullRequest{
+			{Number: 9, State: "closed", MergedAt: "2019-04-02T10:00:00Z"},
+		},
+		Contributors: []string{"paulfurley", "sammyt"},
+	})
+	return fake
+}
+
+func TestGetGitHubActivity(t *testing.T) {
+	repositories := []string{"fluidkeys/fluidkeys", "fluidkeys/dashboard"}
+
+	t.Run("totals every repository", func(t *testing.T) {
+		fake := newTestGitHub()
+		defer fake.Close()
+
+		client := &github.Client{Token: testGitHubToken, HTTPClient: fake.Client(), PageSize: 2}
+		activity, err := getGitHubActivity(context.Background(), client, repositories)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if activity.stars != 123 || activity.openIssues != 7 || activity.openPulls != 2 {
+			t.Errorf("expected 123 stars, 7 open issues and 2 open pull requests, got %+v", activity)
+		}
+		if activity.contributors != 3 {
+			t.Errorf("expected each contributor to be counted once, got %d", activity.contributors)
+		}
+
+		expected := []repositoryCounts{
+			{name: "fluidkeys/fluidkeys", stars: 120, openIssues: 7, openPulls: 2, contributors: 3},
+			{name: "fluidkeys/dashboard", stars: 3, contributors: 2},
+		}
+		if len(activity.repositories) != len(expected) {
+			t.Fatalf("expected the counts of %d repositories, got %+v", len(expected), activity.repositories)
+		}
+		for i := range expected {
+			if activity.repositories[i] != expected[i] {
+				t.Errorf("expected %+v, got %+v", expected[i], activity.repositories[i])
+			}
+		}
+
+		assertEventTimes(t, []time.Time{
+			time.Date(2019, 3, 25, 14, 2, 19, 0, time.UTC),
+			time.Date(2019, 4, 1, 8, 0, 0, 0, time.UTC),
+			time.Date(2019, 4, 2, 10, 0, 0, 0, time.UTC),
+		}, activity.merged)
+
+		last := activity.merged[2]
+		if last.SourceID != "fluidkeys/dashboard#9" || last.Labels["repository"] != "fluidkeys/dashboard" {
+			t.Errorf("expected the pull request's ID and repository, got %+v", last)
+		}
+	})
+
+	t.Run("makes conditional requests", func(t *testing.T) {
+		fake := newTestGitHub()
+		defer fake.Close()
+		store := newMemoryStore()
+
+		first := &github.Client{Token: testGitHubToken, HTTPClient: fake.Client(), Cache: responseCache{store},
+			PageSize: 2}
+		expected, err := getGitHubActivity(context.Background(), first, repositories)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if first.NotModified != 0 {
+			t.Errorf("expected nothing to be cached yet, got %d not modified", first.NotModified)
+		}
+
+		second := &github.Client{Token: testGitHubToken, HTTPClient: fake.Client(), Cache: responseCache{store},
+			PageSize: 2}
+		got, err := getGitHubActivity(context.Background(), second, repositories)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		// nothing has changed, so every page is answered from the cache
+		if second.Requests != first.Requests || second.NotModified != second.Requests {
+			t.Errorf("expected all %d requests to be not modified, got %d of %d",
+				first.Requests, second.NotModified, second.Requests)
+		}
+		if got.stars != expected.stars || got.contributors != expected.contributors ||
+			len(got.merged) != len(expected.merged) {
+			t.Errorf("expected the cached responses to give %+v, got %+v", expected, got)
+		}
+	})
+
+	for _, test := range []struct {
+		name         string
+		token        string
+		failStatus   int
+		failReason   string
+		repositories []string
+		expectedKind errorKind
+	}{
+		{"wrong token", "wrong", 0, "", repositories, authError},
+		{"rate limited", testGitHubToken, http.StatusForbidden, "rateLimitExceeded", repositories, sourceError},
+		{"forbidden", testGitHubToken, http.StatusForbidden, "", repositories, authError},
+		{"unavailable", testGitHubToken, http.StatusServiceUnavailable, "", repositories, sourceError},
+		{"no such repository", testGitHubToken, 0, "", []string{"fluidkeys/nope"}, sourceError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := newTestGitHub()
+			defer fake.Close()
+			if test.failStatus != 0 {
+				fake.FailNext("/repos/fluidkeys/fluidkeys/pulls", test.failStatus, test.failReason)
+			}
+
+			client := &github.Client{Token: test.token, HTTPClient: fake.Client()}
+			_, err := getGitHubActivity(context.Background(), client, test.repositories)
+			assertErrorKind(t, err, test.expectedKind)
+		})
+	}
+}
+
+func TestSyncGitHub(t *testing.T) {
+	setEnv(t, "GITHUB_REPOSITORIES", "fluidkeys/fluidkeys, fluidkeys/dashboard")
+	setEnv(t, "GITHUB_TOKEN", testGitHubToken)
+	setEnv(t, "GITHUB_API_URL", "")
+
+	fake := newTestGitHub()
+	defer fake.Close()
+
+	store := newMemoryStore()
+	if err := syncGitHub(context.Background(), apiClients{web: fake.Client()}, store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(store.events[pullRequestsMergedMetric]) != 3 {
+		t.Errorf("expected 3 merged pull requests, got %v", store.events)
+	}
+	for metric, expected := range map[string]float64{
+		githubStarsSnapshotMetric:        123,
+		githubOpenIssuesSnapshotMetric:   7,
+		githubOpenPullsSnapshotMetric:    2,
+		githubContributorsSnapshotMetric: 3,
+
+		githubStarsSnapshotMetric + `{repository="fluidkeys/fluidkeys"}`:        120,
+		githubOpenIssuesSnapshotMetric + `{repository="fluidkeys/fluidkeys"}`:   7,
+		githubOpenPullsSnapshotMetric + `{repository="fluidkeys/fluidkeys"}`:    2,
+		githubContributorsSnapshotMetric + `{repository="fluidkeys/fluidkeys"}`: 3,
+		githubStarsSnapshotMetric + `{repository="fluidkeys/dashboard"}`:        3,
+		githubContributorsSnapshotMetric + `{repository="fluidkeys/dashboard"}`: 2,
+	} {
+		if store.snapshots[metric] != expected {
+			t.Errorf("expected %s of %v, got %v", metric, expected, store.snapshots[metric])
+		}
+	}
+	if len(store.snapshots) != 12 {
+		t.Errorf("expected 4 totals and 4 snapshots of each repository, got %v", store.snapshots)
+	}
+	if len(store.responses) == 0 {
+		t.Errorf("expected the responses to be kept for next time")
+	}
+}
+
+func TestGetGitHubRepositories(t *testing.T) {
+	setEnv(t, "GITHUB_REPOSITORIES", " fluidkeys/fluidkeys,fluidkeys/dashboard, ")
+	repositories, err := getGitHubRepositories()
+	if err != nil || len(repositories) != 2 || repositories[1] != "fluidkeys/dashboard" {
+		t.Errorf("expected 2 repositories, got %v, %v", repositories, err)
+	}
+
+	for _, invalid := range []string{"", "fluidkeys", "https://github.com/fluidkeys/fluidkeys"} {
+		setEnv(t, "GITHUB_REPOSITORIES", invalid)
+		if _, err := getGitHubRepositories(); kindOf(err) != configError {
+			t.Errorf("%q: expected a config error, got %v", invalid, err)
+		}
+	}
+}
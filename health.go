@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// defaultCollectMaxAge is how long ago each collector may have last succeeded
+// before /readyz fails, unless COLLECT_MAX_AGE is set. Collectors are run at
+// least daily.
+const defaultCollectMaxAge = 25 * time.Hour
+
+// readinessTimeout is how long /readyz waits for the database
+const readinessTimeout = 5 * time.Second
+
+// healthReport is the response of /healthz and /readyz. Status is "ok" if
+// every check is.
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []healthCheck `json:"checks,omitempty"`
+}
+
+type healthCheck struct {
+	Name string `json:"name"`
+
+	// Status is "ok" or "failing", or "skipped" for a collector that isn't
+	// configured
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+
+	DurationMs float64 `json:"durationMs"`
+
+	// LastSucceededAt is when a collector last ran without an error
+	LastSucceededAt *time.Time `json:"lastSucceededAt,omitempty"`
+}
+
+// readinessStore is what /readyz checks
+type readinessStore interface {
+	Ping(ctx context.Context) error
+	MigrationVersion(ctx context.Context) (int, error)
+	LastCollectorRun(ctx context.Context, collector string) (datastore.CollectorRun, error)
+}
+
+// databaseReadiness checks the database
+type databaseReadiness struct{}
+
+func (databaseReadiness) Ping(ctx context.Context) error {
+	return datastore.Ping(ctx)
+}
+
+func (databaseReadiness) MigrationVersion(ctx context.Context) (int, error) {
+	return datastore.MigrationVersion(ctx)
+}
+
+func (databaseReadiness) LastCollectorRun(ctx context.Context, collector string) (datastore.CollectorRun, error) {
+	return datastore.LastCollectorRun(ctx, collector)
+}
+
+// handleHealthz serves /healthz, which only checks the process is serving
+// requests
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, r, healthReport{Status: "ok"})
+}
+
+// handleReadyz serves /readyz, which checks the database can be reached and
+// is migrated, and that every collector has succeeded within maxAge, unless
+// it was skipped the last time it ran because it isn't configured. It
+// responds 503 Service Unavailable if any check fails.
+func handleReadyz(store readinessStore, maxAge time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+		defer cancel()
+
+		writeHealthReport(w, r, checkReadiness(ctx, store, maxAge, time.Now()))
+	}
+}
+
+func writeHealthReport(w http.ResponseWriter, r *http.Request, report healthReport) {
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	w.Header().Set("cache-control", "no-store")
+	if report.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	writeJSON(w, report)
+}
+
+// checkReadiness runs each check in turn. If the database can't be reached,
+// the checks that need it fail without waiting for it again.
+func checkReadiness(ctx context.Context, store readinessStore, maxAge time.Duration, now time.Time) healthReport {
+	report := healthReport{Status: "ok", Checks: []healthCheck{}}
+
+	add := func(check healthCheck) {
+		if check.Status == "failing" {
+			report.Status = "failing"
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	database := runCheck("database", func(check *healthCheck) error {
+		return store.Ping(ctx)
+	})
+	add(database)
+
+	unavailable := fmt.Errorf("skipped: the database isn't available")
+
+	add(runCheck("migrations", func(check *healthCheck) error {
+		if database.Status != "ok" {
+			return unavailable
+		}
+		version, err := store.MigrationVersion(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to read the migration version: %v", err)
+		}
+		if version < datastore.LatestMigration {
+			return fmt.Errorf("the database is at migration %d, expected %d: run migrations/migrate",
+				version, datastore.LatestMigration)
+		}
+		return nil
+	}))
+
+	for _, c := range collectors {
+		add(runCheck("collector "+c.name, func(check *healthCheck) error {
+			if database.Status != "ok" {
+				return unavailable
+			}
+			run, err := store.LastCollectorRun(ctx, c.name)
+			if err != nil {
+				return fmt.Errorf("failed to read the last run: %v", err)
+			}
+			if !run.SucceededAt.IsZero() {
+				check.LastSucceededAt = &run.SucceededAt
+			}
+
+			switch {
+			case run.Skipped():
+				check.Status = "skipped"
+				return nil
+			case run.SucceededAt.IsZero():
+				return fmt.Errorf("never succeeded")
+			}
+
+			if age := now.Sub(run.SucceededAt); age > maxAge {
+				return fmt.Errorf("last succeeded %s ago, more than COLLECT_MAX_AGE (%s)",
+					age.Round(time.Minute), maxAge)
+			}
+			return nil
+		}))
+	}
+
+	return report
+}
+
+// runCheck times the check, which is failing if it returns an error. The
+// check can set its own status otherwise.
+func runCheck(name string, check func(*healthCheck) error) healthCheck {
+	result := healthCheck{Name: name, Status: "ok"}
+
+	started := time.Now()
+	err := check(&result)
+	result.DurationMs = float64(time.Since(started).Microseconds()) / 1000
+
+	if err != nil {
+		result.Status = "failing"
+		result.Error = err.Error()
+	}
+	return result
+}
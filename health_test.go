@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+type fakeReadiness struct {
+	pingErr error
+	version int
+	runs    map[string]datastore.CollectorRun
+}
+
+func (f *fakeReadiness) Ping(ctx context.Context) error {
+	return f.pingErr
+}
+
+func (f *fakeReadiness) MigrationVersion(ctx context.Context) (int, error) {
+	return f.version, nil
+}
+
+func (f *fakeReadiness) LastCollectorRun(ctx context.Context, collector string) (datastore.CollectorRun, error) {
+	return f.runs[collector], nil
+}
+
+// newFakeReadiness is migrated, and every collector succeeded at succeededAt
+func newFakeReadiness(succeededAt time.Time) *fakeReadiness {
+	f := &fakeReadiness{version: datastore.LatestMigration, runs: map[string]datastore.CollectorRun{}}
+	for _, c := range collectors {
+		f.runs[c.name] = datastore.CollectorRun{SucceededAt: succeededAt}
+	}
+	return f
+}
+
+func TestCheckReadiness(t *testing.T) {
+	now := time.Date(2019, 4, 2, 9, 0, 0, 0, time.UTC)
+	maxAge := 25 * time.Hour
+
+	t.Run("ready", func(t *testing.T) {
+		report := checkReadiness(context.Background(), newFakeReadiness(now.Add(-24*time.Hour)), maxAge, now)
+
+		if report.Status != "ok" || len(report.Checks) != 2+len(collectors) {
+			t.Fatalf("expected %d ok checks, got %+v", 2+len(collectors), report)
+		}
+		for _, check := range report.Checks {
+			if check.Status != "ok" || check.Error != "" {
+				t.Errorf("%s: expected ok, got %+v", check.Name, check)
+			}
+		}
+		if github := findCheck(t, report, "collector GitHub"); github.LastSucceededAt == nil {
+			t.Errorf("expected when GitHub last succeeded, got %+v", github)
+		}
+	})
+
+	t.Run("stale and missing collectors", func(t *testing.T) {
+		store := newFakeReadiness(now.Add(-time.Hour))
+		store.runs["GitHub"] = datastore.CollectorRun{SucceededAt: now.Add(-26 * time.Hour)}
+		delete(store.runs, "teams")
+
+		report := checkReadiness(context.Background(), store, maxAge, now)
+
+		if report.Status != "failing" {
+			t.Errorf("expected failing, got %s", report.Status)
+		}
+		assertCheck(t, report, "database", "ok", "")
+		assertCheck(t, report, "collector GitHub", "failing",
+			"last succeeded 26h0m0s ago, more than COLLECT_MAX_AGE (25h0m0s)")
+		assertCheck(t, report, "collector teams", "failing", "never succeeded")
+		assertCheck(t, report, "collector downloads", "ok", "")
+	})
+
+	t.Run("skipped collectors", func(t *testing.T) {
+		store := newFakeReadiness(now)
+
+		// skipped since it last succeeded, which was too long ago to count
+		store.runs["downloads"] = datastore.CollectorRun{
+			SucceededAt: now.Add(-48 * time.Hour), SkippedAt: now.Add(-time.Hour),
+		}
+		store.runs["GitHub"] = datastore.CollectorRun{SkippedAt: now}
+
+		report := checkReadiness(context.Background(), store, maxAge, now)
+
+		if report.Status != "ok" {
+			t.Errorf("expected skipped collectors not to fail, got %+v", report)
+		}
+		assertCheck(t, report, "collector downloads", "skipped", "")
+		assertCheck(t, report, "collector GitHub", "skipped", "")
+	})
+
+	t.Run("not migrated", func(t *testing.T) {
+		store := newFakeReadiness(now)
+		store.version = datastore.LatestMigration - 1
+
+		report := checkReadiness(context.Background(), store, maxAge, now)
+		assertCheck(t, report, "migrations", "failing", fmt.Sprintf("the database is at migration %d, expected %d",
+			datastore.LatestMigration-1, datastore.LatestMigration))
+	})
+
+	t.Run("database down", func(t *testing.T) {
+		store := newFakeReadiness(now)
+		store.pingErr = fmt.Errorf("connection refused")
+
+		report := checkReadiness(context.Background(), store, maxAge, now)
+		for _, check := range report.Checks {
+			if check.Status != "failing" {
+				t.Errorf("%s: expected failing, got %+v", check.Name, check)
+			}
+		}
+		assertCheck(t, report, "database", "failing", "connection refused")
+		assertCheck(t, report, "migrations", "failing", "skipped: the database isn't available")
+	})
+}
+
+func TestHealthHandlers(t *testing.T) {
+	for _, test := range []struct {
+		name           string
+		handler        http.Handler
+		method         string
+		expectedStatus int
+		expectedBody   string
+	}{
+		{"healthz", http.HandlerFunc(handleHealthz), "GET", http.StatusOK, `"status": "ok"`},
+		{"healthz HEAD", http.HandlerFunc(handleHealthz), "HEAD", http.StatusOK, ""},
+		{"healthz POST", http.HandlerFunc(handleHealthz), "POST", http.StatusMethodNotAllowed, ""},
+		{"readyz", handleReadyz(newFakeReadiness(time.Now()), time.Hour), "GET", http.StatusOK,
+			`"name": "collector GitHub"`},
+		{"readyz stale", handleReadyz(newFakeReadiness(time.Now().Add(-2*time.Hour)), time.Hour), "GET",
+			http.StatusServiceUnavailable, `"status": "failing"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			test.handler.ServeHTTP(recorder, httptest.NewRequest(test.method, "/", nil))
+
+			if recorder.Code != test.expectedStatus {
+				t.Errorf("expected %d, got %d", test.expectedStatus, recorder.Code)
+			}
+			if !strings.Contains(recorder.Body.String(), test.expectedBody) {
+				t.Errorf("expected the body to contain %s, got %s", test.expectedBody, recorder.Body.String())
+			}
+			if test.expectedStatus != http.StatusMethodNotAllowed && test.method == "GET" {
+				if !json.Valid(recorder.Body.Bytes()) || recorder.Header().Get("cache-control") != "no-store" {
+					t.Errorf("expected uncached JSON, got %v %s", recorder.Header(), recorder.Body.String())
+				}
+			}
+		})
+	}
+}
+
+func findCheck(t *testing.T, report healthReport, name string) healthCheck {
+	t.Helper()
+	for _, check := range report.Checks {
+		if check.Name == name {
+			return check
+		}
+	}
+	t.Fatalf("no %s check in %+v", name, report)
+	return healthCheck{}
+}
+
+func assertCheck(t *testing.T, report healthReport, name string, status string, errorPrefix string) {
+	t.Helper()
+	check := findCheck(t, report, name)
+	if check.Status != status || !strings.HasPrefix(check.Error, errorPrefix) ||
+		(errorPrefix == "") != (check.Error == "") {
+		t.Errorf("%s: expected %s %q, got %s %q", name, status, errorPrefix, check.Status, check.Error)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/funnel"
+)
+
+// memoryStore keeps what collectors store, for checking in tests
+type memoryStore struct {
+	events    map[string][]datastore.Event
+	snapshots map[string]float64
+	teams     []datastore.TeamRow
+	responses map[string]datastore.HTTPResponse
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		events:    map[string][]datastore.Event{},
+		snapshots: map[string]float64{},
+		responses: map[string]datastore.HTTPResponse{},
+	}
+}
+
+func (s *memoryStore) SetMetricTimes(metric string, times []time.Time) error {
+	events := []datastore.Event{}
+	for _, t := range times {
+		events = append(events, datastore.Event{OccurredAt: t})
+	}
+	return s.SetMetricEvents(metric, events)
+}
+
+func (s *memoryStore) SetMetricEvents(metric string, events []datastore.Event) error {
+	s.events[metric] = events
+	return nil
+}
+
+func (s *memoryStore) SetMetricSnapshot(metric string, value float64, takenAt time.Time) error {
+	return s.SetLabelledMetricSnapshot(metric, nil, value, takenAt)
+}
+
+// SetLabelledMetricSnapshot keeps the snapshot by its metric and labels, e.g.
+// githubStars{repository="fluidkeys/fluidkeys"}
+func (s *memoryStore) SetLabelledMetricSnapshot(metric string, labels map[string]string, value float64,
+	takenAt time.Time) error {
+	s.snapshots[metric+describeLabels(labels)] = value
+	return nil
+}
+
+func (s *memoryStore) RecordFunnelEvents(events []funnel.Event) error {
+	return nil
+}
+
+func (s *memoryStore) SetTeams(teams []datastore.TeamRow) error {
+	s.teams = teams
+	return nil
+}
+
+func (s *memoryStore) HTTPResponse(url string) (*datastore.HTTPResponse, error) {
+	response, ok := s.responses[url]
+	if !ok {
+		return nil, nil
+	}
+	return &response, nil
+}
+
+func (s *memoryStore) SetHTTPResponse(url string, response datastore.HTTPResponse) error {
+	s.responses[url] = response
+	return nil
+}
+
+func (s *memoryStore) SetCollectorSucceeded(collector string, succeededAt time.Time) error {
+	return nil
+}
+
+func (s *memoryStore) SetCollectorSkipped(collector string, skippedAt time.Time) error {
+	return nil
+}
+
+// initializeTestDatabase opens an empty in-memory SQLite database for the
+// length of the test
+func initializeTestDatabase(t *testing.T) {
+	t.Helper()
+
+	if err := datastore.Initialize("sqlite://:memory:"); err != nil {
+		t.Fatalf("failed to open SQLite: %v", err)
+	}
+	t.Cleanup(func() { datastore.Close() })
+}
+
+func setEnv(t *testing.T, name string, value string) {
+	previous, existed := os.LookupEnv(name)
+	os.Setenv(name, value)
+
+	t.Cleanup(func() {
+		if existed {
+			os.Setenv(name, previous)
+		} else {
+			os.Unsetenv(name)
+		}
+	})
+}
+
+func assertErrorKind(t *testing.T, err error, expected errorKind) {
+	t.Helper()
+
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+	if kind := kindOf(err); kind != expected {
+		t.Errorf("expected error kind %d, got %d (%v)", expected, kind, err)
+	}
+}
+
+func assertEventTimes(t *testing.T, expected []time.Time, got []datastore.Event) {
+	t.Helper()
+
+	times := []time.Time{}
+	for _, event := range got {
+		times = append(times, event.OccurredAt)
+	}
+	assertTimesEqual(t, expected, times)
+}
+
+func assertTimesEqual(t *testing.T, expected []time.Time, got []time.Time) {
+	t.Helper()
+
+	if len(expected) != len(got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if !expected[i].Equal(got[i]) {
+			t.Errorf("expected %v, got %v", expected, got)
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+// Package importer reads timestamps from CSV or JSON files, for backfilling
+// metrics with data the collectors can no longer see.
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultTimeFormats are tried in order when no formats are given. They
+// cover our exports, Google Sheets form timestamps and plain dates.
+var DefaultTimeFormats = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"02/01/2006 15:04:05",
+	"2006-01-02",
+}
+
+// Options say how to read a file
+type Options struct {
+	// Format is "csv" or "json"
+	Format string
+
+	// Column is the CSV header or JSON field holding the timestamp. For a CSV
+	// without a header row, it's the column number, counting from 1.
+	Column string
+
+	// NoHeader means the CSV doesn't start with a header row
+	NoHeader bool
+
+	// TimeFormats are Go time layouts, tried in order. Defaults to
+	// DefaultTimeFormats.
+	TimeFormats []string
+
+	// Location is used for timestamps with no time zone. Defaults to UTC.
+	Location *time.Location
+}
+
+// Row is a timestamp read from a file, with its position in the file,
+// counting from 1 and not counting a CSV header or blank lines
+type Row struct {
+	Number    int
+	Timestamp time.Time
+}
+
+// ValidationError lists every row that couldn't be read
+type ValidationError struct {
+	Problems []string
+}
+
+// maxProblemsShown stops a completely wrong file filling the terminal
+const maxProblemsShown = 10
+
+func (e *ValidationError) Error() string {
+	shown := e.Problems
+	if len(shown) > maxProblemsShown {
+		shown = shown[:maxProblemsShown]
+	}
+
+	message := fmt.Sprintf("%d invalid rows:\n  %s", len(e.Problems), strings.Join(shown, "\n  "))
+	if len(e.Problems) > len(shown) {
+		message += fmt.Sprintf("\n  ... and %d more", len(e.Problems)-len(shown))
+	}
+	return message
+}
+
+// Read reads every timestamp from r. If any row is invalid, it returns a
+// *ValidationError listing all of them, so a file is imported whole or not
+// at all.
+func Read(r io.Reader, options Options) ([]Row, error) {
+	if len(options.TimeFormats) == 0 {
+		options.TimeFormats = DefaultTimeFormats
+	}
+	if options.Location == nil {
+		options.Location = time.UTC
+	}
+	if options.Column == "" {
+		return nil, fmt.Errorf("no column given")
+	}
+
+	switch options.Format {
+	case "csv":
+		return readCSV(r, options)
+	case "json":
+		return readJSON(r, options)
+	default:
+		return nil, fmt.Errorf("invalid format '%s', expected csv or json", options.Format)
+	}
+}
+
+func readCSV(r io.Reader, options Options) ([]Row, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV: %v", err)
+	}
+
+	column := -1
+
+	if options.NoHeader {
+		number, err := strconv.Atoi(options.Column)
+		if err != nil || number < 1 {
+			return nil, fmt.Errorf("invalid column '%s': without a header it must be a number, e.g. 1",
+				options.Column)
+		}
+		column = number - 1
+	} else {
+		if len(records) == 0 {
+			return nil, fmt.Errorf("file is empty, expected a header row")
+		}
+		for i, header := range records[0] {
+			if strings.TrimSpace(header) == options.Column {
+				column = i
+			}
+		}
+		if column == -1 {
+			return nil, fmt.Errorf("no column '%s' in header: %s", options.Column, strings.Join(records[0], ", "))
+		}
+		records = records[1:]
+	}
+
+	rows := []Row{}
+	problems := []string{}
+
+	for i, record := range records {
+		number := i + 1
+
+		if column >= len(record) {
+			problems = append(problems, fmt.Sprintf("row %d: no column %s", number, options.Column))
+			continue
+		}
+
+		timestamp, err := parseTimestamp(record[column], options)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("row %d: %v", number, err))
+			continue
+		}
+		rows = append(rows, Row{Number: number, Timestamp: timestamp})
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return rows, nil
+}
+
+// readJSON reads an array of objects, e.g. `[{"timestamp": "..."}]`. The
+// field can be a string in one of the TimeFormats or a number of seconds
+// since the Unix epoch.
+func readJSON(r io.Reader, options Options) ([]Row, error) {
+	objects := []map[string]interface{}{}
+	if err := json.NewDecoder(r).Decode(&objects); err != nil {
+		return nil, fmt.Errorf("failed to read JSON, expected an array of objects: %v", err)
+	}
+
+	rows := []Row{}
+	problems := []string{}
+
+	for i, object := range objects {
+		number := i + 1
+
+		var timestamp time.Time
+		var err error
+
+		switch value := object[options.Column].(type) {
+		case string:
+			timestamp, err = parseTimestamp(value, options)
+		case float64:
+			timestamp = time.Unix(int64(value), 0).In(options.Location)
+		case nil:
+			err = fmt.Errorf("no field '%s'", options.Column)
+		default:
+			err = fmt.Errorf("field '%s' is %v, expected a string or number", options.Column, value)
+		}
+
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("item %d: %v", number, err))
+			continue
+		}
+		rows = append(rows, Row{Number: number, Timestamp: timestamp})
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Problems: problems}
+	}
+	return rows, nil
+}
+
+func parseTimestamp(value string, options Options) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+
+	for _, layout := range options.TimeFormats {
+		if timestamp, err := time.ParseInLocation(layout, value, options.Location); err == nil {
+			return timestamp, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("timestamp '%s' doesn't match any of: %s",
+		value, strings.Join(options.TimeFormats, ", "))
+}
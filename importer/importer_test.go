@@ -0,0 +1,109 @@
+package importer
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadCSV(t *testing.T) {
+	file := `id,timestamp
+1,2019-03-25T14:02:19Z
+2,01/04/2019 09:00:00
+`
+	rows, err := Read(strings.NewReader(file), Options{Format: "csv", Column: "timestamp"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Row{
+		{1, time.Date(2019, 3, 25, 14, 2, 19, 0, time.UTC)},
+		{2, time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	assertRowsEqual(t, expected, rows)
+}
+
+func TestReadCSVWithoutHeader(t *testing.T) {
+	london, err := time.LoadLocation("Europe/London")
+	if err != nil {
+		t.Skip("no time zone database")
+	}
+
+	rows, err := Read(strings.NewReader("alice,2019-04-01 09:00\n"), Options{
+		Format:      "csv",
+		Column:      "2",
+		NoHeader:    true,
+		TimeFormats: []string{"2006-01-02 15:04"},
+		Location:    london,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// British Summer Time
+	assertRowsEqual(t, []Row{{1, time.Date(2019, 4, 1, 8, 0, 0, 0, time.UTC)}}, rows)
+}
+
+func TestReadJSON(t *testing.T) {
+	file := `[
+		{"arranged_for": "2019-04-01"},
+		{"arranged_for": 1554109200}
+	]`
+	rows, err := Read(strings.NewReader(file), Options{Format: "json", Column: "arranged_for"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	expected := []Row{
+		{1, time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)},
+		{2, time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)},
+	}
+	assertRowsEqual(t, expected, rows)
+}
+
+func TestReadReportsEveryInvalidRow(t *testing.T) {
+	file := `timestamp
+2019-04-01
+yesterday
+
+2019-13-01
+`
+	_, err := Read(strings.NewReader(file), Options{Format: "csv", Column: "timestamp"})
+
+	validationError, ok := err.(*ValidationError)
+	if !ok {
+		t.Fatalf("expected a validation error, got %v", err)
+	}
+	// the blank line isn't a row
+	if len(validationError.Problems) != 2 ||
+		!strings.HasPrefix(validationError.Problems[0], "row 2:") ||
+		!strings.HasPrefix(validationError.Problems[1], "row 3:") {
+		t.Errorf("expected problems in rows 2 and 3, got %v", validationError.Problems)
+	}
+}
+
+func TestReadInvalidOptions(t *testing.T) {
+	for name, options := range map[string]Options{
+		"no column":         {Format: "csv"},
+		"bad format":        {Format: "xml", Column: "timestamp"},
+		"missing column":    {Format: "csv", Column: "signed_up_at"},
+		"non-numeric index": {Format: "csv", Column: "timestamp", NoHeader: true},
+	} {
+		if _, err := Read(strings.NewReader("timestamp\n2019-04-01\n"), options); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func assertRowsEqual(t *testing.T, expected []Row, got []Row) {
+	t.Helper()
+
+	if len(expected) != len(got) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if expected[i].Number != got[i].Number || !expected[i].Timestamp.Equal(got[i].Timestamp) {
+			t.Errorf("row %d: expected %v, got %v", i, expected[i], got[i])
+		}
+	}
+}
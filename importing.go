@@ -0,0 +1,117 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/importer"
+)
+
+// stringList is a flag that can be given more than once
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// runImport backfills a metric from a CSV or JSON file, e.g. signups that
+// scrolled off the "Recent signups" tab
+func runImport(arguments []string) exitCode {
+	var timeFormats stringList
+
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	metric := flags.String("metric", "", "metric to import into: "+strings.Join(datastore.MetricNames(), ", "))
+	file := flags.String("file", "", "CSV or JSON file to import")
+	format := flags.String("format", "", "csv or json (default: from the file's extension)")
+	column := flags.String("column", "timestamp",
+		"CSV header or JSON field with the timestamp, or a column number for a CSV with --no-header")
+	noHeader := flags.Bool("no-header", false, "the CSV has no header row")
+	flags.Var(&timeFormats, "time-format", "Go time layout of the timestamps, e.g. '02/01/2006 15:04:05'. "+
+		"Can be given more than once. (default: "+strings.Join(importer.DefaultTimeFormats, ", ")+")")
+	timezone := flags.String("timezone", "UTC", "time zone of timestamps that don't have one, e.g. Europe/London")
+	flags.Parse(arguments)
+
+	if !datastore.IsMetric(*metric) {
+		fmt.Printf("Unknown metric '%s', expected one of: %s\n",
+			*metric, strings.Join(datastore.MetricNames(), ", "))
+		return 1
+	}
+
+	if *file == "" {
+		fmt.Print("No --file given\n")
+		return 1
+	}
+
+	if *format == "" {
+		*format = strings.TrimPrefix(path.Ext(*file), ".")
+	}
+
+	location, err := time.LoadLocation(*timezone)
+	if err != nil {
+		fmt.Printf("Invalid --timezone: %v\n", err)
+		return 1
+	}
+
+	in, err := os.Open(*file)
+	if err != nil {
+		fmt.Print(err.Error() + "\n")
+		return 1
+	}
+	defer in.Close()
+
+	rows, err := importer.Read(in, importer.Options{
+		Format:      *format,
+		Column:      *column,
+		NoHeader:    *noHeader,
+		TimeFormats: timeFormats,
+		Location:    location,
+	})
+	if err != nil {
+		fmt.Printf("Failed to read %s, nothing was imported: %v\n", *file, err)
+		return 1
+	}
+
+	times := []time.Time{}
+	for _, row := range rows {
+		times = append(times, row.Timestamp.UTC())
+	}
+
+	result, err := datastore.ImportMetricTimes(*metric, times)
+	if err != nil {
+		fmt.Printf("Failed to import %s, nothing was imported: %v\n", *metric, err)
+		return 1
+	}
+
+	fmt.Printf("Read %d rows from %s (%s)\n", result.Read, *file, describeTimeRange(times))
+	fmt.Printf("  %d repeated in the file\n", result.DuplicatesInFile)
+	fmt.Printf("  %d already stored\n", result.AlreadyStored)
+	fmt.Printf("  %d imported into %s\n", result.Inserted, *metric)
+	return 0
+}
+
+func describeTimeRange(times []time.Time) string {
+	if len(times) == 0 {
+		return "no rows"
+	}
+
+	oldest, newest := times[0], times[0]
+	for _, t := range times {
+		if t.Before(oldest) {
+			oldest = t
+		}
+		if t.After(newest) {
+			newest = t
+		}
+	}
+	return describeDateRange(oldest, newest)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/accesslog"
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// the metrics written by `dashboard ingest-logs`
+const (
+	pageViewsMetric      = "pageViews"
+	uniqueVisitorsMetric = "uniqueVisitors"
+	referralsMetric      = "referrals"
+)
+
+// getTrafficPaths reads TRAFFIC_PATHS, a comma separated list of the paths to
+// count, e.g. "/download,/blog/release*"
+func getTrafficPaths() []string {
+	paths := []string{}
+	for _, path := range strings.Split(os.Getenv("TRAFFIC_PATHS"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// runIngestLogs counts the page views, unique visitors and referrers of the
+// website's paths from nginx or Apache access logs, and optionally the
+// downloads of each release. Each day's totals replace what's stored for the
+// same day and path, or version.
+func runIngestLogs(arguments []string) exitCode {
+	var paths stringList
+
+	flags := flag.NewFlagSet("ingest-logs", flag.ExitOnError)
+	flags.Var(&paths, "path", "path to count, e.g. '/download' or '/blog/release*'. "+
+		"Can be given more than once. (default: from TRAFFIC_PATHS)")
+	downloads := flags.String("downloads", os.Getenv("DOWNLOAD_PATH_PATTERN"),
+		"regular expression matching the path of a release download, with the version in the first group, "+
+			"e.g. '^/download/fluidkeys_([0-9.]+)_' (default: from DOWNLOAD_PATH_PATTERN)")
+	dryRun := flags.Bool("dry-run", false, "show the daily totals without saving them")
+	flags.Usage = func() {
+		fmt.Fprint(flags.Output(), "Usage: dashboard ingest-logs [options] FILE...\n\n"+
+			"Reads access logs in the combined format, optionally gzipped. Each day's totals replace\n"+
+			"those stored for the same day and path, or version, so give every file covering those days,\n"+
+			"e.g. access.log access.log.1 access.log.2.gz\n\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(arguments)
+
+	if len(paths) == 0 {
+		paths = getTrafficPaths()
+	}
+
+	if len(paths) == 0 && *downloads == "" {
+		fmt.Print("Nothing to count: give --path or --downloads, or set TRAFFIC_PATHS or DOWNLOAD_PATH_PATTERN\n")
+		return 1
+	}
+
+	traffic, err := accesslog.NewTraffic(paths)
+	if err != nil {
+		fmt.Printf("Invalid --path or TRAFFIC_PATHS: %v\n", err)
+		return 1
+	}
+
+	if *downloads != "" {
+		downloadPath, err := regexp.Compile(*downloads)
+		if err == nil {
+			err = traffic.CountDownloads(downloadPath)
+		}
+		if err != nil {
+			fmt.Printf("Invalid --downloads or DOWNLOAD_PATH_PATTERN: %v\n", err)
+			return 1
+		}
+	}
+
+	if flags.NArg() == 0 {
+		fmt.Print("No log files given\n")
+		return 1
+	}
+
+	for _, file := range flags.Args() {
+		if err := readAccessLog(traffic, file); err != nil {
+			fmt.Printf("Failed to read %s, nothing was stored: %v\n", file, err)
+			return 1
+		}
+	}
+
+	fmt.Printf("Read %d lines from %d files\n", traffic.Lines, flags.NArg())
+	if traffic.Invalid > 0 {
+		fmt.Printf("  %d lines skipped, e.g. %s\n", traffic.Invalid, traffic.FirstProblem)
+	}
+
+	days := traffic.Days()
+	for _, totals := range days {
+		fmt.Printf("  %s %s: %d page views, %d unique visitors, %d referrers\n",
+			totals.Day.Format("2006-01-02"), totals.Pattern, totals.PageViews, totals.UniqueVisitors,
+			len(totals.Referrers))
+	}
+
+	dayDownloads := traffic.Downloads()
+	for _, downloads := range dayDownloads {
+		fmt.Printf("  %s %s: %d downloads\n", downloads.Day.Format("2006-01-02"), downloads.Version, downloads.Count)
+	}
+
+	if *dryRun {
+		fmt.Print("Dry run, nothing was saved.\n")
+		return 0
+	}
+
+	if err := storeTraffic(days, dayDownloads, len(paths) > 0, *downloads != ""); err != nil {
+		fmt.Printf("Failed to store traffic: %v\n", err)
+		return 1
+	}
+	fmt.Print("Done.\n")
+	return 0
+}
+
+func readAccessLog(traffic *accesslog.Traffic, file string) error {
+	in, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	return traffic.Read(in)
+}
+
+// storeTraffic stores the daily totals of the traffic metrics, and of the
+// downloads if they were counted, all at once so a failure stores nothing
+func storeTraffic(days []accesslog.DayTotals, dayDownloads []accesslog.DayDownloads,
+	countedPaths bool, countedDownloads bool) error {
+
+	events := map[string][]datastore.Event{}
+	if countedPaths {
+		events = trafficEvents(days)
+	}
+	if countedDownloads {
+		events[downloadsMetric] = downloadEvents(dayDownloads)
+	}
+	return datastore.MergeImportedDays(events)
+}
+
+// trafficEvents returns an event for each day and path of each of the traffic
+// metrics, with the total as its value
+func trafficEvents(days []accesslog.DayTotals) map[string][]datastore.Event {
+	events := map[string][]datastore.Event{
+		pageViewsMetric:      {},
+		uniqueVisitorsMetric: {},
+		referralsMetric:      {},
+	}
+
+	for _, totals := range days {
+		labels := map[string]string{"path": totals.Pattern}
+
+		events[pageViewsMetric] = append(events[pageViewsMetric], trafficEvent(totals.Day, totals.PageViews, labels))
+		events[uniqueVisitorsMetric] = append(events[uniqueVisitorsMetric],
+			trafficEvent(totals.Day, totals.UniqueVisitors, labels))
+
+		for referrer, count := range totals.Referrers {
+			events[referralsMetric] = append(events[referralsMetric], trafficEvent(totals.Day, count,
+				map[string]string{"path": totals.Pattern, "referrer": referrer}))
+		}
+	}
+	return events
+}
+
+// downloadEvents returns an event for each day and version with the number of
+// downloads as its value
+func downloadEvents(dayDownloads []accesslog.DayDownloads) []datastore.Event {
+	events := []datastore.Event{}
+	for _, downloads := range dayDownloads {
+		events = append(events, trafficEvent(downloads.Day, downloads.Count,
+			map[string]string{"version": downloads.Version}))
+	}
+	return events
+}
+
+func trafficEvent(day time.Time, count int, labels map[string]string) datastore.Event {
+	value := float64(count)
+	return datastore.Event{OccurredAt: day, Value: &value, Labels: labels}
+}
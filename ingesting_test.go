@@ -0,0 +1,86 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/accesslog"
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+func TestTrafficEvents(t *testing.T) {
+	day := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	events := trafficEvents([]accesslog.DayTotals{
+		{Day: day, Pattern: "/download", PageViews: 12, UniqueVisitors: 5,
+			Referrers: map[string]int{"duckduckgo.com": 3, "news.ycombinator.com": 1}},
+	})
+
+	pageViews := events[pageViewsMetric]
+	if len(pageViews) != 1 || *pageViews[0].Value != 12 || pageViews[0].Labels["path"] != "/download" ||
+		!pageViews[0].OccurredAt.Equal(day) {
+		t.Errorf("expected 12 page views of /download, got %+v", pageViews)
+	}
+
+	uniqueVisitors := events[uniqueVisitorsMetric]
+	if len(uniqueVisitors) != 1 || *uniqueVisitors[0].Value != 5 {
+		t.Errorf("expected 5 unique visitors, got %+v", uniqueVisitors)
+	}
+
+	referrals := map[string]float64{}
+	for _, event := range events[referralsMetric] {
+		referrals[event.Labels["referrer"]] = *event.Value
+	}
+	if len(referrals) != 2 || referrals["duckduckgo.com"] != 3 || referrals["news.ycombinator.com"] != 1 {
+		t.Errorf("expected referrals from each site, got %v", referrals)
+	}
+}
+
+func TestGetTrafficPaths(t *testing.T) {
+	setEnv(t, "TRAFFIC_PATHS", " /download, /blog/release*,")
+	if paths := getTrafficPaths(); len(paths) != 2 || paths[1] != "/blog/release*" {
+		t.Errorf("expected 2 paths, got %v", paths)
+	}
+}
+
+func TestDownloadEvents(t *testing.T) {
+	day := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	events := downloadEvents([]accesslog.DayDownloads{{Day: day, Version: "0.2.6", Count: 7}})
+
+	if len(events) != 1 || *events[0].Value != 7 || events[0].Labels["version"] != "0.2.6" ||
+		!events[0].OccurredAt.Equal(day) {
+		t.Errorf("expected 7 downloads of 0.2.6, got %+v", events)
+	}
+}
+
+func TestStoreTraffic(t *testing.T) {
+	initializeTestDatabase(t)
+
+	day := time.Date(2019, 4, 1, 0, 0, 0, 0, time.UTC)
+	days := []accesslog.DayTotals{
+		{Day: day, Pattern: "/download", PageViews: 12, UniqueVisitors: 5,
+			Referrers: map[string]int{"duckduckgo.com": 3}},
+	}
+	dayDownloads := []accesslog.DayDownloads{{Day: day, Version: "0.2.6", Count: 7}}
+
+	if err := storeTraffic(days, dayDownloads, true, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// a later run only counting downloads, from more of the day's logs
+	dayDownloads = []accesslog.DayDownloads{{Day: day, Version: "0.2.6", Count: 9}}
+	if err := storeTraffic(nil, dayDownloads, false, true); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	for metric, expected := range map[string]int{
+		pageViewsMetric:      12,
+		uniqueVisitorsMetric: 5,
+		referralsMetric:      3,
+		downloadsMetric:      9,
+	} {
+		total, err := datastore.Total(metric, datastore.Dates(day, day), nil)
+		if err != nil || total != expected {
+			t.Errorf("%s: expected %d, got %d, %v", metric, expected, total, err)
+		}
+	}
+}
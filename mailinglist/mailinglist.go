@@ -0,0 +1,179 @@
+// Package mailinglist reads the members of a mailing list from a provider
+// with a Mailchimp-compatible API (version 3.0).
+package mailinglist
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// DefaultPageSize is the most members requested at once. Mailchimp allows up
+// to 1000.
+const DefaultPageSize = 1000
+
+// Member statuses
+const (
+	Subscribed    = "subscribed"
+	Unsubscribed  = "unsubscribed"
+	Cleaned       = "cleaned"
+	Pending       = "pending"
+	Transactional = "transactional"
+	Archived      = "archived"
+)
+
+// ErrUnexpectedResponse means the API returned something that isn't the JSON
+// we expected
+var ErrUnexpectedResponse = errors.New("unexpected response")
+
+// Member is a single member of a list. Timestamps are as returned by the API,
+// e.g. "2019-03-25T14:02:19+00:00", and can be empty.
+type Member struct {
+	ID     string `json:"id"`
+	Status string `json:"status"`
+
+	// TimestampSignup is when they filled in the signup form
+	TimestampSignup string `json:"timestamp_signup"`
+
+	// TimestampOpt is when they confirmed their subscription
+	TimestampOpt string `json:"timestamp_opt"`
+
+	// LastChanged is when their status last changed, e.g. when they
+	// unsubscribed
+	LastChanged string `json:"last_changed"`
+}
+
+// APIError is an error returned by the API, in its "problem detail" format
+type APIError struct {
+	StatusCode int    `json:"status"`
+	Title      string `json:"title"`
+	Detail     string `json:"detail"`
+}
+
+func (e *APIError) Error() string {
+	message := fmt.Sprintf("%d %s", e.StatusCode, e.Title)
+	if e.Detail != "" {
+		message += ": " + e.Detail
+	}
+	return message
+}
+
+// IsAuthFailure returns true if the API rejected our API key
+func (e *APIError) IsAuthFailure() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// Client talks to the API
+type Client struct {
+	// BaseURL is e.g. "https://us1.api.mailchimp.com/3.0"
+	BaseURL string
+
+	APIKey     string
+	HTTPClient *http.Client
+
+	// PageSize defaults to DefaultPageSize
+	PageSize int
+}
+
+// DefaultBaseURL returns the Mailchimp API URL for the data center in the
+// given API key, which ends with e.g. "-us1"
+func DefaultBaseURL(apiKey string) (string, error) {
+	parts := strings.Split(apiKey, "-")
+	if len(parts) != 2 || parts[1] == "" {
+		return "", fmt.Errorf("API key doesn't end with a data center, e.g. '-us1'")
+	}
+	return "https://" + parts[1] + ".api.mailchimp.com/3.0", nil
+}
+
+// Members returns every member of the list, whatever their status
+func (c *Client) Members(ctx context.Context, listID string) ([]Member, error) {
+	pageSize := c.PageSize
+	if pageSize <= 0 {
+		pageSize = DefaultPageSize
+	}
+
+	members := []Member{}
+
+	for offset := 0; ; offset += pageSize {
+		query := url.Values{}
+		query.Set("count", strconv.Itoa(pageSize))
+		query.Set("offset", strconv.Itoa(offset))
+		query.Set("fields", "total_items,members.id,members.status,"+
+			"members.timestamp_signup,members.timestamp_opt,members.last_changed")
+
+		page := struct {
+			Members    []Member `json:"members"`
+			TotalItems *int     `json:"total_items"`
+		}{}
+		if err := c.get(ctx, "/lists/"+url.PathEscape(listID)+"/members", query, &page); err != nil {
+			return nil, err
+		}
+		if page.TotalItems == nil {
+			return nil, fmt.Errorf("%w: no total_items in members page", ErrUnexpectedResponse)
+		}
+
+		members = append(members, page.Members...)
+
+		if len(page.Members) == 0 || offset+len(page.Members) >= *page.TotalItems {
+			return members, nil
+		}
+	}
+}
+
+// MemberCount returns the number of subscribed members of the list
+func (c *Client) MemberCount(ctx context.Context, listID string) (int, error) {
+	query := url.Values{}
+	query.Set("fields", "stats.member_count")
+
+	list := struct {
+		Stats *struct {
+			MemberCount int `json:"member_count"`
+		} `json:"stats"`
+	}{}
+	if err := c.get(ctx, "/lists/"+url.PathEscape(listID), query, &list); err != nil {
+		return 0, err
+	}
+	if list.Stats == nil {
+		return 0, fmt.Errorf("%w: no stats for list", ErrUnexpectedResponse)
+	}
+	return list.Stats.MemberCount, nil
+}
+
+func (c *Client) get(ctx context.Context, path string, query url.Values, v interface{}) error {
+	request, err := http.NewRequest("GET", strings.TrimSuffix(c.BaseURL, "/")+path+"?"+query.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	// the API accepts any username with the API key as the password
+	request.SetBasicAuth("dashboard", c.APIKey)
+
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+
+	response, err := httpClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		apiError := &APIError{}
+		if err := json.NewDecoder(response.Body).Decode(apiError); err != nil || apiError.Title == "" {
+			apiError.Title = http.StatusText(response.StatusCode)
+		}
+		apiError.StatusCode = response.StatusCode
+		return apiError
+	}
+
+	if err := json.NewDecoder(response.Body).Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnexpectedResponse, err)
+	}
+	return nil
+}
@@ -1,17 +1,24 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"runtime/debug"
 	"strings"
+	"syscall"
 	"time"
 
+	"github.com/fluidkeys/dashboard/cache"
 	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/retry"
 
-	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/calendar/v3"
@@ -21,13 +28,32 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "--help" {
+		os.Exit(printUsage())
+	}
+
+	if err := datastore.InitializeFromEnvironment(); err != nil {
+		log.Fatal("failed to connect to database: ", err)
+	}
+
+	if err := datastore.SetManualMetrics(getManualMetricNames()); err != nil {
+		log.Fatal("invalid MANUAL_METRICS: ", err)
+	}
 
 	if len(os.Args) == 1 {
 		os.Exit(runWebserver())
 	} else if os.Args[1] == "collect" {
-		os.Exit(runCollectors())
-	} else if os.Args[1] == "--help" {
-		os.Exit(printUsage())
+		os.Exit(runCollectors(os.Args[2:]))
+	} else if os.Args[1] == "digest" {
+		os.Exit(runDigest(os.Args[2:]))
+	} else if os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	} else if os.Args[1] == "snapshot" {
+		os.Exit(runSnapshot())
+	} else if os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	} else if os.Args[1] == "ingest-logs" {
+		os.Exit(runIngestLogs(os.Args[2:]))
 	}
 }
 
@@ -35,66 +61,135 @@ func printUsage() exitCode {
 	usage := fmt.Sprintf(`
 Usage:
 	dashboard              run the webserver
-	dashboard collect      run the data collectors
+	dashboard collect      run the data collectors, then evaluate alerts
+	                       (--dry-run to show what would change instead)
+	dashboard digest       email the weekly digest (--stdout to print it instead)
+	dashboard export       export a metric as CSV or JSON (--help for options)
+	dashboard snapshot     record today's value of the live metrics
+	dashboard import       backfill a metric from a CSV or JSON file (--help for options)
+	dashboard ingest-logs  count website traffic from access logs (--help for options)
+
+Exit codes for collect:
+	1  unexpected error, e.g. a collector panicked or the database failed
+	2  configuration error, e.g. a missing environment variable
+	3  authentication error, e.g. an expired Google API token
+	4  source error, e.g. a source was unreachable after retries
+	5  parse error, e.g. a source returned data in an unexpected format
 `)
 	fmt.Print(usage)
 	return 0
 }
 
-func runWebserver() exitCode {
-	http.HandleFunc("/json", handleJSONIndex)
-	http.Handle("/", http.FileServer(http.Dir("./static")))
-	err := http.ListenAndServe(Port(), nil)
-	if err != nil {
-		log.Fatal("ListenAndServe: ", err)
-		return 1
-	}
-	return 0
-}
+// handleJSONIndex serves all the metrics as JSON. The response is cached until
+// it's older than the cache's TTL or the data changes, including when it's
+// changed by `collect`, `import` or `ingest-logs` in another process.
+func handleJSONIndex(metricsCache *cache.Cache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		compare := r.URL.Query().Get("compare")
+		if compare != "" && compare != comparePreviousPeriod && compare != comparePreviousYear {
+			http.Error(w, fmt.Sprintf("invalid compare '%s', expected %s or %s",
+				compare, comparePreviousPeriod, comparePreviousYear), http.StatusBadRequest)
+			return
+		}
+
+		changedAt, err := datastore.LastChanged()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		metricsCache.SetVersion(changedAt.String())
+
+		entry, err := metricsCache.Get("json?compare="+compare, func() ([]byte, error) {
+			responseData, err := getJSONIndex(compare)
+			if err != nil {
+				return nil, err
+			}
+			return json.MarshalIndent(responseData, "", "    ")
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 
-func handleJSONIndex(w http.ResponseWriter, r *http.Request) {
-	if r.Method != "GET" {
-		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
-		return
+		cache.Serve(w, r, entry, "application/json")
 	}
+}
 
+// getJSONIndex gets all the metrics shown on the dashboard. If compare is set
+// (previous_period or previous_year) it includes the comparison series too.
+func getJSONIndex(compare string) (*jsonIndex, error) {
 	var err error
 
+	now := time.Now()
+	last30Days := datastore.LastNDays(30, now)
 	responseData := jsonIndex{}
 
-	responseData.ReleaseNotesSignups, err = datastore.NumberOfReleaseNotesSignupsLast30Days()
+	responseData.ReleaseNotesSignups, err = datastore.Series("signups", last30Days, datastore.Day, nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	responseData.TrialsStarted, err = datastore.NumberOfTrialsStartedLast30Days()
+	responseData.ReleaseNotesUnsubscribes, err = datastore.Series("unsubscribes", last30Days, datastore.Day, nil)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	responseData.DaysSinceLastRelease, err = datastore.DaysSinceLastReleaseAnnouncement()
+	responseData.ReleaseNotesNetGrowth, err = netGrowth(
+		responseData.ReleaseNotesSignups, responseData.ReleaseNotesUnsubscribes)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	responseData.CallsArrangedNext7Days, err = datastore.NumberOfCallsArrangedNext7Days()
+	sizeBefore, err := listSizeBefore(last30Days.From)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
+	responseData.ReleaseNotesListSize = listSize(sizeBefore, responseData.ReleaseNotesNetGrowth)
 
-	out, err := json.MarshalIndent(responseData, "", "    ")
+	responseData.TrialsStarted, err = datastore.Series("trials", last30Days, datastore.Day, nil)
+	if err != nil {
+		return nil, err
+	}
 
+	if compare != "" {
+		responseData.Comparison, err = getComparison(
+			compare, responseData.ReleaseNotesSignups, responseData.ReleaseNotesNetGrowth, responseData.TrialsStarted)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// left out until something's been released, rather than failing
+	days, err := daysSinceLastRelease(now)
+	if err == nil {
+		responseData.DaysSinceLastRelease = &days
+	} else if err != errNoReleases {
+		return nil, err
+	}
+
+	responseData.CallsArrangedNext7Days, err = callsArrangedNext7Days(now)
+	if err != nil {
+		return nil, err
+	}
+
+	responseData.CallsArrangedNext7DaysHistory, err = datastore.MetricSnapshots(
+		"callsArrangedNext7Days", nil, snapshotHistoryDays)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		return nil, err
 	}
 
-	w.Header().Set("content-type", "application/json")
-	w.Write(out)
+	responseData.DaysSinceLastReleaseHistory, err = datastore.MetricSnapshots(
+		"daysSinceLastRelease", nil, snapshotHistoryDays)
+	if err != nil {
+		return nil, err
+	}
+
+	return &responseData, nil
 }
 
 // Port retrieves the port from the environment so we can run on Heroku
@@ -108,28 +203,28 @@ func Port() string {
 	return ":" + port
 }
 
-func runCollectors() exitCode {
+func runCollectors(arguments []string) exitCode {
+	flags := flag.NewFlagSet("collect", flag.ExitOnError)
+	dryRun := flags.Bool("dry-run", false,
+		"fetch and validate everything, then show how the database would change, without saving anything")
+	flags.Parse(arguments)
 
-	httpClient, err := getOauthClient()
-	if err != nil {
-		panic(err)
-	}
+	// on SIGTERM, e.g. from Heroku's scheduler, cancel what's running rather
+	// than being killed part way through
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
 
 	var errors []error
 
-	err = syncReleaseAnnouncements(httpClient)
-	if err != nil {
-		errors = append(errors, err)
-	}
+	if *dryRun {
+		store := &dryRunStore{}
+		errors = collectInto(ctx, store)
 
-	err = syncReleaseSignups(httpClient)
-	if err != nil {
-		errors = append(errors, err)
-	}
-
-	err = syncCallsArrangedFromCalendar(httpClient)
-	if err != nil {
-		errors = append(errors, err)
+		fmt.Print("\nDry run, nothing was saved. The database would change like this:\n\n")
+		store.printDiffs(os.Stdout)
+		fmt.Print("\n")
+	} else {
+		errors = collect(ctx)
 	}
 
 	if len(errors) > 0 {
@@ -137,18 +232,153 @@ func runCollectors() exitCode {
 		for _, err := range errors {
 			fmt.Print(" * " + err.Error() + "\n")
 		}
-		return 1
+		return exitCodeFor(errors)
 	}
 
 	fmt.Print("Done.\n")
-	return 0
+	return exitOK
+}
+
+// apiClients are the HTTP clients passed to each collector. Both retry
+// transient failures; google also authenticates with the Google API token, so
+// it mustn't be used for requests to anywhere else.
+type apiClients struct {
+	web *http.Client
+
+	// newGoogle is only called by collectors that use Google APIs, so the
+	// others still run if the Google API token isn't configured
+	newGoogle func() (*http.Client, error)
+}
+
+// google returns the client for Google APIs, or a config error if the Google
+// API token isn't configured
+func (c apiClients) google() (*http.Client, error) {
+	if c.newGoogle == nil {
+		return nil, configErrorf("no Google API client")
+	}
+	return c.newGoogle()
+}
+
+// collector fetches one kind of data from an external service and stores it
+type collector struct {
+	name string
+	sync func(ctx context.Context, clients apiClients, store collectorStore) error
+}
+
+var collectors = []collector{
+	{"release announcements", syncReleaseAnnouncements},
+	{"release note signups", syncReleaseSignups},
+	{"release note unsubscribes", syncReleaseUnsubscribes},
+	{"mailing list", syncMailingList},
+	{"calls arranged", syncCallsArrangedFromCalendar},
+	{"funnel", syncFunnelEvents},
+	{"teams", syncTeams},
+	{"GitHub", syncGitHub},
+	{"downloads", syncDownloads},
+}
+
+// defaultCollectorTimeout is how long each collector gets, including retries,
+// unless COLLECTOR_TIMEOUT is set
+const defaultCollectorTimeout = 2 * time.Minute
+
+// collect runs all the collectors, saving to the database, then evaluates the
+// alerts, returning any errors encountered along the way. If ctx is cancelled,
+// the collector running is cancelled and the rest are skipped.
+func collect(ctx context.Context) []error {
+	errors := collectInto(ctx, databaseStore{})
+	if ctx.Err() != nil {
+		return errors
+	}
+
+	if err := runAlerts(); err != nil {
+		errors = append(errors, err)
+	}
+	return errors
+}
+
+// collectInto runs all the collectors, saving what they fetch to store, until
+// ctx is cancelled
+func collectInto(ctx context.Context, store collectorStore) []error {
+	timeout := defaultCollectorTimeout
+	if timeoutString, got := os.LookupEnv("COLLECTOR_TIMEOUT"); got {
+		var err error
+		timeout, err = time.ParseDuration(timeoutString)
+		if err != nil || timeout <= 0 {
+			return []error{configErrorf("invalid COLLECTOR_TIMEOUT '%s', expected e.g. '2m'", timeoutString)}
+		}
+	}
+
+	transport := retry.NewTransport(http.DefaultTransport, retry.DefaultPolicy)
+	transport.OnRetry = func(request *http.Request, attempt int, wait time.Duration, reason string) {
+		fmt.Printf("INFO: retrying %s %s%s (attempt %d) in %s: %s\n",
+			request.Method, request.URL.Host, request.URL.Path, attempt, wait.Round(time.Millisecond), reason)
+	}
+	webClient := &http.Client{Transport: transport}
+
+	clients := apiClients{
+		web: webClient,
+		newGoogle: func() (*http.Client, error) {
+			return getOauthClient(context.WithValue(context.Background(), oauth2.HTTPClient, webClient))
+		},
+	}
+
+	var errors []error
+
+	for _, c := range collectors {
+		if ctx.Err() != nil {
+			errors = append(errors, fmt.Errorf("stopped before %s: %w", c.name, ctx.Err()))
+			break
+		}
+
+		before := transport.Stats()
+		started := time.Now()
+
+		err := runCollector(ctx, c, clients, store, timeout)
+
+		outcome := "ok"
+		switch {
+		case err == errSkipped:
+			outcome = "skipped"
+			err = store.SetCollectorSkipped(c.name, time.Now())
+		case err == nil:
+			err = store.SetCollectorSucceeded(c.name, time.Now())
+		}
+		if err != nil {
+			outcome = "failed"
+			errors = append(errors, fmt.Errorf("%s: %w", c.name, err))
+		}
+		fmt.Printf("INFO: collector %s: %s in %s (%s)\n",
+			c.name, outcome, time.Since(started).Round(time.Millisecond), transport.Stats().Sub(before))
+	}
+
+	return errors
+}
+
+// runCollector runs a single collector with a timeout. If it panics, the panic
+// is returned as an error so the other collectors still run.
+func runCollector(ctx context.Context, c collector, clients apiClients, store collectorStore,
+	timeout time.Duration) (err error) {
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fmt.Printf("ERROR: collector %s panicked: %v\n%s", c.name, recovered, debug.Stack())
+			err = fmt.Errorf("panicked: %v", recovered)
+		}
+	}()
+
+	return c.sync(ctx, clients, store)
 }
 
-func getOauthClient() (*http.Client, error) {
+// getOauthClient returns a client authenticated with the Google API token.
+// Requests are sent with the oauth2.HTTPClient in ctx, if any.
+func getOauthClient(ctx context.Context) (*http.Client, error) {
 	credentialsJson, got := os.LookupEnv("GOOGLE_API_CREDENTIALS_JSON")
 
 	if !got {
-		return nil, fmt.Errorf("Missing GOOGLE_API_CREDENTIALS_JSON environment variable")
+		return nil, configErrorf("Missing GOOGLE_API_CREDENTIALS_JSON environment variable")
 	}
 
 	config, err := google.ConfigFromJSON(
@@ -156,112 +386,185 @@ func getOauthClient() (*http.Client, error) {
 		"https://www.googleapis.com/auth/spreadsheets.readonly",
 	)
 	if err != nil {
-		return nil, fmt.Errorf("Unable to parse client secret file to config: %v", err)
+		return nil, configErrorf("Unable to parse client secret file to config: %v", err)
 	}
 
 	tokenJson, got := os.LookupEnv("GOOGLE_API_TOKEN_JSON")
 
 	if !got {
-		panic(fmt.Errorf("Missing GOOGLE_API_TOKEN_JSON environment variable"))
+		return nil, configErrorf("Missing GOOGLE_API_TOKEN_JSON environment variable")
 	}
 
 	oauthToken := &oauth2.Token{}
 	err = json.NewDecoder(strings.NewReader(tokenJson)).Decode(oauthToken)
 	if err != nil {
-		return nil, err
+		return nil, configErrorf("Unable to parse GOOGLE_API_TOKEN_JSON: %v", err)
 	}
 
-	return config.Client(context.Background(), oauthToken), nil
+	return config.Client(ctx, oauthToken), nil
 }
 
-func syncReleaseAnnouncements(client *http.Client) error {
-	releaseAnnouncementTimes, err := getReleaseAnnouncementTimes(client)
+func syncReleaseAnnouncements(ctx context.Context, clients apiClients, store collectorStore) error {
+	releaseAnnouncements, err := getReleaseAnnouncements(ctx, clients.web)
 	if err != nil {
 		return err
 	}
 
-	return datastore.SetReleaseAnnouncementTimes(releaseAnnouncementTimes)
+	return store.SetMetricEvents("releases", releaseAnnouncements)
 }
 
-func getReleaseAnnouncementTimes(client *http.Client) ([]time.Time, error) {
-	fp := gofeed.NewParser()
-	feed, err := fp.ParseURL("https://www.fluidkeys.com/blog/feed.xml")
+// getReleaseAnnouncements returns an event for each release post on the blog,
+// labelled with the release's version if it has one, e.g.
+// {"version": "0.2.6"}
+func getReleaseAnnouncements(ctx context.Context, client *http.Client) ([]datastore.Event, error) {
+	request, err := http.NewRequest("GET", "https://www.fluidkeys.com/blog/feed.xml", nil)
 	if err != nil {
 		return nil, err
 	}
 
-	announcementTimes := []time.Time{}
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, sourceErrorf("failed to get blog feed: %w", err)
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, sourceErrorf("failed to get blog feed: %s", response.Status)
+	}
+
+	feed, err := gofeed.NewParser().Parse(response.Body)
+	if err != nil {
+		return nil, parseErrorf("failed to parse blog feed: %v", err)
+	}
+
+	announcements := []datastore.Event{}
 	for _, item := range feed.Items {
 		if strings.Contains(item.Link, `/blog/release`) {
 			// e.g. `<pubDate>Tue, 26 Mar 2019 00:00:00 +0000</pubDate>`
 			timestamp, err := time.Parse("Mon, 02 Jan 2006 15:04:05 +0000", item.Published)
 
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse date for '%s': %v", item.Title, err)
+				return nil, parseErrorf("failed to parse date for '%s': %v", item.Title, err)
 			}
 			fmt.Printf("Release announcement: '%s' — %s — %s\n", item.Title, item.Link, timestamp)
-			announcementTimes = append(announcementTimes, timestamp)
+
+			announcement := datastore.Event{OccurredAt: timestamp, SourceID: item.Link}
+			if version := releaseVersion(item.Title, item.Link); version != "" {
+				announcement.Labels = map[string]string{"version": version}
+			}
+			announcements = append(announcements, announcement)
 		}
 	}
 
-	if len(announcementTimes) == 0 {
-		return nil, fmt.Errorf("got 0 release announcements, can't be right")
+	if len(announcements) == 0 {
+		return nil, sourceErrorf("got 0 release announcements, can't be right")
 	}
 
-	return announcementTimes, nil
+	return announcements, nil
+}
+
+var (
+	versionInTitle = regexp.MustCompile(`\bv?(\d+(?:\.\d+)+)\b`)
+	versionInLink  = regexp.MustCompile(`/release-(\d+(?:-\d+)+)/?$`)
+)
+
+// releaseVersion returns the version of a release post, e.g. "0.2.6" from the
+// title "Release 0.2.6: team invitations" or the link ".../release-0-2-6/",
+// or "" if it doesn't say
+func releaseVersion(title string, link string) string {
+	if match := versionInTitle.FindStringSubmatch(title); match != nil {
+		return match[1]
+	}
+	if match := versionInLink.FindStringSubmatch(link); match != nil {
+		return strings.ReplaceAll(match[1], "-", ".")
+	}
+	return ""
 }
 
-func syncReleaseSignups(client *http.Client) error {
-	signupTimes, err := getReleaseNoteSignupTimes(client)
+func syncReleaseSignups(ctx context.Context, clients apiClients, store collectorStore) error {
+	if mailingListConfigured() {
+		fmt.Print("Skipping release note signups from Google Sheets: using the mailing list instead\n")
+		return errSkipped
+	}
+
+	googleClient, err := clients.google()
+	if err != nil {
+		return err
+	}
+
+	signupTimes, err := getReleaseNoteSignupTimes(ctx, googleClient)
 	if err != nil {
 		return err
 	}
 
-	return datastore.SetReleaseNoteSignupTimes(signupTimes)
+	return store.SetMetricTimes("signups", signupTimes)
 }
 
-func syncCallsArrangedFromCalendar(client *http.Client) error {
-	callsArrangedTimes, err := getCallsArrangedFromCalendar(client)
+func syncReleaseUnsubscribes(ctx context.Context, clients apiClients, store collectorStore) error {
+	if mailingListConfigured() {
+		fmt.Print("Skipping release note unsubscribes from Google Sheets: using the mailing list instead\n")
+		return errSkipped
+	}
 
+	googleClient, err := clients.google()
 	if err != nil {
 		return err
 	}
 
-	return datastore.SetCallsArrangedTimes(callsArrangedTimes)
+	unsubscribeTimes, err := getReleaseNoteUnsubscribeTimes(ctx, googleClient)
+	if err != nil {
+		return err
+	}
+
+	return store.SetMetricTimes("unsubscribes", unsubscribeTimes)
+}
+
+func syncCallsArrangedFromCalendar(ctx context.Context, clients apiClients, store collectorStore) error {
+	googleClient, err := clients.google()
+	if err != nil {
+		return err
+	}
+
+	callsArrangedTimes, err := getCallsArrangedFromCalendar(ctx, googleClient)
+	if err != nil {
+		return err
+	}
+
+	return store.SetMetricTimes("calls", callsArrangedTimes)
 }
 
-func getReleaseNoteSignupTimes(client *http.Client) ([]time.Time, error) {
+func getReleaseNoteSignupTimes(ctx context.Context, client *http.Client) ([]time.Time, error) {
 
 	srv, err := sheets.New(client)
 	if err != nil {
-		log.Fatalf("Unable to retrieve Sheets client: %v", err)
+		return nil, fmt.Errorf("Unable to retrieve Sheets client: %v", err)
 	}
 
 	spreadsheetId, got := os.LookupEnv("GOOGLE_SHEETS_RELEASE_SIGNUPS_ID")
 	if !got {
-		return nil, fmt.Errorf("Missing GOOGLE_SHEETS_RELEASE_SIGNUPS_ID environment variable")
+		return nil, configErrorf("Missing GOOGLE_SHEETS_RELEASE_SIGNUPS_ID environment variable")
 	}
 
 	readRange := "Recent signups!A2:B"
-	resp, err := srv.Spreadsheets.Values.Get(spreadsheetId, readRange).Do()
+	resp, err := srv.Spreadsheets.Values.Get(spreadsheetId, readRange).Context(ctx).Do()
 	if err != nil {
-		log.Fatalf("Unable to retrieve data from sheet: %v", err)
+		return nil, sourceErrorf("Unable to retrieve data from sheet: %w", err)
 	}
 
 	if len(resp.Values) == 0 {
-		return nil, fmt.Errorf("No data found, length of resp.Values == 0")
+		return nil, sourceErrorf("No data found, length of resp.Values == 0")
 	}
 
 	var signupTimes []time.Time
 
 	for _, row := range resp.Values {
 		if timestampStr, ok := row[0].(string); !ok {
-			return nil, fmt.Errorf("non-string cell in sheet: '%v'", row[0])
+			return nil, parseErrorf("non-string cell in sheet: '%v'", row[0])
 		} else {
 			timefmt := "02/01/2006 15:04:05"
 			timestamp, err := time.Parse(timefmt, timestampStr)
 			if err != nil {
-				return nil, fmt.Errorf("failed to parse timestamp "+
+				return nil, parseErrorf("failed to parse timestamp "+
 					"(expected format '%s'): %v", timefmt, err)
 			}
 			signupTimes = append(signupTimes, timestamp)
@@ -271,10 +574,51 @@ func getReleaseNoteSignupTimes(client *http.Client) ([]time.Time, error) {
 	return signupTimes, nil
 }
 
-func getCallsArrangedFromCalendar(client *http.Client) ([]time.Time, error) {
+// getReleaseNoteUnsubscribeTimes reads the "Unsubscribes" tab of the release
+// signups sheet, which has the time of each unsubscribe in column A
+func getReleaseNoteUnsubscribeTimes(ctx context.Context, client *http.Client) ([]time.Time, error) {
+	srv, err := sheets.New(client)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to retrieve Sheets client: %v", err)
+	}
+
+	spreadsheetId, got := os.LookupEnv("GOOGLE_SHEETS_RELEASE_SIGNUPS_ID")
+	if !got {
+		return nil, configErrorf("Missing GOOGLE_SHEETS_RELEASE_SIGNUPS_ID environment variable")
+	}
+
+	readRange := "Unsubscribes!A2:A"
+	resp, err := srv.Spreadsheets.Values.Get(spreadsheetId, readRange).Context(ctx).Do()
+	if err != nil {
+		return nil, sourceErrorf("Unable to retrieve unsubscribes from sheet: %w", err)
+	}
+
+	// unlike signups, it's fine to have no unsubscribes
+	unsubscribeTimes := []time.Time{}
+
+	for _, row := range resp.Values {
+		if len(row) == 0 {
+			continue
+		}
+		if timestampStr, ok := row[0].(string); !ok {
+			return nil, parseErrorf("non-string cell in sheet: '%v'", row[0])
+		} else {
+			timefmt := "02/01/2006 15:04:05"
+			timestamp, err := time.Parse(timefmt, timestampStr)
+			if err != nil {
+				return nil, parseErrorf("failed to parse unsubscribe timestamp "+
+					"(expected format '%s'): %v", timefmt, err)
+			}
+			unsubscribeTimes = append(unsubscribeTimes, timestamp)
+		}
+	}
+	return unsubscribeTimes, nil
+}
+
+func getCallsArrangedFromCalendar(ctx context.Context, client *http.Client) ([]time.Time, error) {
 	srv, err := calendar.New(client)
 	if err != nil {
-		log.Fatalf("Unable to retrieve Calendar client: %v", err)
+		return nil, fmt.Errorf("Unable to retrieve Calendar client: %v", err)
 	}
 
 	calendarIds := []string{
@@ -284,33 +628,41 @@ func getCallsArrangedFromCalendar(client *http.Client) ([]time.Time, error) {
 
 	eventIdTimeMap := make(map[string]time.Time)
 
-	t := time.Now().Format(time.RFC3339)
+	// include the last couple of weeks so we can count calls held as well as
+	// calls arranged
+	t := time.Now().Add(-14 * 24 * time.Hour).Format(time.RFC3339)
 
 	for _, calendarId := range calendarIds {
-		events, err := srv.Events.List(calendarId).ShowDeleted(false).
-			SingleEvents(true).TimeMin(t).MaxResults(50).OrderBy("startTime").Do()
+		numberOfEvents := 0
+
+		err := srv.Events.List(calendarId).ShowDeleted(false).
+			SingleEvents(true).TimeMin(t).MaxResults(250).OrderBy("startTime").
+			Pages(ctx, func(events *calendar.Events) error {
+				numberOfEvents += len(events.Items)
+
+				for _, event := range events.Items {
+					// https://developers.google.com/calendar/v3/reference/events
+
+					if eventLooksLikeCall(event) {
+						fmt.Printf("calendar event looks like a call: '%s' %s\n", event.Summary, event.Start.DateTime)
+						arrangedFor, err := time.Parse("2006-01-02T15:04:05Z07:00", event.Start.DateTime)
+						if err != nil {
+							return parseErrorf("failed to parse event.Start.Datetime '%s': %v", event.Start.DateTime, err)
+						}
+						eventIdTimeMap[event.Id] = arrangedFor
+					}
+				}
+				return nil
+			})
 
 		if err != nil {
-			return nil, fmt.Errorf("failed to get upcoming events for %s: %v", calendarId, err)
+			return nil, sourceErrorf("failed to get upcoming events for %s: %w", calendarId, err)
 		}
 
-		if len(events.Items) == 0 {
-			return nil, fmt.Errorf("no upcoming events for %s, seems unlikely", calendarId)
+		if numberOfEvents == 0 {
+			return nil, sourceErrorf("no upcoming events for %s, seems unlikely", calendarId)
 
 		}
-
-		for _, event := range events.Items {
-			// https://developers.google.com/calendar/v3/reference/events
-
-			if eventLooksLikeCall(event) {
-				fmt.Printf("calendar event looks like a call: '%s' %s\n", event.Summary, event.Start.DateTime)
-				arrangedFor, err := time.Parse("2006-01-02T15:04:05Z07:00", event.Start.DateTime)
-				if err != nil {
-					panic(fmt.Errorf("failed to parse event.Start.Datetime '%s': %v", event.Start.DateTime, err))
-				}
-				eventIdTimeMap[event.Id] = arrangedFor
-			}
-		}
 	}
 
 	arrangedForTimes := []time.Time{}
@@ -341,9 +693,15 @@ func eventLooksLikeCall(calendarEvent *calendar.Event) bool {
 type exitCode = int
 
 type jsonIndex struct {
-	CallsArrangedNext7Days     uint                  `json:"callsArrangedNext7Days"`
-	DaysSinceLastRelease       uint                  `json:"daysSinceLastRelease"`
-	MonthlyRecurringRevenueGBP uint                  `json:"monthlyRecurringRevenueGBP"`
-	ReleaseNotesSignups        []datastore.DateCount `json:"releaseNotesSignups"`
-	TrialsStarted              []datastore.DateCount `json:"trialsStarted"`
+	CallsArrangedNext7Days        uint                  `json:"callsArrangedNext7Days"`
+	CallsArrangedNext7DaysHistory []datastore.Snapshot  `json:"callsArrangedNext7DaysHistory"`
+	Comparison                    *jsonComparison       `json:"comparison,omitempty"`
+	DaysSinceLastRelease          *uint                 `json:"daysSinceLastRelease,omitempty"`
+	DaysSinceLastReleaseHistory   []datastore.Snapshot  `json:"daysSinceLastReleaseHistory"`
+	MonthlyRecurringRevenueGBP    uint                  `json:"monthlyRecurringRevenueGBP"`
+	ReleaseNotesSignups           []datastore.DateCount `json:"releaseNotesSignups"`
+	ReleaseNotesUnsubscribes      []datastore.DateCount `json:"releaseNotesUnsubscribes"`
+	ReleaseNotesNetGrowth         []datastore.DateCount `json:"releaseNotesNetGrowth"`
+	ReleaseNotesListSize          []datastore.DateCount `json:"releaseNotesListSize"`
+	TrialsStarted                 []datastore.DateCount `json:"trialsStarted"`
 }
@@ -12,14 +12,14 @@ type mockDB struct{}
 
 func (mdb *mockDB) AllTeams() ([]*models.Team, error) {
 	teams := make([]*models.Team, 0)
-	teams = append(teams, &models.Team{"1", "Imagine Corporation", "e44e4317-fea1-414a-a176-2462a26b6825"})
-	teams = append(teams, &models.Team{"2", "Flex Tech Inc.", "acbcd1a9-1b52-4014-9f5b-5bb6a809be3b"})
+	teams = append(teams, &models.Team{ID: "1", Name: "Imagine Corporation", UUID: "e44e4317-fea1-414a-a176-2462a26b6825"})
+	teams = append(teams, &models.Team{ID: "2", Name: "Flex Tech Inc.", UUID: "acbcd1a9-1b52-4014-9f5b-5bb6a809be3b"})
 	return teams, nil
 }
 
-func TestBooksIndex(t *testing.T) {
+func TestTeamsIndex(t *testing.T) {
 	rec := httptest.NewRecorder()
-	req, _ := http.NewRequest("GET", "/books", nil)
+	req, _ := http.NewRequest("GET", "/api/teams", nil)
 
 	env := Env{db: &mockDB{}}
 	http.HandlerFunc(env.teamsIndex).ServeHTTP(rec, req)
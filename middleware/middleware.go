@@ -0,0 +1,134 @@
+// Package middleware wraps HTTP handlers with panic recovery, access logging
+// and authentication.
+package middleware
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recover turns a panic in the handler into a 500 response and logs it,
+// rather than letting it kill the connection
+func Recover(next http.Handler, logger *Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				if recovered == http.ErrAbortHandler {
+					panic(recovered)
+				}
+
+				logger.Log(map[string]interface{}{
+					"level":  "error",
+					"msg":    "panic serving request",
+					"method": r.Method,
+					"path":   r.URL.Path,
+					"panic":  fmt.Sprint(recovered),
+					"stack":  string(debug.Stack()),
+				})
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			}
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// AccessLog logs one line per request with its method, path, status, size and
+// duration
+func AccessLog(next http.Handler, logger *Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		started := time.Now()
+		recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(recorder, r)
+
+		logger.Log(map[string]interface{}{
+			"level":       "info",
+			"msg":         "request",
+			"method":      r.Method,
+			"path":        r.URL.Path,
+			"query":       r.URL.RawQuery,
+			"status":      recorder.status,
+			"bytes":       recorder.bytes,
+			"duration_ms": float64(time.Since(started).Microseconds()) / 1000,
+			"remote_addr": r.RemoteAddr,
+			"user_agent":  r.UserAgent(),
+		})
+	})
+}
+
+// RequireToken only lets through requests with the given token, either as a
+// bearer token (for scripts) or as the password for HTTP basic auth (so a
+// browser can log in). If token is empty, every request is refused.
+func RequireToken(next http.Handler, token string, realm string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var given string
+		if _, password, ok := r.BasicAuth(); ok {
+			given = password
+		} else if header := r.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+			given = strings.TrimPrefix(header, "Bearer ")
+		}
+
+		if token == "" || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s", charset="UTF-8"`, realm))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Logger writes structured log lines as JSON, one object per line
+type Logger struct {
+	out   io.Writer
+	mutex sync.Mutex
+}
+
+// NewLogger returns a Logger that writes to out
+func NewLogger(out io.Writer) *Logger {
+	return &Logger{out: out}
+}
+
+// Log writes the given fields as a line of JSON, adding the current time
+func (l *Logger) Log(fields map[string]interface{}) {
+	fields["time"] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	line, err := json.Marshal(fields)
+	if err != nil {
+		line = []byte(fmt.Sprintf(`{"level": "error", "msg": "failed to encode log line: %v"}`, err))
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.out.Write(append(line, '\n'))
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status      int
+	bytes       int
+	wroteHeader bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wroteHeader {
+		r.status = status
+		r.wroteHeader = true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(data []byte) (int, error) {
+	r.wroteHeader = true
+	n, err := r.ResponseWriter.Write(data)
+	r.bytes += n
+	return n, err
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRecover(t *testing.T) {
+	var logged bytes.Buffer
+	handler := Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("oh no")
+	}), NewLogger(&logged))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/json", nil))
+
+	if recorder.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %d", recorder.Code)
+	}
+	if !strings.Contains(logged.String(), `"panic":"oh no"`) {
+		t.Errorf("expected panic to be logged, got: %s", logged.String())
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var logged bytes.Buffer
+	handler := AccessLog(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte("short and stout"))
+	}), NewLogger(&logged))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/json?compare=previous_year", nil))
+
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(logged.Bytes(), &line); err != nil {
+		t.Fatalf("expected a JSON log line, got %q: %v", logged.String(), err)
+	}
+
+	expected := map[string]interface{}{
+		"method": "GET",
+		"path":   "/json",
+		"query":  "compare=previous_year",
+		"status": float64(http.StatusTeapot),
+		"bytes":  float64(len("short and stout")),
+	}
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("expected %s=%v, got %v", key, value, line[key])
+		}
+	}
+}
+
+func TestRequireToken(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name     string
+		token    string
+		setAuth  func(r *http.Request)
+		expected int
+	}{
+		{"bearer token", "s3cret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer s3cret") }, 200},
+		{"basic auth password", "s3cret", func(r *http.Request) { r.SetBasicAuth("admin", "s3cret") }, 200},
+		{"wrong token", "s3cret", func(r *http.Request) { r.Header.Set("Authorization", "Bearer guess") }, 401},
+		{"no token", "s3cret", func(r *http.Request) {}, 401},
+		{"no token configured", "", func(r *http.Request) { r.Header.Set("Authorization", "Bearer ") }, 401},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "/api/metrics/interviews/events", nil)
+		test.setAuth(request)
+
+		recorder := httptest.NewRecorder()
+		RequireToken(ok, test.token, "admin").ServeHTTP(recorder, request)
+
+		if recorder.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, recorder.Code)
+		}
+		if recorder.Code == 401 && recorder.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("%s: expected WWW-Authenticate header", test.name)
+		}
+	}
+}
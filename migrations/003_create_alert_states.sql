@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS alert_states (
+  rule_name TEXT PRIMARY KEY,
+  state TEXT NOT NULL,
+  value DOUBLE PRECISION,
+  changed_at TIMESTAMP NOT NULL
+);
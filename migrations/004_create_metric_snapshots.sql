@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS metric_snapshots (
+  id BIGSERIAL PRIMARY KEY,
+  metric TEXT NOT NULL,
+  taken_on DATE NOT NULL,
+  taken_at TIMESTAMP NOT NULL,
+  value DOUBLE PRECISION NOT NULL,
+  UNIQUE (metric, taken_on)
+);
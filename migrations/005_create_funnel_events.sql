@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS funnel_events (
+  contact_hash TEXT NOT NULL,
+  stage TEXT NOT NULL,
+  occurred_at TIMESTAMP NOT NULL,
+  PRIMARY KEY (contact_hash, stage)
+);
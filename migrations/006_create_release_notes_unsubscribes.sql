@@ -0,0 +1,4 @@
+CREATE TABLE IF NOT EXISTS release_notes_unsubscribes (
+  id BIGSERIAL PRIMARY KEY,
+  unsubscribed_at TIMESTAMP
+);
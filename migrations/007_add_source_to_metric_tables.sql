@@ -0,0 +1,8 @@
+-- Rows are either written by a collector, which replaces all of its rows on
+-- each run, or imported by `dashboard import`, which are never replaced.
+
+ALTER TABLE release_notes_signups ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'collector';
+ALTER TABLE release_notes_unsubscribes ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'collector';
+ALTER TABLE trials_started ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'collector';
+ALTER TABLE calls_arranged ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'collector';
+ALTER TABLE release_announcements ADD COLUMN IF NOT EXISTS source TEXT NOT NULL DEFAULT 'collector';
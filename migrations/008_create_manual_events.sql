@@ -0,0 +1,10 @@
+CREATE TABLE IF NOT EXISTS manual_events (
+  id BIGSERIAL PRIMARY KEY,
+  metric TEXT NOT NULL,
+  occurred_at TIMESTAMP NOT NULL,
+  value NUMERIC(14, 2),
+  note TEXT NOT NULL DEFAULT '',
+  recorded_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS manual_events_metric_occurred_at ON manual_events (metric, occurred_at);
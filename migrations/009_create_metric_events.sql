@@ -0,0 +1,67 @@
+-- Every metric that's a list of things that happened (signups, calls,
+-- releases, events entered by hand...) is stored here, rather than in a
+-- table per metric.
+--
+-- value is NULL for events that just count as 1.
+-- source is 'collector', 'import' or 'manual'. Collectors only replace their
+-- own rows.
+-- source_id is the event's ID in its source, if it has one.
+
+CREATE TABLE IF NOT EXISTS metric_events (
+  id BIGSERIAL PRIMARY KEY,
+  metric TEXT NOT NULL,
+  occurred_at TIMESTAMP NOT NULL,
+  value NUMERIC(14, 2),
+  source TEXT NOT NULL DEFAULT 'collector',
+  source_id TEXT,
+  labels JSONB NOT NULL DEFAULT '{}',
+  note TEXT NOT NULL DEFAULT '',
+  recorded_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS metric_events_metric_occurred_at ON metric_events (metric, occurred_at);
+CREATE INDEX IF NOT EXISTS metric_events_labels ON metric_events USING GIN (labels);
+
+-- Move the rows from the old table-per-metric schema, then drop the old
+-- tables. Earlier migrations recreate them empty each time they're run, so
+-- this is safe to run again.
+
+DO $$
+BEGIN
+  IF to_regclass('release_notes_signups') IS NOT NULL THEN
+    INSERT INTO metric_events (metric, occurred_at, source)
+      SELECT 'signups', signed_up_at, source FROM release_notes_signups WHERE signed_up_at IS NOT NULL;
+    DROP TABLE release_notes_signups;
+  END IF;
+
+  IF to_regclass('release_notes_unsubscribes') IS NOT NULL THEN
+    INSERT INTO metric_events (metric, occurred_at, source)
+      SELECT 'unsubscribes', unsubscribed_at, source FROM release_notes_unsubscribes WHERE unsubscribed_at IS NOT NULL;
+    DROP TABLE release_notes_unsubscribes;
+  END IF;
+
+  IF to_regclass('trials_started') IS NOT NULL THEN
+    INSERT INTO metric_events (metric, occurred_at, source)
+      SELECT 'trials', started_at, source FROM trials_started WHERE started_at IS NOT NULL;
+    DROP TABLE trials_started;
+  END IF;
+
+  IF to_regclass('calls_arranged') IS NOT NULL THEN
+    INSERT INTO metric_events (metric, occurred_at, source)
+      SELECT 'calls', arranged_for, source FROM calls_arranged WHERE arranged_for IS NOT NULL;
+    DROP TABLE calls_arranged;
+  END IF;
+
+  IF to_regclass('release_announcements') IS NOT NULL THEN
+    INSERT INTO metric_events (metric, occurred_at, source)
+      SELECT 'releases', published_at, source FROM release_announcements WHERE published_at IS NOT NULL;
+    DROP TABLE release_announcements;
+  END IF;
+
+  IF to_regclass('manual_events') IS NOT NULL THEN
+    INSERT INTO metric_events (metric, occurred_at, value, source, note, recorded_at)
+      SELECT metric, occurred_at, value, 'manual', note, recorded_at FROM manual_events;
+    DROP TABLE manual_events;
+  END IF;
+END
+$$;
@@ -0,0 +1,11 @@
+-- Fluidkeys teams, as last seen by the teams collector. Teams that are
+-- deleted on the server are deleted here too.
+
+CREATE TABLE IF NOT EXISTS teams (
+  id BIGSERIAL PRIMARY KEY,
+  uuid UUID NOT NULL UNIQUE,
+  name TEXT NOT NULL,
+  member_count INTEGER NOT NULL,
+  created_at TIMESTAMP,
+  last_seen_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,11 @@
+-- The last response to each URL a collector fetched with an ETag, so the next
+-- run can make a conditional request and reuse the body if it's unchanged.
+-- link is the response's Link header, which says where the next page is.
+
+CREATE TABLE IF NOT EXISTS http_responses (
+  url TEXT PRIMARY KEY,
+  etag TEXT NOT NULL,
+  link TEXT NOT NULL DEFAULT '',
+  body BYTEA NOT NULL,
+  fetched_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,10 @@
+-- Each migration from here on records its number, so the dashboard can tell
+-- if the database hasn't been migrated (see datastore.LatestMigration).
+-- Migrations before this one don't, so an empty table means 11.
+
+CREATE TABLE IF NOT EXISTS schema_migrations (
+  version INTEGER PRIMARY KEY,
+  applied_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+INSERT INTO schema_migrations (version) VALUES (12) ON CONFLICT DO NOTHING;
@@ -0,0 +1,10 @@
+-- When each collector last ran without an error, and when it last did
+-- nothing because it isn't configured, which /readyz checks.
+
+CREATE TABLE IF NOT EXISTS collector_runs (
+  collector TEXT PRIMARY KEY,
+  succeeded_at TIMESTAMP,
+  skipped_at TIMESTAMP
+);
+
+INSERT INTO schema_migrations (version) VALUES (13) ON CONFLICT DO NOTHING;
@@ -0,0 +1,12 @@
+-- Snapshots can be of one part of a metric, e.g. the stars of one GitHub
+-- repository as well as the total, so they're unique by their labels too.
+-- Existing snapshots are totals, with no labels.
+
+ALTER TABLE metric_snapshots ADD COLUMN IF NOT EXISTS labels JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE metric_snapshots DROP CONSTRAINT IF EXISTS metric_snapshots_metric_taken_on_key;
+ALTER TABLE metric_snapshots DROP CONSTRAINT IF EXISTS metric_snapshots_metric_taken_on_labels_key;
+ALTER TABLE metric_snapshots ADD CONSTRAINT metric_snapshots_metric_taken_on_labels_key
+  UNIQUE (metric, taken_on, labels);
+
+INSERT INTO schema_migrations (version) VALUES (14) ON CONFLICT DO NOTHING;
@@ -0,0 +1,15 @@
+// Package models are the things the dashboard serves that aren't metrics,
+// such as Fluidkeys teams.
+package models
+
+// Team is a Fluidkeys team
+type Team struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	UUID string `json:"uuid"`
+}
+
+// Datastore is where models are read from
+type Datastore interface {
+	AllTeams() ([]*Team, error)
+}
@@ -0,0 +1,85 @@
+// Package rag works out the red/amber/green status of the dashboard's headline
+// numbers, so the web page, the alerts and the digest all agree.
+package rag
+
+// Status is red, amber or green
+type Status string
+
+const (
+	// Red means something needs doing now
+	Red Status = "red"
+
+	// Amber means keep an eye on it
+	Amber Status = "amber"
+
+	// Green means all is well
+	Green Status = "green"
+)
+
+// ReleaseIntervalDays is our target: release every 6 weeks
+const ReleaseIntervalDays = 42
+
+// ReleaseGraceDays is how long a release can be overdue before it's red
+const ReleaseGraceDays = 7
+
+// CallsArrangedRed and CallsArrangedAmber are the number of calls arranged in
+// the next 7 days that we need to be amber and green respectively
+const (
+	CallsArrangedRed   = 3
+	CallsArrangedAmber = 4
+)
+
+// MonthlyRecurringRevenueRedGBP and MonthlyRecurringRevenueAmberGBP are the
+// monthly recurring revenue we need to be amber and green respectively
+const (
+	MonthlyRecurringRevenueRedGBP   = 1000
+	MonthlyRecurringRevenueAmberGBP = 2000
+)
+
+// CallsArranged returns the status for the number of calls arranged in the
+// next 7 days
+func CallsArranged(calls uint) Status {
+	switch {
+	case calls < CallsArrangedRed:
+		return Red
+	case calls < CallsArrangedAmber:
+		return Amber
+	default:
+		return Green
+	}
+}
+
+// DaysUntilNextReleaseDue returns how many days we have until the next release
+// is due. It's negative if the release is overdue.
+func DaysUntilNextReleaseDue(daysSinceLastRelease uint) int {
+	return ReleaseIntervalDays - int(daysSinceLastRelease)
+}
+
+// ReleaseDue returns the status for the number of days since the last release:
+// amber if the next release is overdue, red if it's more than ReleaseGraceDays
+// overdue
+func ReleaseDue(daysSinceLastRelease uint) Status {
+	daysUntilDue := DaysUntilNextReleaseDue(daysSinceLastRelease)
+
+	switch {
+	case daysUntilDue < -ReleaseGraceDays:
+		return Red
+	case daysUntilDue < 0:
+		return Amber
+	default:
+		return Green
+	}
+}
+
+// MonthlyRecurringRevenue returns the status for the monthly recurring revenue
+// in GBP
+func MonthlyRecurringRevenue(gbp uint) Status {
+	switch {
+	case gbp < MonthlyRecurringRevenueRedGBP:
+		return Red
+	case gbp < MonthlyRecurringRevenueAmberGBP:
+		return Amber
+	default:
+		return Green
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// defaultManualMetrics are the metrics entered by hand if MANUAL_METRICS isn't
+// set
+var defaultManualMetrics = []string{"interviews", "talks", "pressMentions"}
+
+// getManualMetricNames returns the (comma separated) metrics in MANUAL_METRICS,
+// which have no machine source so are entered by hand
+func getManualMetricNames() []string {
+	if _, got := os.LookupEnv("MANUAL_METRICS"); !got {
+		return defaultManualMetrics
+	}
+	return splitEnvList("MANUAL_METRICS")
+}
+
+// maxNoteLength stops the notes being used to store anything too big
+const maxNoteLength = 1000
+
+// manualEventRequest is the body of POST /api/metrics/{name}/events
+type manualEventRequest struct {
+	// OccurredAt is a date (YYYY-MM-DD) or RFC3339 time. It defaults to now.
+	OccurredAt string   `json:"occurredAt"`
+	Value      *float64 `json:"value"`
+	Note       string   `json:"note"`
+}
+
+func (m manualEventRequest) event(metric string, now time.Time) (datastore.ManualEvent, error) {
+	event := datastore.ManualEvent{Metric: metric, OccurredAt: now, Value: m.Value, Note: strings.TrimSpace(m.Note)}
+
+	if m.OccurredAt != "" {
+		var err error
+		if event.OccurredAt, err = time.Parse(time.RFC3339, m.OccurredAt); err != nil {
+			if event.OccurredAt, err = time.Parse("2006-01-02", m.OccurredAt); err != nil {
+				return event, fmt.Errorf("invalid occurredAt '%s', expected YYYY-MM-DD or an RFC3339 time",
+					m.OccurredAt)
+			}
+		}
+	}
+
+	if event.Value != nil && (math.IsNaN(*event.Value) || math.IsInf(*event.Value, 0)) {
+		return event, fmt.Errorf("invalid value, expected a number")
+	}
+	if len(event.Note) > maxNoteLength {
+		return event, fmt.Errorf("note is too long, the maximum is %d characters", maxNoteLength)
+	}
+	return event, nil
+}
+
+// handleMetricEvents serves /api/metrics/{name}/events for the metrics entered
+// by hand. POST records an event, GET lists the most recent events.
+//
+// POST must be JSON, which a form on another site can't send without asking
+// first, and mustn't come from another origin, since the browser sends basic
+// auth credentials with it.
+func handleMetricEvents(w http.ResponseWriter, r *http.Request) {
+	metric := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/metrics/"), "/events")
+	if !strings.HasSuffix(r.URL.Path, "/events") || !datastore.IsManualMetric(metric) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case "GET":
+		events, err := datastore.RecentManualEvents(metric, 100)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("content-type", "application/json")
+		writeJSON(w, events)
+
+	case "POST":
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+			http.Error(w, "expected Content-Type: application/json", http.StatusUnsupportedMediaType)
+			return
+		}
+		if r.Header.Get("Origin") != "" && !isSameOrigin(r) {
+			http.Error(w, "cross-origin requests aren't allowed", http.StatusForbidden)
+			return
+		}
+
+		request := manualEventRequest{}
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 64*1024)).Decode(&request); err != nil {
+			http.Error(w, fmt.Sprintf("invalid JSON: %v", err), http.StatusBadRequest)
+			return
+		}
+
+		event, err := request.event(metric, time.Now())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		recorded, err := datastore.RecordManualEvent(event)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("content-type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		writeJSON(w, recorded)
+
+	default:
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// adminPage is the data for the admin form
+type adminPage struct {
+	Metrics []adminMetric
+	Today   string
+	Saved   string
+	Error   string
+}
+
+type adminMetric struct {
+	Name   string
+	Recent []datastore.ManualEvent
+}
+
+// handleAdmin serves /admin, a form for recording events of the metrics that
+// are entered by hand
+func handleAdmin(assets *staticAssets) http.HandlerFunc {
+	adminTemplate := template.Must(template.New("admin.html").Funcs(template.FuncMap{
+		"asset": assets.Path,
+	}).ParseFS(embeddedTemplates, "templates/admin.html"))
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		page := adminPage{Today: time.Now().Format("2006-01-02")}
+
+		switch r.Method {
+		case "GET":
+			page.Saved = r.URL.Query().Get("saved")
+
+		case "POST":
+			// the browser sends basic auth credentials with any request, so
+			// check the form was submitted from this site
+			if !isSameOrigin(r) {
+				http.Error(w, "form must be submitted from the admin page", http.StatusForbidden)
+				return
+			}
+
+			metric, err := recordManualEventFromForm(r)
+			if err == nil {
+				http.Redirect(w, r, "/admin?saved="+url.QueryEscape(metric), http.StatusSeeOther)
+				return
+			}
+			w.WriteHeader(http.StatusBadRequest)
+			page.Error = err.Error()
+
+		default:
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		for _, name := range getManualMetricNames() {
+			recent, err := datastore.RecentManualEvents(name, 5)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			page.Metrics = append(page.Metrics, adminMetric{Name: name, Recent: recent})
+		}
+
+		var out bytes.Buffer
+		if err := adminTemplate.Execute(&out, page); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("content-type", "text/html; charset=utf-8")
+		w.Write(out.Bytes())
+	}
+}
+
+// recordManualEventFromForm records the event submitted with the admin form,
+// returning its metric
+func recordManualEventFromForm(r *http.Request) (string, error) {
+	metric := r.PostFormValue("metric")
+	if !datastore.IsManualMetric(metric) {
+		return metric, fmt.Errorf("unknown metric '%s'", metric)
+	}
+
+	request := manualEventRequest{
+		OccurredAt: r.PostFormValue("occurredAt"),
+		Note:       r.PostFormValue("note"),
+	}
+
+	if valueString := strings.TrimSpace(r.PostFormValue("value")); valueString != "" {
+		value, err := strconv.ParseFloat(valueString, 64)
+		if err != nil {
+			return metric, fmt.Errorf("invalid value '%s', expected a number", valueString)
+		}
+		request.Value = &value
+	}
+
+	event, err := request.event(metric, time.Now())
+	if err != nil {
+		return metric, err
+	}
+
+	_, err = datastore.RecordManualEvent(event)
+	return metric, err
+}
+
+// isSameOrigin returns true if the request's Origin (or failing that, its
+// Referer) is this site
+func isSameOrigin(r *http.Request) bool {
+	source := r.Header.Get("Origin")
+	if source == "" {
+		source = r.Header.Get("Referer")
+	}
+
+	sourceURL, err := url.Parse(source)
+	return err == nil && sourceURL.Host != "" && sourceURL.Host == r.Host
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+func TestManualEventRequest(t *testing.T) {
+	now := time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)
+	three := 3.0
+
+	event, err := manualEventRequest{OccurredAt: "2019-03-28", Value: &three, Note: " at FOSDEM "}.event("talks", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !event.OccurredAt.Equal(time.Date(2019, 3, 28, 0, 0, 0, 0, time.UTC)) || *event.Value != 3 ||
+		event.Note != "at FOSDEM" || event.Metric != "talks" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	event, err = manualEventRequest{}.event("talks", now)
+	if err != nil || !event.OccurredAt.Equal(now) || event.Value != nil {
+		t.Errorf("expected an event now with no value, got %+v, %v", event, err)
+	}
+
+	for name, invalid := range map[string]manualEventRequest{
+		"bad date":  {OccurredAt: "28/03/2019"},
+		"long note": {Note: strings.Repeat("x", maxNoteLength+1)},
+	} {
+		if _, err := invalid.event("talks", now); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestIsSameOrigin(t *testing.T) {
+	tests := []struct {
+		header   string
+		value    string
+		expected bool
+	}{
+		{"Origin", "https://dashboard.fluidkeys.com", true},
+		{"Referer", "https://dashboard.fluidkeys.com/admin", true},
+		{"Origin", "https://evil.example.com", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		request := httptest.NewRequest("POST", "https://dashboard.fluidkeys.com/admin", nil)
+		if test.header != "" {
+			request.Header.Set(test.header, test.value)
+		}
+		if got := isSameOrigin(request); got != test.expected {
+			t.Errorf("%s: %s: expected %v, got %v", test.header, test.value, test.expected, got)
+		}
+	}
+}
+
+func TestPostMetricEvent(t *testing.T) {
+	initializeTestDatabase(t)
+	if err := datastore.SetManualMetrics([]string{"talks"}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { datastore.SetManualMetrics(nil) })
+
+	tests := []struct {
+		name        string
+		contentType string
+		origin      string
+		expected    int
+	}{
+		{"JSON from a script", "application/json", "", http.StatusCreated},
+		{"JSON from this site", "application/json; charset=utf-8", "https://dashboard.fluidkeys.com", http.StatusCreated},
+		{"JSON from another site", "application/json", "https://evil.example.com", http.StatusForbidden},
+		{"form from another site", "text/plain", "https://evil.example.com", http.StatusUnsupportedMediaType},
+		{"no content type", "", "", http.StatusUnsupportedMediaType},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			request := httptest.NewRequest("POST", "https://dashboard.fluidkeys.com/api/metrics/talks/events",
+				strings.NewReader(`{"occurredAt": "2019-04-01", "note": "FOSDEM"}`))
+			if test.contentType != "" {
+				request.Header.Set("Content-Type", test.contentType)
+			}
+			if test.origin != "" {
+				request.Header.Set("Origin", test.origin)
+			}
+
+			response := httptest.NewRecorder()
+			handleMetricEvents(response, request)
+
+			if response.Code != test.expected {
+				t.Errorf("expected %d, got %d: %s", test.expected, response.Code, response.Body)
+			}
+		})
+	}
+}
+
+func TestAdminTemplate(t *testing.T) {
+	assets, err := newStaticAssets()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	adminTemplate := template.Must(template.New("admin.html").Funcs(template.FuncMap{
+		"asset": assets.Path,
+	}).ParseFS(embeddedTemplates, "templates/admin.html"))
+
+	value := 2.5
+	page := adminPage{
+		Today: "2019-04-01",
+		Saved: "talks",
+		Metrics: []adminMetric{
+			{Name: "interviews"},
+			{Name: "talks", Recent: []datastore.ManualEvent{
+				{Metric: "talks", OccurredAt: time.Date(2019, 3, 28, 0, 0, 0, 0, time.UTC), Value: &value, Note: "FOSDEM"},
+			}},
+		},
+	}
+
+	var out bytes.Buffer
+	if err := adminTemplate.Execute(&out, page); err != nil {
+		t.Fatalf("failed to render: %v", err)
+	}
+
+	for _, expected := range []string{
+		`<option value="talks" selected>talks</option>`,
+		"<td>2019-03-28</td>",
+		"<td>2.5</td>",
+		"<td>FOSDEM</td>",
+		"No events yet.",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("expected page to contain %q", expected)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+// Package retry provides an http.RoundTripper that retries requests which
+// fail for transient reasons: network errors, 5xx responses and rate limits.
+package retry
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Policy says how many times to try a request and how long to wait between
+// attempts
+type Policy struct {
+	// MaxAttempts is the most times a request is tried, including the first
+	MaxAttempts int
+
+	// BaseDelay is the backoff before the second attempt. It doubles for each
+	// attempt after that, up to MaxDelay, and a random jitter is applied.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+}
+
+// DefaultPolicy tries 4 times, waiting up to about 0.5s, 1s then 2s
+var DefaultPolicy = Policy{
+	MaxAttempts: 4,
+	BaseDelay:   500 * time.Millisecond,
+	MaxDelay:    30 * time.Second,
+}
+
+// Backoff returns how long to wait before the given attempt (2 for the first
+// retry): a random duration up to BaseDelay * 2^(attempt-2), capped at
+// MaxDelay ("full jitter")
+func (p Policy) Backoff(attempt int, random *rand.Rand) time.Duration {
+	ceiling := p.BaseDelay
+	for i := 2; i < attempt && ceiling < p.MaxDelay; i++ {
+		ceiling *= 2
+	}
+	if ceiling > p.MaxDelay {
+		ceiling = p.MaxDelay
+	}
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(random.Int63n(int64(ceiling) + 1))
+}
+
+// Transport retries requests according to its Policy, honouring the request's
+// context and any Retry-After header in the response
+type Transport struct {
+	Base   http.RoundTripper
+	Policy Policy
+
+	// OnRetry, if set, is called before waiting to retry a request
+	OnRetry func(request *http.Request, attempt int, wait time.Duration, reason string)
+
+	requests int64
+	attempts int64
+
+	randomMutex sync.Mutex
+	random      *rand.Rand
+}
+
+// NewTransport returns a Transport that sends requests through base
+func NewTransport(base http.RoundTripper, policy Policy) *Transport {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &Transport{
+		Base:   base,
+		Policy: policy,
+		random: rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Stats counts the requests made through a Transport
+type Stats struct {
+	Requests int64
+	Attempts int64
+}
+
+// Retries returns the number of attempts that were retries
+func (s Stats) Retries() int64 {
+	return s.Attempts - s.Requests
+}
+
+// Sub returns the difference between two Stats, e.g. to count the requests
+// made by one collector
+func (s Stats) Sub(earlier Stats) Stats {
+	return Stats{Requests: s.Requests - earlier.Requests, Attempts: s.Attempts - earlier.Attempts}
+}
+
+// Stats returns the number of requests and attempts made so far
+func (t *Transport) Stats() Stats {
+	return Stats{
+		Requests: atomic.LoadInt64(&t.requests),
+		Attempts: atomic.LoadInt64(&t.attempts),
+	}
+}
+
+// RoundTrip sends the request, retrying it if it fails for a transient reason.
+// Each retry sends a copy of the request with a fresh body, leaving the
+// caller's request as it was.
+func (t *Transport) RoundTrip(request *http.Request) (*http.Response, error) {
+	atomic.AddInt64(&t.requests, 1)
+
+	canReplay := request.Body == nil || request.Body == http.NoBody || request.GetBody != nil
+
+	for attempt := 1; ; attempt++ {
+		atomic.AddInt64(&t.attempts, 1)
+
+		attemptRequest := request
+		if attempt > 1 {
+			attemptRequest = request.Clone(request.Context())
+			if request.GetBody != nil {
+				body, err := request.GetBody()
+				if err != nil {
+					return nil, err
+				}
+				attemptRequest.Body = body
+			}
+		}
+
+		response, err := t.Base.RoundTrip(attemptRequest)
+
+		reason, retryAfter, response := retryReason(request.Context(), response, err)
+		if reason == "" || attempt >= t.Policy.MaxAttempts || !canReplay {
+			return response, err
+		}
+
+		wait := t.backoff(attempt + 1)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+
+		if deadline, ok := request.Context().Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			// no point waiting if we'll run out of time anyway
+			return response, err
+		}
+
+		if t.OnRetry != nil {
+			t.OnRetry(request, attempt+1, wait, reason)
+		}
+
+		if response != nil {
+			response.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-request.Context().Done():
+			timer.Stop()
+			return nil, request.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+func (t *Transport) backoff(attempt int) time.Duration {
+	t.randomMutex.Lock()
+	defer t.randomMutex.Unlock()
+
+	if t.random == nil {
+		t.random = rand.New(rand.NewSource(time.Now().UnixNano()))
+	}
+	return t.Policy.Backoff(attempt, t.random)
+}
+
+// retryReason returns a description of why the request should be retried, or
+// an empty string if it shouldn't, plus how long the server asked us to wait.
+// It may have to read the response body, so it returns a replacement response.
+func retryReason(ctx context.Context, response *http.Response, err error) (string, time.Duration, *http.Response) {
+	if err != nil {
+		if ctx.Err() != nil {
+			return "", 0, response // cancelled or timed out: don't retry
+		}
+		return err.Error(), 0, response
+	}
+
+	retryAfter := parseRetryAfter(response.Header.Get("Retry-After"), time.Now())
+
+	switch response.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return response.Status, retryAfter, response
+
+	case http.StatusForbidden:
+		// Google APIs return 403 with a reason of rateLimitExceeded or
+		// userRateLimitExceeded when we're being rate limited
+		body, readErr := ioutil.ReadAll(response.Body)
+		response.Body.Close()
+		response.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		if readErr == nil && strings.Contains(strings.ToLower(string(body)), "ratelimitexceeded") {
+			return response.Status + " (rate limit exceeded)", retryAfter, response
+		}
+	}
+	return "", 0, response
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number of
+// seconds or an HTTP date
+func parseRetryAfter(header string, now time.Time) time.Duration {
+	if header == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(strings.TrimSpace(header)); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(header); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+	return 0
+}
+
+// String formats the stats for the run log, e.g. "3 requests, 1 retry"
+func (s Stats) String() string {
+	return fmt.Sprintf("%d %s, %d %s",
+		s.Requests, plural(s.Requests, "request", "requests"),
+		s.Retries(), plural(s.Retries(), "retry", "retries"))
+}
+
+func plural(n int64, singular string, pluralForm string) string {
+	if n == 1 {
+		return singular
+	}
+	return pluralForm
+}
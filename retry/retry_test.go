@@ -0,0 +1,181 @@
+package retry
+
+import (
+	"context"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var fastPolicy = Policy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 5 * time.Millisecond}
+
+func TestTransportRetries(t *testing.T) {
+	tests := []struct {
+		name             string
+		responses        []int
+		body             string
+		expectedStatus   int
+		expectedAttempts int64
+	}{
+		{"success first time", []int{200}, "", 200, 1},
+		{"retries 503 then succeeds", []int{503, 503, 200}, "", 200, 3},
+		{"gives up after max attempts", []int{500, 500, 500, 200}, "", 500, 3},
+		{"retries 429", []int{429, 200}, "", 200, 2},
+		{"retries google rate limit", []int{403, 200},
+			`{"error": {"errors": [{"reason": "rateLimitExceeded"}]}}`, 200, 2},
+		{"doesn't retry other 403", []int{403, 200}, `{"error": "forbidden"}`, 403, 1},
+		{"doesn't retry 404", []int{404, 200}, "", 404, 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := test.responses[calls]
+				calls++
+				w.WriteHeader(status)
+				if status != 200 {
+					w.Write([]byte(test.body))
+				}
+			}))
+			defer server.Close()
+
+			transport := NewTransport(nil, fastPolicy)
+			client := &http.Client{Transport: transport}
+
+			response, err := client.Get(server.URL)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			response.Body.Close()
+
+			if response.StatusCode != test.expectedStatus {
+				t.Errorf("expected status %d, got %d", test.expectedStatus, response.StatusCode)
+			}
+			if stats := transport.Stats(); stats.Requests != 1 || stats.Attempts != test.expectedAttempts {
+				t.Errorf("expected 1 request, %d attempts, got %+v", test.expectedAttempts, stats)
+			}
+		})
+	}
+}
+
+func TestTransportRetriesWithoutChangingTheRequest(t *testing.T) {
+	received := []string{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, string(body))
+		if len(received) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	request, err := http.NewRequest("POST", server.URL, strings.NewReader(`{"text": "hello"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := request.Body
+
+	response, err := NewTransport(nil, fastPolicy).RoundTrip(request)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response.Body.Close()
+
+	if len(received) != 2 || received[0] != `{"text": "hello"}` || received[1] != received[0] {
+		t.Errorf("expected the body to be sent twice, got %q", received)
+	}
+	if request.Body != body {
+		t.Errorf("expected the caller's request to keep its body")
+	}
+}
+
+func TestTransportHonoursRetryAfter(t *testing.T) {
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+
+	var waited time.Duration
+	transport := NewTransport(nil, fastPolicy)
+	transport.OnRetry = func(_ *http.Request, attempt int, wait time.Duration, reason string) {
+		waited = wait
+	}
+
+	started := time.Now()
+	response, err := (&http.Client{Transport: transport}).Get(server.URL)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response.Body.Close()
+
+	if waited != time.Second || time.Since(started) < time.Second {
+		t.Errorf("expected to wait 1 second, waited %v", waited)
+	}
+}
+
+func TestTransportGivesUpAtDeadline(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "60")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	request, _ := http.NewRequest("GET", server.URL, nil)
+	response, err := (&http.Client{Transport: NewTransport(nil, fastPolicy)}).Do(request.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the 503 to be returned rather than waiting past the deadline, got %d",
+			response.StatusCode)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{BaseDelay: 100 * time.Millisecond, MaxDelay: 300 * time.Millisecond}
+	random := rand.New(rand.NewSource(1))
+
+	for attempt, ceiling := range map[int]time.Duration{
+		2: 100 * time.Millisecond,
+		3: 200 * time.Millisecond,
+		4: 300 * time.Millisecond,
+		9: 300 * time.Millisecond,
+	} {
+		for i := 0; i < 100; i++ {
+			if wait := policy.Backoff(attempt, random); wait < 0 || wait > ceiling {
+				t.Fatalf("attempt %d: expected backoff up to %v, got %v", attempt, ceiling, wait)
+			}
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2019, 4, 1, 9, 0, 0, 0, time.UTC)
+
+	for header, expected := range map[string]time.Duration{
+		"":                              0,
+		"120":                           2 * time.Minute,
+		"nonsense":                      0,
+		"Mon, 01 Apr 2019 09:00:30 GMT": 30 * time.Second,
+		"Mon, 01 Apr 2019 08:00:00 GMT": 0,
+	} {
+		if got := parseRetryAfter(header, now); got != expected {
+			t.Errorf("parseRetryAfter(%q): expected %v, got %v", header, expected, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fluidkeys/dashboard/cache"
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/middleware"
+)
+
+// shutdownTimeout is how long we wait for in-flight requests and collector
+// runs to finish. Heroku sends SIGKILL 30 seconds after SIGTERM.
+const shutdownTimeout = 25 * time.Second
+
+func runWebserver() exitCode {
+	assets, err := newStaticAssets()
+	if err != nil {
+		log.Fatal("failed to load static assets: ", err)
+	}
+
+	configuredDashboards, err := loadDashboards()
+	if err != nil {
+		log.Fatal("failed to load dashboards: ", err)
+	}
+	dashboardsHandler := handleDashboards(configuredDashboards, assets)
+
+	metricsCacheTTL := 5 * time.Minute
+	if ttl, got := os.LookupEnv("METRICS_CACHE_TTL"); got {
+		metricsCacheTTL, err = time.ParseDuration(ttl)
+		if err != nil {
+			log.Fatal("invalid METRICS_CACHE_TTL, expected e.g. '5m': ", err)
+		}
+	}
+	metricsCache := cache.New(metricsCacheTTL)
+	datastore.OnChange(metricsCache.Invalidate)
+
+	collectMaxAge := defaultCollectMaxAge
+	if maxAge, got := os.LookupEnv("COLLECT_MAX_AGE"); got {
+		collectMaxAge, err = time.ParseDuration(maxAge)
+		if err != nil || collectMaxAge <= 0 {
+			log.Fatal("invalid COLLECT_MAX_AGE, expected e.g. '25h': ", maxAge)
+		}
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", handleHealthz)
+	mux.HandleFunc("/readyz", handleReadyz(databaseReadiness{}, collectMaxAge))
+	mux.HandleFunc("/json", handleJSONIndex(metricsCache))
+	mux.HandleFunc("/api/export/", handleExport)
+	mux.HandleFunc("/api/snapshots/", handleSnapshots)
+	mux.HandleFunc("/api/funnel", handleFunnel)
+	mux.HandleFunc("/api/releases/downloads", handleReleaseDownloads)
+	mux.HandleFunc("/api/dashboards/", dashboardsHandler)
+	mux.HandleFunc("/d/", dashboardsHandler)
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	mux.Handle("/api/metrics/", middleware.RequireToken(http.HandlerFunc(handleMetricEvents), adminToken, "dashboard"))
+	mux.Handle("/admin", middleware.RequireToken(handleAdmin(assets), adminToken, "dashboard"))
+	env := &Env{db: databaseModels{}}
+	mux.Handle("/api/teams", middleware.RequireToken(http.HandlerFunc(env.teamsIndex), adminToken, "dashboard"))
+	mux.Handle("/", handleIndex(assets))
+
+	logger := middleware.NewLogger(os.Stdout)
+
+	server := &http.Server{
+		Addr:              Port(),
+		Handler:           middleware.AccessLog(middleware.Recover(mux, logger), logger),
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       120 * time.Second,
+	}
+
+	schedule, err := startCollectorSchedule()
+	if err != nil {
+		log.Fatal("failed to start collectors: ", err)
+	}
+
+	serverErrors := make(chan error, 1)
+	go func() {
+		serverErrors <- server.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+
+	select {
+	case err := <-serverErrors:
+		log.Fatal("ListenAndServe: ", err)
+
+	case received := <-signals:
+		fmt.Printf("INFO: received %s, shutting down\n", received)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var code exitCode
+	if err := server.Shutdown(ctx); err != nil {
+		fmt.Printf("ERROR: failed to shut down webserver cleanly: %v\n", err)
+		code = 1
+	}
+
+	if err := schedule.stop(ctx); err != nil {
+		fmt.Printf("ERROR: failed to wait for collectors: %v\n", err)
+		code = 1
+	}
+
+	return code
+}
+
+// collectorSchedule runs the collectors inside the webserver process every
+// COLLECT_INTERVAL (e.g. "1h"), so a dashboard can keep itself up to date
+// without a separate scheduler
+type collectorSchedule struct {
+	// ctx is cancelled to stop scheduling runs and cancel the one in progress
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func startCollectorSchedule() (*collectorSchedule, error) {
+	schedule := &collectorSchedule{}
+	schedule.ctx, schedule.cancel = context.WithCancel(context.Background())
+
+	intervalString, got := os.LookupEnv("COLLECT_INTERVAL")
+	if !got {
+		return schedule, nil
+	}
+
+	interval, err := time.ParseDuration(intervalString)
+	if err != nil || interval <= 0 {
+		schedule.cancel()
+		return nil, fmt.Errorf("invalid COLLECT_INTERVAL '%s', expected e.g. '1h'", intervalString)
+	}
+
+	schedule.running.Add(1)
+	go func() {
+		defer schedule.running.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-schedule.ctx.Done():
+				return
+			case <-ticker.C:
+				fmt.Print("INFO: running scheduled collectors\n")
+				for _, err := range collect(schedule.ctx) {
+					fmt.Printf("ERROR: collector: %v\n", err)
+				}
+			}
+		}
+	}()
+
+	return schedule, nil
+}
+
+// stop stops scheduling collector runs and cancels any run in progress, then
+// waits for it to finish, or for ctx to be done
+func (s *collectorSchedule) stop(ctx context.Context) error {
+	s.cancel()
+
+	finished := make(chan struct{})
+	go func() {
+		s.running.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// blockingCollectors replaces the collectors with one that runs until it's
+// cancelled, closing started when it starts, and another that counts its runs
+func blockingCollectors(t *testing.T, started chan struct{}, cancelled *int32, after *int32) {
+	previous := collectors
+	t.Cleanup(func() { collectors = previous })
+
+	var once int32
+	collectors = []collector{
+		{"blocking", func(ctx context.Context, clients apiClients, store collectorStore) error {
+			if atomic.CompareAndSwapInt32(&once, 0, 1) {
+				close(started)
+			}
+			<-ctx.Done()
+			atomic.AddInt32(cancelled, 1)
+			return ctx.Err()
+		}},
+		{"after", func(ctx context.Context, clients apiClients, store collectorStore) error {
+			atomic.AddInt32(after, 1)
+			return nil
+		}},
+	}
+}
+
+func waitFor(t *testing.T, started chan struct{}) {
+	t.Helper()
+
+	select {
+	case <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for the collector to start")
+	}
+}
+
+func TestCollectorScheduleStop(t *testing.T) {
+	initializeTestDatabase(t)
+	setEnv(t, "COLLECT_INTERVAL", "10ms")
+
+	started := make(chan struct{})
+	var cancelled, after int32
+	blockingCollectors(t, started, &cancelled, &after)
+
+	schedule, err := startCollectorSchedule()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, started)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// the run in progress is cancelled rather than waited for
+	if err := schedule.stop(ctx); err != nil {
+		t.Fatalf("expected the schedule to stop, got %v", err)
+	}
+	if cancelled, after := atomic.LoadInt32(&cancelled), atomic.LoadInt32(&after); cancelled != 1 || after != 0 {
+		t.Errorf("expected the running collector to be cancelled and the rest skipped, got %d cancelled, %d after",
+			cancelled, after)
+	}
+}
+
+func TestInvalidCollectInterval(t *testing.T) {
+	setEnv(t, "COLLECT_INTERVAL", "hourly")
+
+	if _, err := startCollectorSchedule(); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestRunCollectorsStopsOnSIGTERM(t *testing.T) {
+	initializeTestDatabase(t)
+
+	started := make(chan struct{})
+	var cancelled, after int32
+	blockingCollectors(t, started, &cancelled, &after)
+
+	go func() {
+		select {
+		case <-started:
+			process, _ := os.FindProcess(os.Getpid())
+			process.Signal(syscall.SIGTERM)
+		case <-time.After(5 * time.Second):
+		}
+	}()
+
+	if code := runCollectors(nil); code == exitOK {
+		t.Errorf("expected a non-zero exit code")
+	}
+	if cancelled, after := atomic.LoadInt32(&cancelled), atomic.LoadInt32(&after); cancelled != 1 || after != 0 {
+		t.Errorf("expected the running collector to be cancelled and the rest skipped, got %d cancelled, %d after",
+			cancelled, after)
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// snapshotMetrics are the scalar metrics that are computed live, so we record
+// them once a day to be able to show how they've changed
+var snapshotMetrics = []string{
+	"callsArrangedNext7Days",
+	"daysSinceLastRelease",
+}
+
+// collectedSnapshotMetrics are recorded by collectors instead, e.g. the size
+// of the mailing list as reported by the provider
+var collectedSnapshotMetrics = []string{
+	listSizeSnapshotMetric,
+	activeTeamsSnapshotMetric,
+	teamMembersSnapshotMetric,
+	githubStarsSnapshotMetric,
+	githubOpenIssuesSnapshotMetric,
+	githubOpenPullsSnapshotMetric,
+	githubContributorsSnapshotMetric,
+}
+
+// snapshotHistoryDays is how much history the dashboard shows for each
+// snapshot metric
+const snapshotHistoryDays = 30
+
+// runSnapshot records today's value of each of the snapshotMetrics. It's meant
+// to be run once a day from a scheduler; running it again the same day
+// replaces that day's snapshot.
+func runSnapshot() exitCode {
+	return takeSnapshots(databaseStore{}, time.Now())
+}
+
+// takeSnapshots records the value of each of the snapshotMetrics at `now` in
+// the store. A metric that can't be got or recorded doesn't stop the others:
+// it's reported and the exit code is non-zero.
+func takeSnapshots(store collectorStore, now time.Time) exitCode {
+	var code exitCode
+
+	for _, metric := range snapshotMetrics {
+		value, err := getMetricValue(metric, now)
+		if err == errNoReleases {
+			fmt.Printf("Skipping snapshot of %s: %v\n", metric, err)
+			continue
+		} else if err != nil {
+			fmt.Printf("Failed to get %s to snapshot: %v\n", metric, err)
+			code = 1
+			continue
+		}
+
+		fmt.Printf("Snapshot %s: %v\n", metric, value)
+
+		if err := store.SetMetricSnapshot(metric, value, now); err != nil {
+			fmt.Printf("Failed to record snapshot of %s: %v\n", metric, err)
+			code = 1
+		}
+	}
+
+	fmt.Print("Done.\n")
+	return code
+}
+
+// handleSnapshots serves /api/snapshots/{metric} with an optional `days`
+// query parameter (default 30)
+func handleSnapshots(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	metric := strings.TrimPrefix(r.URL.Path, "/api/snapshots/")
+	if !isSnapshotMetric(metric) {
+		http.NotFound(w, r)
+		return
+	}
+
+	days := snapshotHistoryDays
+	if daysParam := r.URL.Query().Get("days"); daysParam != "" {
+		var err error
+		days, err = strconv.Atoi(daysParam)
+		if err != nil || days < 1 {
+			http.Error(w, "invalid days, expected a positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	snapshots, err := datastore.MetricSnapshots(metric, nil, days)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("content-type", "application/json")
+	writeJSON(w, snapshots)
+}
+
+func isSnapshotMetric(metric string) bool {
+	for _, snapshotMetric := range append(snapshotMetrics, collectedSnapshotMetrics...) {
+		if metric == snapshotMetric {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/cache"
+	"github.com/fluidkeys/dashboard/datastore"
+)
+
+// failingSnapshotStore fails to record snapshots of one metric
+type failingSnapshotStore struct {
+	*memoryStore
+	failMetric string
+}
+
+func (s failingSnapshotStore) SetMetricSnapshot(metric string, value float64, takenAt time.Time) error {
+	if metric == s.failMetric {
+		return fmt.Errorf("failed to record %s", metric)
+	}
+	return s.memoryStore.SetMetricSnapshot(metric, value, takenAt)
+}
+
+func TestTakeSnapshots(t *testing.T) {
+	initializeTestDatabase(t)
+	now := time.Now().UTC()
+
+	if err := datastore.SetMetricTimes("calls", []time.Time{now.Add(time.Hour), now.AddDate(0, 0, 1)}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("nothing released yet", func(t *testing.T) {
+		store := newMemoryStore()
+
+		if code := takeSnapshots(store, now); code != 0 {
+			t.Errorf("expected exit code 0, got %d", code)
+		}
+		if len(store.snapshots) != 1 || store.snapshots["callsArrangedNext7Days"] != 2 {
+			t.Errorf("expected only a snapshot of 2 calls, got %v", store.snapshots)
+		}
+	})
+
+	if err := datastore.SetMetricTimes("releases", []time.Time{now.AddDate(0, 0, -10)}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("every metric", func(t *testing.T) {
+		store := newMemoryStore()
+
+		if code := takeSnapshots(store, now); code != 0 {
+			t.Errorf("expected exit code 0, got %d", code)
+		}
+		expected := map[string]float64{"callsArrangedNext7Days": 2, "daysSinceLastRelease": 10}
+		if len(store.snapshots) != len(expected) {
+			t.Errorf("expected %v, got %v", expected, store.snapshots)
+		}
+		for metric, value := range expected {
+			if store.snapshots[metric] != value {
+				t.Errorf("%s: expected %v, got %v", metric, value, store.snapshots[metric])
+			}
+		}
+	})
+
+	t.Run("one metric fails to record", func(t *testing.T) {
+		store := failingSnapshotStore{memoryStore: newMemoryStore(), failMetric: "callsArrangedNext7Days"}
+
+		if code := takeSnapshots(store, now); code != 1 {
+			t.Errorf("expected exit code 1, got %d", code)
+		}
+		if len(store.snapshots) != 1 || store.snapshots["daysSinceLastRelease"] != 10 {
+			t.Errorf("expected the other metric to be recorded, got %v", store.snapshots)
+		}
+	})
+}
+
+func TestJSONIndexSnapshotHistory(t *testing.T) {
+	initializeTestDatabase(t)
+	now := time.Now().UTC()
+
+	for daysAgo, calls := range []float64{5, 4, 3} {
+		if err := datastore.SetMetricSnapshot("callsArrangedNext7Days", calls, now.AddDate(0, 0, -daysAgo)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// too old to show
+	if err := datastore.SetMetricSnapshot("callsArrangedNext7Days", 1, now.AddDate(0, 0, -snapshotHistoryDays)); err != nil {
+		t.Fatal(err)
+	}
+
+	response := httptest.NewRecorder()
+	handleJSONIndex(cache.New(time.Minute)).ServeHTTP(response, httptest.NewRequest("GET", "/json", nil))
+	if response.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", response.Code, response.Body)
+	}
+
+	type snapshot struct {
+		Date  string  `json:"date"`
+		Value float64 `json:"value"`
+	}
+	metrics := struct {
+		CallsHistory   []snapshot `json:"callsArrangedNext7DaysHistory"`
+		ReleaseHistory []snapshot `json:"daysSinceLastReleaseHistory"`
+	}{}
+	if err := json.Unmarshal(response.Body.Bytes(), &metrics); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	// oldest first
+	if len(metrics.CallsHistory) != 3 || metrics.CallsHistory[0].Value != 3 || metrics.CallsHistory[2].Value != 5 ||
+		metrics.CallsHistory[2].Date != now.Format("2006-01-02") {
+		t.Errorf("expected the last 3 days' snapshots, oldest first, got %+v", metrics.CallsHistory)
+	}
+	if metrics.ReleaseHistory == nil || len(metrics.ReleaseHistory) != 0 {
+		t.Errorf("expected an empty release history, got %+v", metrics.ReleaseHistory)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/mailinglist"
+)
+
+// listSizeSnapshotMetric is the snapshot of the mailing list's size, as
+// reported by the provider each time the collector runs
+const listSizeSnapshotMetric = "releaseNotesListSize"
+
+// mailingListConfig says which list to read from a Mailchimp-compatible API
+type mailingListConfig struct {
+	listID  string
+	apiKey  string
+	baseURL string
+}
+
+// mailingListConfigured returns true if signups and unsubscribes should come
+// from the mailing list provider rather than the Google Sheet
+func mailingListConfigured() bool {
+	return os.Getenv("MAILING_LIST_ID") != ""
+}
+
+// getMailingListConfig reads MAILING_LIST_ID, MAILING_LIST_API_KEY and
+// MAILING_LIST_API_URL, which defaults to the Mailchimp API for the key's data
+// center
+func getMailingListConfig() (*mailingListConfig, error) {
+	config := mailingListConfig{
+		listID:  os.Getenv("MAILING_LIST_ID"),
+		apiKey:  os.Getenv("MAILING_LIST_API_KEY"),
+		baseURL: os.Getenv("MAILING_LIST_API_URL"),
+	}
+
+	if config.listID == "" {
+		return nil, configErrorf("Missing MAILING_LIST_ID environment variable")
+	}
+	if config.apiKey == "" {
+		return nil, configErrorf("Missing MAILING_LIST_API_KEY environment variable")
+	}
+	if config.baseURL == "" {
+		var err error
+		if config.baseURL, err = mailinglist.DefaultBaseURL(config.apiKey); err != nil {
+			return nil, configErrorf("Can't tell the API URL from MAILING_LIST_API_KEY, "+
+				"set MAILING_LIST_API_URL instead: %v", err)
+		}
+	}
+	return &config, nil
+}
+
+// syncMailingList records the signups and unsubscribes of every member of the
+// release notes mailing list, and the list's current size. It's skipped unless
+// MAILING_LIST_ID is set, in which case the Google Sheet collectors are
+// skipped instead.
+func syncMailingList(ctx context.Context, clients apiClients, store collectorStore) error {
+	if !mailingListConfigured() {
+		fmt.Print("Skipping mailing list: no MAILING_LIST_ID environment variable\n")
+		return errSkipped
+	}
+
+	config, err := getMailingListConfig()
+	if err != nil {
+		return err
+	}
+
+	client := &mailinglist.Client{BaseURL: config.baseURL, APIKey: config.apiKey, HTTPClient: clients.web}
+
+	signups, unsubscribes, err := getMailingListEvents(ctx, client, config.listID)
+	if err != nil {
+		return err
+	}
+
+	listSize, err := client.MemberCount(ctx, config.listID)
+	if err != nil {
+		return apiError("failed to get mailing list size", err, mailinglist.ErrUnexpectedResponse)
+	}
+
+	if err := store.SetMetricEvents("signups", signups); err != nil {
+		return err
+	}
+	if err := store.SetMetricEvents("unsubscribes", unsubscribes); err != nil {
+		return err
+	}
+	return store.SetMetricSnapshot(listSizeSnapshotMetric, float64(listSize), time.Now())
+}
+
+// getMailingListEvents returns a signup for every member of the list who has
+// subscribed, and an unsubscribe for each of them who has since left
+func getMailingListEvents(ctx context.Context, client *mailinglist.Client, listID string) (
+	signups []datastore.Event, unsubscribes []datastore.Event, err error) {
+
+	members, err := client.Members(ctx, listID)
+	if err != nil {
+		return nil, nil, apiError("failed to get mailing list members", err, mailinglist.ErrUnexpectedResponse)
+	}
+
+	if len(members) == 0 {
+		return nil, nil, sourceErrorf("got 0 mailing list members, can't be right")
+	}
+
+	signups = []datastore.Event{}
+	unsubscribes = []datastore.Event{}
+	withoutTimes := 0
+
+	for _, member := range members {
+		switch member.Status {
+		case mailinglist.Pending, mailinglist.Transactional:
+			continue // never subscribed
+		case mailinglist.Subscribed, mailinglist.Unsubscribed, mailinglist.Cleaned, mailinglist.Archived:
+		default:
+			return nil, nil, parseErrorf("unknown status '%s' for mailing list member %s", member.Status, member.ID)
+		}
+
+		// members added by hand or imported may not have either time
+		signedUp := member.TimestampOpt
+		if signedUp == "" {
+			signedUp = member.TimestampSignup
+		}
+		if signedUp == "" {
+			withoutTimes++
+			continue
+		}
+
+		signedUpAt, err := parseMailingListTime(signedUp)
+		if err != nil {
+			return nil, nil, parseErrorf("failed to parse signup time of member %s: %v", member.ID, err)
+		}
+		signups = append(signups, datastore.Event{OccurredAt: signedUpAt, SourceID: member.ID})
+
+		if member.Status == mailinglist.Subscribed {
+			continue
+		}
+
+		// they've unsubscribed, bounced (cleaned) or been archived
+		leftAt, err := parseMailingListTime(member.LastChanged)
+		if err != nil {
+			return nil, nil, parseErrorf("failed to parse last changed time of member %s: %v", member.ID, err)
+		}
+		unsubscribes = append(unsubscribes, datastore.Event{OccurredAt: leftAt, SourceID: member.ID})
+	}
+
+	if withoutTimes > 0 {
+		fmt.Printf("INFO: skipped %d mailing list members with no signup time\n", withoutTimes)
+	}
+	return signups, unsubscribes, nil
+}
+
+// parseMailingListTime parses a time like "2019-03-25T14:02:19+00:00", in UTC
+// since that's how the other collectors' times are stored
+func parseMailingListTime(value string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
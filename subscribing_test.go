@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/fakeapi"
+	"github.com/fluidkeys/dashboard/mailinglist"
+)
+
+const (
+	testListID = "release-notes"
+	testAPIKey = "0123456789abcdef-us1"
+)
+
+func testMembers() []mailinglist.Member {
+	return []mailinglist.Member{
+		{ID: "a", Status: mailinglist.Subscribed, TimestampOpt: "2019-03-25T14:02:19+00:00"},
+		{ID: "b", Status: mailinglist.Unsubscribed, TimestampOpt: "2019-03-26T09:00:00+01:00",
+			LastChanged: "2019-04-01T10:00:00+00:00"},
+		{ID: "c", Status: mailinglist.Pending, TimestampSignup: "2019-04-02T10:00:00+00:00"},
+		// imported, so it only has a signup time
+		{ID: "d", Status: mailinglist.Subscribed, TimestampSignup: "2019-04-03T10:00:00+00:00"},
+		{ID: "e", Status: mailinglist.Subscribed},
+	}
+}
+
+func TestGetMailingListEvents(t *testing.T) {
+	t.Run("pages through every member", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+		fake.SetListMembers(testListID, testMembers())
+
+		client := &mailinglist.Client{BaseURL: "https://us1.api.mailchimp.com/3.0", HTTPClient: fake.Client(),
+			PageSize: 2}
+
+		signups, unsubscribes, err := getMailingListEvents(context.Background(), client, testListID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		assertEventTimes(t, []time.Time{
+			time.Date(2019, 3, 25, 14, 2, 19, 0, time.UTC),
+			time.Date(2019, 3, 26, 8, 0, 0, 0, time.UTC),
+			time.Date(2019, 4, 3, 10, 0, 0, 0, time.UTC),
+		}, signups)
+		assertEventTimes(t, []time.Time{time.Date(2019, 4, 1, 10, 0, 0, 0, time.UTC)}, unsubscribes)
+
+		if unsubscribes[0].SourceID != "b" {
+			t.Errorf("expected the unsubscribe to have the member's ID, got %+v", unsubscribes[0])
+		}
+
+		pages := 0
+		for _, request := range fake.Requests() {
+			if request == "GET /3.0/lists/"+testListID+"/members" {
+				pages++
+			}
+		}
+		if pages != 3 {
+			t.Errorf("expected 3 pages, got %d: %v", pages, fake.Requests())
+		}
+	})
+
+	for _, test := range []struct {
+		name         string
+		members      []mailinglist.Member
+		apiKey       string
+		failStatus   int
+		expectedKind errorKind
+	}{
+		{"empty list", []mailinglist.Member{}, testAPIKey, 0, sourceError},
+		{"bad timestamp", []mailinglist.Member{{ID: "a", Status: "subscribed", TimestampOpt: "25/03/2019"}},
+			testAPIKey, 0, parseError},
+		{"unknown status", []mailinglist.Member{{ID: "a", Status: "deleted"}}, testAPIKey, 0, parseError},
+		{"wrong API key", testMembers(), "wrong-us1", 0, authError},
+		{"unavailable", testMembers(), testAPIKey, http.StatusServiceUnavailable, sourceError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakeapi.NewServer()
+			defer fake.Close()
+			fake.APIKey = testAPIKey
+			fake.SetListMembers(testListID, test.members)
+			if test.failStatus != 0 {
+				fake.FailNext("/3.0/lists/", test.failStatus, "")
+			}
+
+			client := &mailinglist.Client{BaseURL: "https://us1.api.mailchimp.com/3.0", APIKey: test.apiKey,
+				HTTPClient: fake.Client()}
+
+			_, _, err := getMailingListEvents(context.Background(), client, testListID)
+			assertErrorKind(t, err, test.expectedKind)
+		})
+	}
+}
+
+func TestSyncMailingList(t *testing.T) {
+	setEnv(t, "MAILING_LIST_ID", testListID)
+	setEnv(t, "MAILING_LIST_API_KEY", testAPIKey)
+
+	fake := fakeapi.NewServer()
+	defer fake.Close()
+	fake.APIKey = testAPIKey
+	fake.SetListMembers(testListID, testMembers())
+
+	store := newMemoryStore()
+	if err := syncMailingList(context.Background(), apiClients{web: fake.Client()}, store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(store.events["signups"]) != 3 || len(store.events["unsubscribes"]) != 1 {
+		t.Errorf("expected 3 signups and 1 unsubscribe, got %v", store.events)
+	}
+	if store.snapshots[listSizeSnapshotMetric] != 3 {
+		t.Errorf("expected a list size of 3, got %v", store.snapshots)
+	}
+
+	// the Google Sheet collectors don't overwrite the mailing list's events
+	if err := syncReleaseSignups(context.Background(), apiClients{}, store); err != errSkipped {
+		t.Errorf("expected signups from the sheet to be skipped, got %v", err)
+	}
+	if len(store.events["signups"]) != 3 {
+		t.Errorf("expected the signups to be kept, got %v", store.events["signups"])
+	}
+}
+
+func TestGetMailingListConfig(t *testing.T) {
+	setEnv(t, "MAILING_LIST_ID", testListID)
+	setEnv(t, "MAILING_LIST_API_KEY", testAPIKey)
+	setEnv(t, "MAILING_LIST_API_URL", "")
+
+	config, err := getMailingListConfig()
+	if err != nil || config.baseURL != "https://us1.api.mailchimp.com/3.0" {
+		t.Errorf("expected the API URL for us1, got %+v, %v", config, err)
+	}
+
+	setEnv(t, "MAILING_LIST_API_KEY", "no-data-center-")
+	if _, err := getMailingListConfig(); kindOf(err) != configError {
+		t.Errorf("expected a config error, got %v", err)
+	}
+
+	setEnv(t, "MAILING_LIST_API_URL", "https://lists.example.com/3.0")
+	if config, err := getMailingListConfig(); err != nil || config.baseURL != "https://lists.example.com/3.0" {
+		t.Errorf("expected MAILING_LIST_API_URL to be used, got %+v, %v", config, err)
+	}
+}
+
+func TestSyncReleaseUnsubscribes(t *testing.T) {
+	initializeTestDatabase(t)
+	setEnv(t, "MAILING_LIST_ID", "")
+	setEnv(t, "GOOGLE_SHEETS_RELEASE_SIGNUPS_ID", signupsSheet)
+
+	now := time.Now().UTC()
+	threeDaysAgo := time.Date(now.Year(), now.Month(), now.Day()-3, 12, 0, 0, 0, time.UTC)
+	twoDaysAgo := threeDaysAgo.AddDate(0, 0, 1)
+	cell := func(t time.Time) string { return t.Format("02/01/2006 15:04:05") }
+
+	fake := fakeapi.NewServer()
+	defer fake.Close()
+	fake.SetSheetValues(signupsSheet, "Recent signups!A2:B", [][]interface{}{
+		{cell(threeDaysAgo), "alice@example.com"},
+		{cell(threeDaysAgo.Add(time.Hour)), "bob@example.com"},
+		{cell(threeDaysAgo.Add(2 * time.Hour)), "carol@example.com"},
+		{cell(twoDaysAgo), "dave@example.com"},
+	})
+	fake.SetSheetValues(signupsSheet, "Unsubscribes!A2:A", [][]interface{}{
+		{cell(threeDaysAgo.Add(3 * time.Hour))},
+		{}, // blank rows are skipped
+		{cell(twoDaysAgo.Add(time.Hour))},
+		{cell(twoDaysAgo.Add(2 * time.Hour))},
+	})
+
+	clients := apiClients{newGoogle: func() (*http.Client, error) { return fake.Client(), nil }}
+	store := databaseStore{}
+	if err := syncReleaseSignups(context.Background(), clients, store); err != nil {
+		t.Fatalf("unexpected error syncing signups: %v", err)
+	}
+	if err := syncReleaseUnsubscribes(context.Background(), clients, store); err != nil {
+		t.Fatalf("unexpected error syncing unsubscribes: %v", err)
+	}
+
+	index, err := getJSONIndex("")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	growth := make(map[string]int)
+	for _, dateCount := range index.ReleaseNotesNetGrowth {
+		growth[time.Time(dateCount.Date).Format("2006-01-02")] = dateCount.Count
+	}
+	if got := growth[threeDaysAgo.Format("2006-01-02")]; got != 2 {
+		t.Errorf("three days ago: expected net growth of 3 - 1 = 2, got %d", got)
+	}
+	if got := growth[twoDaysAgo.Format("2006-01-02")]; got != -1 {
+		t.Errorf("two days ago: expected net growth of 1 - 2 = -1, got %d", got)
+	}
+
+	sizes := index.ReleaseNotesListSize
+	if len(sizes) == 0 || sizes[len(sizes)-1].Count != 1 {
+		t.Errorf("expected the list to end with 4 - 3 = 1 member, got %v", sizes)
+	}
+
+	for _, test := range []struct {
+		name         string
+		values       [][]interface{}
+		expectedKind errorKind
+	}{
+		{"bad timestamp", [][]interface{}{{"2019-03-25"}}, parseError},
+		{"non-string cell", [][]interface{}{{42.0}}, parseError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake.SetSheetValues(signupsSheet, "Unsubscribes!A2:A", test.values)
+
+			err := syncReleaseUnsubscribes(context.Background(), clients, store)
+			assertErrorKind(t, err, test.expectedKind)
+		})
+	}
+
+	t.Run("no unsubscribes is fine", func(t *testing.T) {
+		fake.SetSheetValues(signupsSheet, "Unsubscribes!A2:A", [][]interface{}{})
+
+		if err := syncReleaseUnsubscribes(context.Background(), clients, store); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+	})
+}
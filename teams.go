@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/models"
+)
+
+// defaultFluidkeysAPIURL is used unless FLUIDKEYS_API_URL is set
+const defaultFluidkeysAPIURL = "https://api.fluidkeys.com"
+
+// activeTeamMinMembers is how many members a team needs to count as active:
+// a team of one isn't using Fluidkeys as a team yet
+const activeTeamMinMembers = 2
+
+// the snapshots recorded each time the teams collector runs
+const (
+	activeTeamsSnapshotMetric = "activeTeams"
+	teamMembersSnapshotMetric = "teamMembers"
+)
+
+var validUUID = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Env is what the models handlers need
+type Env struct {
+	db models.Datastore
+}
+
+// databaseModels reads models from the database
+type databaseModels struct{}
+
+func (databaseModels) AllTeams() ([]*models.Team, error) {
+	return datastore.AllTeams()
+}
+
+// teamsIndex serves /api/teams: every Fluidkeys team, ordered by name
+func (env *Env) teamsIndex(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	teams, err := env.db.AllTeams()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	out, err := json.Marshal(teams)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("content-type", "application/json")
+	w.Write(out)
+}
+
+// syncTeams records every team on the Fluidkeys server, and today's number
+// of active teams and team members. It's skipped unless FLUIDKEYS_API_TOKEN
+// is set.
+func syncTeams(ctx context.Context, clients apiClients, store collectorStore) error {
+	token, got := os.LookupEnv("FLUIDKEYS_API_TOKEN")
+	if !got {
+		fmt.Print("Skipping teams: no FLUIDKEYS_API_TOKEN environment variable\n")
+		return errSkipped
+	}
+
+	baseURL := os.Getenv("FLUIDKEYS_API_URL")
+	if baseURL == "" {
+		baseURL = defaultFluidkeysAPIURL
+	}
+
+	teams, err := getTeams(ctx, clients.web, baseURL, token)
+	if err != nil {
+		return err
+	}
+
+	if err := store.SetTeams(teams); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	activeTeams, teamMembers := teamTotals(teams)
+	if err := store.SetMetricSnapshot(activeTeamsSnapshotMetric, float64(activeTeams), now); err != nil {
+		return err
+	}
+	return store.SetMetricSnapshot(teamMembersSnapshotMetric, float64(teamMembers), now)
+}
+
+// getTeams lists the teams from the Fluidkeys API's GET /v1/admin/teams
+func getTeams(ctx context.Context, client *http.Client, baseURL string, token string) ([]datastore.TeamRow, error) {
+	request, err := http.NewRequest("GET", strings.TrimSuffix(baseURL, "/")+"/v1/admin/teams", nil)
+	if err != nil {
+		return nil, configErrorf("invalid FLUIDKEYS_API_URL '%s': %v", baseURL, err)
+	}
+	request.Header.Set("authorization", "Bearer "+token)
+
+	response, err := client.Do(request.WithContext(ctx))
+	if err != nil {
+		return nil, sourceErrorf("failed to get teams: %w", err)
+	}
+	defer response.Body.Close()
+
+	if err := statusError("failed to get teams", response); err != nil {
+		return nil, err
+	}
+
+	body := struct {
+		Teams []struct {
+			UUID        string `json:"uuid"`
+			Name        string `json:"name"`
+			MemberCount *int   `json:"memberCount"`
+			CreatedAt   string `json:"createdAt"`
+		} `json:"teams"`
+	}{}
+	if err := json.NewDecoder(response.Body).Decode(&body); err != nil {
+		return nil, parseErrorf("failed to parse teams: %v", err)
+	}
+	if body.Teams == nil {
+		return nil, parseErrorf("failed to parse teams: no teams in response")
+	}
+	if len(body.Teams) == 0 {
+		// storing this would delete every team
+		return nil, sourceErrorf("got 0 teams, can't be right")
+	}
+
+	teams := []datastore.TeamRow{}
+	for _, team := range body.Teams {
+		if !validUUID.MatchString(team.UUID) {
+			return nil, parseErrorf("invalid UUID for team '%s': '%s'", team.Name, team.UUID)
+		}
+		if team.MemberCount == nil {
+			return nil, parseErrorf("no member count for team %s", team.UUID)
+		}
+
+		row := datastore.TeamRow{UUID: team.UUID, Name: team.Name, MemberCount: *team.MemberCount}
+		if team.CreatedAt != "" {
+			createdAt, err := time.Parse(time.RFC3339, team.CreatedAt)
+			if err != nil {
+				return nil, parseErrorf("failed to parse created time of team %s: %v", team.UUID, err)
+			}
+			row.CreatedAt = createdAt.UTC()
+		}
+		teams = append(teams, row)
+	}
+	return teams, nil
+}
+
+// teamTotals returns the number of active teams, and the number of members
+// of all the teams
+func teamTotals(teams []datastore.TeamRow) (activeTeams int, teamMembers int) {
+	for _, team := range teams {
+		if team.MemberCount >= activeTeamMinMembers {
+			activeTeams++
+		}
+		teamMembers += team.MemberCount
+	}
+	return activeTeams, teamMembers
+}
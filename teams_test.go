@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/fluidkeys/dashboard/datastore"
+	"github.com/fluidkeys/dashboard/fakeapi"
+)
+
+const testFluidkeysToken = "fluidkeys-admin-token"
+
+func testTeams() []fakeapi.Team {
+	return []fakeapi.Team{
+		{UUID: "e44e4317-fea1-414a-a176-2462a26b6825", Name: "Imagine Corporation", MemberCount: 5,
+			CreatedAt: "2019-03-25T14:02:19+01:00"},
+		{UUID: "acbcd1a9-1b52-4014-9f5b-5bb6a809be3b", Name: "Flex Tech Inc.", MemberCount: 1},
+		{UUID: "0a7e1c1d-35d7-4f57-a1b5-6d1c6cb5d0f4", Name: "Acme", MemberCount: 2},
+	}
+}
+
+func TestGetTeams(t *testing.T) {
+	t.Run("reads every team", func(t *testing.T) {
+		fake := fakeapi.NewServer()
+		defer fake.Close()
+		fake.APIKey = testFluidkeysToken
+		fake.SetTeams(testTeams())
+
+		teams, err := getTeams(context.Background(), fake.Client(), defaultFluidkeysAPIURL, testFluidkeysToken)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(teams) != 3 {
+			t.Fatalf("expected 3 teams, got %v", teams)
+		}
+		expected := datastore.TeamRow{
+			UUID: "e44e4317-fea1-414a-a176-2462a26b6825", Name: "Imagine Corporation", MemberCount: 5,
+			CreatedAt: time.Date(2019, 3, 25, 13, 2, 19, 0, time.UTC),
+		}
+		if teams[0] != expected {
+			t.Errorf("expected %+v, got %+v", expected, teams[0])
+		}
+		if !teams[1].CreatedAt.IsZero() {
+			t.Errorf("expected no created time, got %v", teams[1].CreatedAt)
+		}
+	})
+
+	for _, test := range []struct {
+		name         string
+		teams        []fakeapi.Team
+		token        string
+		failStatus   int
+		expectedKind errorKind
+	}{
+		{"wrong token", testTeams(), "wrong", 0, authError},
+		{"unavailable", testTeams(), testFluidkeysToken, http.StatusServiceUnavailable, sourceError},
+		{"no teams", []fakeapi.Team{}, testFluidkeysToken, 0, sourceError},
+		{"invalid UUID", []fakeapi.Team{{UUID: "not-a-uuid", Name: "Acme", MemberCount: 2}},
+			testFluidkeysToken, 0, parseError},
+		{"bad created time", []fakeapi.Team{{UUID: "0a7e1c1d-35d7-4f57-a1b5-6d1c6cb5d0f4", Name: "Acme",
+			MemberCount: 2, CreatedAt: "25/03/2019"}}, testFluidkeysToken, 0, parseError},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			fake := fakeapi.NewServer()
+			defer fake.Close()
+			fake.APIKey = testFluidkeysToken
+			fake.SetTeams(test.teams)
+			if test.failStatus != 0 {
+				fake.FailNext("/v1/admin/teams", test.failStatus, "")
+			}
+
+			_, err := getTeams(context.Background(), fake.Client(), defaultFluidkeysAPIURL, test.token)
+			assertErrorKind(t, err, test.expectedKind)
+		})
+	}
+}
+
+func TestSyncTeams(t *testing.T) {
+	setEnv(t, "FLUIDKEYS_API_TOKEN", testFluidkeysToken)
+	setEnv(t, "FLUIDKEYS_API_URL", "")
+
+	fake := fakeapi.NewServer()
+	defer fake.Close()
+	fake.APIKey = testFluidkeysToken
+	fake.SetTeams(testTeams())
+
+	store := newMemoryStore()
+	if err := syncTeams(context.Background(), apiClients{web: fake.Client()}, store); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(store.teams) != 3 {
+		t.Errorf("expected 3 teams, got %v", store.teams)
+	}
+	// Flex Tech has a single member, so isn't active
+	if store.snapshots[activeTeamsSnapshotMetric] != 2 {
+		t.Errorf("expected 2 active teams, got %v", store.snapshots)
+	}
+	if store.snapshots[teamMembersSnapshotMetric] != 8 {
+		t.Errorf("expected 8 team members, got %v", store.snapshots)
+	}
+}